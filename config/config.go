@@ -0,0 +1,383 @@
+// Package config loads the initial machine setup from a JSON file
+// and exports a running machine back into the same format
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/chapterzero/sai_vending/machine"
+)
+
+// Config describe a machine. Denominations are written the way they
+// are inserted from the CLI, in major units ("100", "0.50"), while
+// prices are in minor units of the currency
+type Config struct {
+	Currency string `json:"currency"`
+	// coins and notes taken by the machine,
+	// every coin of the currency when empty
+	Accepted        []string       `json:"accepted,omitempty"`
+	StackerCapacity int            `json:"stacker_capacity,omitempty"`
+	Drawer          map[string]int `json:"drawer"`
+	// coins each tube of the drawer holds, unlimited when missing
+	Tubes map[string]int `json:"tubes,omitempty"`
+	// coins left in the drawer on cash collection
+	Float map[string]int `json:"float,omitempty"`
+	// tax rate in percent per tax category, included in prices
+	TaxRates map[string]int `json:"tax_rates,omitempty"`
+	Items    []Item         `json:"items"`
+	// discounts, schedules and bundles, the item price applies without
+	Pricing *Pricing `json:"pricing,omitempty"`
+}
+
+type Item struct {
+	// slot code, numbered from 1 when empty
+	Slot     string `json:"slot,omitempty"`
+	Name     string `json:"name"`
+	Price    int    `json:"price"`
+	Stock    int    `json:"stock"`
+	Capacity int    `json:"capacity,omitempty"`
+	// key of tax_rates, "standard" when empty
+	Tax string `json:"tax,omitempty"`
+	// name per locale, ex: {"ja": "缶コーヒー"}
+	Names map[string]string `json:"names,omitempty"`
+}
+
+// FieldError points at the offending field, ex: items[1].price
+type FieldError struct {
+	Field string
+	Msg   string
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Field, e.Msg)
+}
+
+// ValidationError holds every FieldError found in a config
+type ValidationError []*FieldError
+
+func (e ValidationError) Error() string {
+	msgs := make([]string, len(e))
+	for i, v := range e {
+		msgs[i] = v.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Load read and validate the config file at path
+func Load(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return Parse(f)
+}
+
+// Parse read and validate a config, unknown fields are rejected
+// so a typo does not silently fall back to a default
+func Parse(r io.Reader) (*Config, error) {
+	c := &Config{}
+	d := json.NewDecoder(r)
+	d.DisallowUnknownFields()
+	if err := d.Decode(c); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			return nil, ValidationError{&FieldError{fieldPath(typeErr.Field), fmt.Sprintf("must be %s", typeErr.Type)}}
+		}
+		return nil, err
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Validate returns ValidationError listing every invalid field
+func (c *Config) Validate() error {
+	errs := ValidationError{}
+	add := func(field, format string, a ...interface{}) {
+		errs = append(errs, &FieldError{field, fmt.Sprintf(format, a...)})
+	}
+
+	currency, err := machine.LookupCurrency(c.Currency)
+	if err != nil {
+		add("currency", "%s is not a supported currency", c.Currency)
+		return errs
+	}
+
+	notes := 0
+	for i, v := range c.Accepted {
+		d, err := currency.Parse(v)
+		if err != nil {
+			add(fmt.Sprintf("accepted[%d]", i), "%s is not a %s coin or note", v, currency.Code)
+			continue
+		}
+		if currency.IsNote(d) {
+			notes++
+		}
+	}
+	if c.StackerCapacity < 0 {
+		add("stacker_capacity", "must not be negative")
+	}
+	if notes > 0 && c.StackerCapacity == 0 {
+		add("stacker_capacity", "required when notes are accepted")
+	}
+
+	registers := []struct {
+		name  string
+		coins map[string]int
+	}{
+		{"tubes", c.Tubes},
+		{"drawer", c.Drawer},
+		{"float", c.Float},
+	}
+	for _, r := range registers {
+		name, coins := r.name, r.coins
+		for _, k := range sortedKeys(coins) {
+			field := fmt.Sprintf("%s.%s", name, k)
+			d, err := currency.Parse(k)
+			if err != nil || !currency.IsCoin(d) {
+				add(field, "%s is not a %s coin", k, currency.Code)
+				continue
+			}
+			if coins[k] < 0 {
+				add(field, "must not be negative")
+			}
+			if capacity := c.Tubes[currency.FormatMajor(int(d))]; name != "tubes" && capacity > 0 && coins[k] > capacity {
+				add(field, "%d exceeds tube capacity %d", coins[k], capacity)
+			}
+		}
+	}
+
+	for _, k := range sortedKeys(c.TaxRates) {
+		if c.TaxRates[k] < 0 || c.TaxRates[k] > 100 {
+			add("tax_rates."+k, "must be between 0 and 100")
+		}
+	}
+
+	slots := make(map[string]bool)
+	for i, v := range c.Items {
+		field := fmt.Sprintf("items[%d]", i)
+		if v.Slot != "" {
+			if slots[strings.ToUpper(v.Slot)] {
+				add(field+".slot", "%s is used by another item", v.Slot)
+			}
+			slots[strings.ToUpper(v.Slot)] = true
+		}
+		if strings.TrimSpace(v.Name) == "" {
+			add(field+".name", "required")
+		}
+		if v.Price <= 0 {
+			add(field+".price", "must be positive")
+		}
+		if v.Stock < 0 {
+			add(field+".stock", "must not be negative")
+		}
+		if v.Capacity < 0 {
+			add(field+".capacity", "must not be negative")
+		}
+		if v.Capacity > 0 && v.Stock > v.Capacity {
+			add(field+".stock", "%d exceeds slot capacity %d", v.Stock, v.Capacity)
+		}
+		if _, ok := c.TaxRates[v.Tax]; v.Tax != "" && !ok {
+			add(field+".tax", "%s is not in tax_rates", v.Tax)
+		}
+		for _, k := range sortedKeys(v.Names) {
+			if l, err := machine.ParseLocale(k); err != nil || string(l) != k {
+				add(field+".names."+k, "%s is not a supported locale", k)
+			}
+		}
+	}
+
+	if c.Pricing != nil {
+		c.Pricing.validate(add)
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Options returns the hardware options of the config, to be used
+// with machine.Restore or machine.Replay. c must be valid
+func (c *Config) Options() []machine.Option {
+	currency, _ := machine.LookupCurrency(c.Currency)
+	opts := []machine.Option{machine.WithCurrency(currency)}
+	if len(c.Tubes) > 0 {
+		opts = append(opts, machine.WithTubes(parseCoins(currency, c.Tubes)))
+	}
+	if len(c.Float) > 0 {
+		opts = append(opts, machine.WithFloat(parseCoins(currency, c.Float)))
+	}
+	if c.Pricing != nil {
+		opts = append(opts, machine.WithPricing(c.Pricing.build()))
+	}
+	if len(c.TaxRates) > 0 {
+		rates := make(map[machine.TaxCategory]int)
+		for k, v := range c.TaxRates {
+			rates[machine.TaxCategory(k)] = v
+		}
+		opts = append(opts, machine.WithTaxRates(rates))
+	}
+	if len(c.Accepted) == 0 {
+		return opts
+	}
+
+	coins, notes := []machine.Currency{}, []machine.Currency{}
+	for _, v := range c.Accepted {
+		d, _ := currency.Parse(v)
+		if currency.IsNote(d) {
+			notes = append(notes, d)
+		} else {
+			coins = append(coins, d)
+		}
+	}
+
+	return append(opts, machine.WithCoins(coins...), machine.WithNotes(c.StackerCapacity, notes...))
+}
+
+// Build provision a new machine, opts are applied after the config
+// options. c must be valid
+func (c *Config) Build(opts ...machine.Option) *machine.Machine {
+	currency, _ := machine.LookupCurrency(c.Currency)
+	drawer := parseCoins(currency, c.Drawer)
+
+	inventories := make([]machine.Inventory, len(c.Items))
+	for i, v := range c.Items {
+		inventories[i] = machine.Inventory{
+			Slot:     v.Slot,
+			Item:     machine.Item{Name: v.Name, Price: v.Price, Tax: machine.TaxCategory(v.Tax), Names: parseNames(v.Names)},
+			Stock:    v.Stock,
+			Capacity: v.Capacity,
+		}
+	}
+
+	return machine.New(drawer, inventories, append(c.Options(), opts...)...)
+}
+
+// FromMachine export the current drawer, stock and hardware of m
+func FromMachine(m *machine.Machine) *Config {
+	currency := m.Currency()
+	state := m.State()
+	_, capacity := m.StackerLevel()
+
+	c := &Config{
+		Currency:        currency.Code,
+		Accepted:        []string{},
+		StackerCapacity: capacity,
+		Drawer:          make(map[string]int),
+		Items:           make([]Item, len(state.Inventories)),
+	}
+	for _, v := range m.Accepted() {
+		c.Accepted = append(c.Accepted, currency.FormatMajor(int(v)))
+	}
+	for k, v := range state.MainRegister {
+		c.Drawer[currency.FormatMajor(int(k))] = v
+	}
+	if tubes := m.Tubes(); len(tubes) > 0 {
+		c.Tubes = make(map[string]int)
+		for k, v := range tubes {
+			c.Tubes[currency.FormatMajor(int(k))] = v
+		}
+	}
+	if float := m.Float(); len(float) > 0 {
+		c.Float = make(map[string]int)
+		for k, v := range float {
+			c.Float[currency.FormatMajor(int(k))] = v
+		}
+	}
+	if rates := m.TaxRates(); len(rates) > 0 {
+		c.TaxRates = make(map[string]int)
+		for k, v := range rates {
+			c.TaxRates[string(k)] = v
+		}
+	}
+	c.Pricing = exportPricing(m.Pricing())
+	for i, v := range state.Inventories {
+		c.Items[i] = Item{
+			Slot:     v.Slot,
+			Name:     v.Name,
+			Price:    v.Price,
+			Stock:    v.Stock,
+			Capacity: v.Capacity,
+			Tax:      string(v.Tax),
+		}
+		if len(v.Names) > 0 {
+			c.Items[i].Names = make(map[string]string)
+			for k, name := range v.Names {
+				c.Items[i].Names[string(k)] = name
+			}
+		}
+	}
+
+	return c
+}
+
+// Write the config as indented JSON
+func (c *Config) Write(w io.Writer) error {
+	e := json.NewEncoder(w)
+	e.SetIndent("", "  ")
+	return e.Encode(c)
+}
+
+// parseCoins convert a drawer or float keyed by denomination in major units
+func parseCoins(currency *machine.CurrencyDef, coins map[string]int) map[machine.Currency]int {
+	parsed := make(map[machine.Currency]int)
+	for k, v := range coins {
+		d, _ := currency.Parse(k)
+		parsed[d] = v
+	}
+
+	return parsed
+}
+
+// parseNames convert item names keyed by locale, nil when there is none
+func parseNames(names map[string]string) map[machine.Locale]string {
+	if len(names) == 0 {
+		return nil
+	}
+
+	parsed := make(map[machine.Locale]string, len(names))
+	for k, v := range names {
+		parsed[machine.Locale(k)] = v
+	}
+	return parsed
+}
+
+// fieldPath write json decoder field "items.0.price" as "items[0].price"
+func fieldPath(field string) string {
+	parts := strings.Split(field, ".")
+	path := ""
+	for _, v := range parts {
+		if _, err := strconv.Atoi(v); err == nil {
+			path += "[" + v + "]"
+			continue
+		}
+		if path != "" {
+			path += "."
+		}
+		path += v
+	}
+
+	return path
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,219 @@
+package config
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/chapterzero/sai_vending/machine"
+)
+
+const validConfig = `{
+  "currency": "JPY",
+  "accepted": ["10", "50", "100", "500", "1000"],
+  "stacker_capacity": 50,
+  "drawer": {"10": 20, "100": 10},
+  "tubes": {"10": 50, "100": 30},
+  "float": {"10": 15, "100": 5},
+  "tax_rates": {"standard": 10, "reduced": 8},
+  "items": [
+    {"name": "Canned Coffee", "names": {"ja": "缶コーヒー"}, "price": 120, "stock": 10, "capacity": 20, "tax": "reduced"},
+    {"name": "Water PET bottle", "price": 100, "stock": 0}
+  ]
+}`
+
+func TestParse(t *testing.T) {
+	c, err := Parse(strings.NewReader(validConfig))
+	if err != nil {
+		t.Errorf("Expected error nil, got %v", err)
+		return
+	}
+
+	expected := &Config{
+		Currency:        "JPY",
+		Accepted:        []string{"10", "50", "100", "500", "1000"},
+		StackerCapacity: 50,
+		Drawer:          map[string]int{"10": 20, "100": 10},
+		Tubes:           map[string]int{"10": 50, "100": 30},
+		Float:           map[string]int{"10": 15, "100": 5},
+		TaxRates:        map[string]int{"standard": 10, "reduced": 8},
+		Items: []Item{
+			Item{Name: "Canned Coffee", Price: 120, Stock: 10, Capacity: 20, Tax: "reduced", Names: map[string]string{"ja": "缶コーヒー"}},
+			Item{Name: "Water PET bottle", Price: 100, Stock: 0},
+		},
+	}
+	if !reflect.DeepEqual(expected, c) {
+		t.Errorf("Expected %+v, got %+v", expected, c)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	testCases := []struct {
+		name          string
+		input         string
+		expectedError string
+	}{
+		{
+			name:          "Unknown currency",
+			input:         `{"currency": "USD", "drawer": {}, "items": []}`,
+			expectedError: "currency: USD is not a supported currency",
+		},
+		{
+			name:          "Wrong type",
+			input:         `{"currency": "JPY", "drawer": {}, "items": [{"name": "A", "price": "120"}]}`,
+			expectedError: "items[0].price: must be int",
+		},
+		{
+			name:          "Unknown field",
+			input:         `{"currency": "JPY", "drawer": {}, "items": [{"name": "A", "prise": 120}]}`,
+			expectedError: `json: unknown field "prise"`,
+		},
+		{
+			name:          "Duplicate slot",
+			input:         `{"currency": "JPY", "drawer": {}, "items": [{"slot": "A1", "name": "A", "price": 120}, {"slot": "a1", "name": "B", "price": 100}]}`,
+			expectedError: "items[1].slot: a1 is used by another item",
+		},
+		{
+			name:          "Tax category",
+			input:         `{"currency": "JPY", "drawer": {}, "tax_rates": {"standard": 110}, "items": [{"name": "A", "price": 120, "tax": "food"}]}`,
+			expectedError: "tax_rates.standard: must be between 0 and 100; items[0].tax: food is not in tax_rates",
+		},
+		{
+			name:          "Name locale",
+			input:         `{"currency": "JPY", "drawer": {}, "items": [{"name": "A", "price": 120, "names": {"ja": "エー", "ja_JP": "エー", "fr": "A"}}]}`,
+			expectedError: "items[0].names.fr: fr is not a supported locale; items[0].names.ja_JP: ja_JP is not a supported locale",
+		},
+		{
+			name: "Every invalid field reported",
+			input: `{
+				"currency": "JPY",
+				"accepted": ["100", "30", "5000"],
+				"drawer": {"10": -1, "1000": 2, "100": 6},
+				"tubes": {"100": 5},
+				"float": {"30": 1, "100": 8},
+				"items": [
+					{"name": "A", "price": 120, "stock": 3},
+					{"name": " ", "price": 0, "stock": 30, "capacity": 20}
+				]
+			}`,
+			expectedError: "accepted[1]: 30 is not a JPY coin or note; " +
+				"stacker_capacity: required when notes are accepted; " +
+				"drawer.10: must not be negative; " +
+				"drawer.100: 6 exceeds tube capacity 5; " +
+				"drawer.1000: 1000 is not a JPY coin; " +
+				"float.100: 8 exceeds tube capacity 5; " +
+				"float.30: 30 is not a JPY coin; " +
+				"items[1].name: required; " +
+				"items[1].price: must be positive; " +
+				"items[1].stock: 30 exceeds slot capacity 20",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse(strings.NewReader(tc.input))
+			if err == nil || err.Error() != tc.expectedError {
+				t.Errorf("Expected error '%s', got '%v'", tc.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestParseFieldError(t *testing.T) {
+	_, err := Parse(strings.NewReader(`{"currency": "JPY", "drawer": {}, "items": [{"name": "A", "price": -1}]}`))
+	errs, ok := err.(ValidationError)
+	if !ok || len(errs) != 1 {
+		t.Errorf("Expected one field error, got %v", err)
+		return
+	}
+	if errs[0].Field != "items[0].price" {
+		t.Errorf("Expected field items[0].price, got %s", errs[0].Field)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	c, _ := Parse(strings.NewReader(validConfig))
+	m := c.Build()
+
+	if err := m.Insert(machine.N1000); err != nil {
+		t.Errorf("Expected 1000 note accepted, got %v", err)
+	}
+	if err := m.Insert(machine.N5000); err == nil {
+		t.Errorf("Expected 5000 note not accepted")
+	}
+	if _, capacity := m.StackerLevel(); capacity != 50 {
+		t.Errorf("Expected stacker capacity 50, got %d", capacity)
+	}
+
+	state := m.State()
+	if state.MainRegister[machine.C10] != 20 || state.MainRegister[machine.C100] != 10 {
+		t.Errorf("Unexpected drawer %v", state.MainRegister)
+	}
+	if state.Inventories[0].Capacity != 20 || state.Inventories[1].Name != "Water PET bottle" {
+		t.Errorf("Unexpected inventories %+v", state.Inventories)
+	}
+	if float := m.Float(); !reflect.DeepEqual(map[machine.Currency]int{machine.C10: 15, machine.C100: 5}, float) {
+		t.Errorf("Unexpected float %v", float)
+	}
+	if tubes := m.Tubes(); !reflect.DeepEqual(map[machine.Currency]int{machine.C10: 50, machine.C100: 30}, tubes) {
+		t.Errorf("Unexpected tubes %v", tubes)
+	}
+	if rates := m.TaxRates(); !reflect.DeepEqual(map[machine.TaxCategory]int{machine.TaxStandard: 10, machine.TaxReduced: 8}, rates) || state.Inventories[0].Tax != machine.TaxReduced {
+		t.Errorf("Unexpected tax rates %v, item tax %s", rates, state.Inventories[0].Tax)
+	}
+	if name := state.Inventories[0].LocalName(machine.Japanese); name != "缶コーヒー" {
+		t.Errorf("Expected japanese name 缶コーヒー, got %s", name)
+	}
+}
+
+func TestBuildRestrictedCoins(t *testing.T) {
+	c, _ := Parse(strings.NewReader(`{"currency": "EUR", "accepted": ["0.50", "1", "2"], "drawer": {"0.10": 10}, "items": []}`))
+	m := c.Build()
+
+	if m.Currency() != machine.EUR {
+		t.Errorf("Expected EUR machine, got %s", m.Currency().Code)
+	}
+	if err := m.Insert(machine.Currency(20)); err == nil || err.Error() != "€0.20 coin is not accepted" {
+		t.Errorf("Expected error '€0.20 coin is not accepted', got '%v'", err)
+	}
+	if err := m.Insert(machine.Currency(200)); err != nil {
+		t.Errorf("Expected 2 euro coin accepted, got %v", err)
+	}
+}
+
+func TestFromMachine(t *testing.T) {
+	c, _ := Parse(strings.NewReader(validConfig))
+	m := c.Build()
+	m.Insert(machine.C500)
+	m.Buy(0)
+
+	exported := FromMachine(m)
+	buf := &bytes.Buffer{}
+	if err := exported.Write(buf); err != nil {
+		t.Errorf("Expected error nil, got %v", err)
+	}
+	reloaded, err := Parse(buf)
+	if err != nil {
+		t.Errorf("Expected exported config valid, got %v", err)
+		return
+	}
+
+	// 380 change: 3 x 100 + 8 x 10
+	expected := &Config{
+		Currency:        "JPY",
+		Accepted:        []string{"10", "50", "100", "500", "1000"},
+		StackerCapacity: 50,
+		Drawer:          map[string]int{"10": 12, "100": 7, "500": 1},
+		Tubes:           map[string]int{"10": 50, "100": 30},
+		Float:           map[string]int{"10": 15, "100": 5},
+		TaxRates:        map[string]int{"standard": 10, "reduced": 8},
+		Items: []Item{
+			Item{Slot: "1", Name: "Canned Coffee", Price: 120, Stock: 9, Capacity: 20, Tax: "reduced", Names: map[string]string{"ja": "缶コーヒー"}},
+			Item{Slot: "2", Name: "Water PET bottle", Price: 100, Stock: 0},
+		},
+	}
+	if !reflect.DeepEqual(expected, reloaded) {
+		t.Errorf("Expected %+v, got %+v", expected, reloaded)
+	}
+}
@@ -0,0 +1,198 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/chapterzero/sai_vending/machine"
+)
+
+// Pricing lists the rules changing the price actually paid,
+// matching rules apply in order
+type Pricing struct {
+	Rules   []PriceRule `json:"rules,omitempty"`
+	Bundles []Bundle    `json:"bundles,omitempty"`
+}
+
+// PriceRule is written with times of day as "15:00", weekdays
+// as "mon" to "sun" and dates as "2026-10-01" in local time, end excluded
+type PriceRule struct {
+	Name string `json:"name,omitempty"`
+	// every slot when empty
+	Slots    []string `json:"slots,omitempty"`
+	From     string   `json:"from,omitempty"`
+	To       string   `json:"to,omitempty"`
+	Weekdays []string `json:"weekdays,omitempty"`
+	Start    string   `json:"start,omitempty"`
+	End      string   `json:"end,omitempty"`
+	// Price replaces the item price, then Percent is taken off
+	Price   int `json:"price,omitempty"`
+	Percent int `json:"percent,omitempty"`
+}
+
+// Bundle gives free items for every buy items of slot in one checkout
+type Bundle struct {
+	Slot string `json:"slot"`
+	Buy  int    `json:"buy"`
+	Free int    `json:"free"`
+}
+
+const (
+	timeOfDayLayout = "15:04"
+	dateLayout      = "2006-01-02"
+)
+
+var weekdays = []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}
+
+// validate add an error for every invalid field of p
+func (p *Pricing) validate(add func(field, format string, a ...interface{})) {
+	for i, v := range p.Rules {
+		field := fmt.Sprintf("pricing.rules[%d]", i)
+		if (v.From == "") != (v.To == "") {
+			add(field, "from and to go together")
+		}
+		for _, t := range []struct{ name, value string }{{"from", v.From}, {"to", v.To}} {
+			if _, err := parseTimeOfDay(t.value); err != nil {
+				add(field+"."+t.name, "%s is not a time of day, ex: 15:00", t.value)
+			}
+		}
+		for n, d := range v.Weekdays {
+			if _, err := parseWeekday(d); err != nil {
+				add(fmt.Sprintf("%s.weekdays[%d]", field, n), "%s is not a weekday, ex: mon", d)
+			}
+		}
+		start, startErr := parseDate(v.Start)
+		if startErr != nil {
+			add(field+".start", "%s is not a date, ex: 2026-10-01", v.Start)
+		}
+		end, endErr := parseDate(v.End)
+		if endErr != nil {
+			add(field+".end", "%s is not a date, ex: 2026-10-01", v.End)
+		}
+		if startErr == nil && endErr == nil && !start.IsZero() && !end.IsZero() && !end.After(start) {
+			add(field+".end", "must be after start")
+		}
+		if v.Price < 0 {
+			add(field+".price", "must not be negative")
+		}
+		if v.Percent < 0 || v.Percent >= 100 {
+			add(field+".percent", "must be between 0 and 99")
+		}
+		if v.Price == 0 && v.Percent == 0 {
+			add(field, "price or percent required")
+		}
+	}
+
+	for i, v := range p.Bundles {
+		field := fmt.Sprintf("pricing.bundles[%d]", i)
+		if v.Slot == "" {
+			add(field+".slot", "required")
+		}
+		if v.Buy <= 0 {
+			add(field+".buy", "must be positive")
+		}
+		if v.Free <= 0 {
+			add(field+".free", "must be positive")
+		}
+	}
+}
+
+// build convert p to machine pricing, p must be valid
+func (p *Pricing) build() machine.Pricing {
+	pricing := machine.Pricing{}
+	for _, v := range p.Rules {
+		r := machine.PriceRule{
+			Name:    v.Name,
+			Slots:   v.Slots,
+			Price:   v.Price,
+			Percent: v.Percent,
+		}
+		r.From, _ = parseTimeOfDay(v.From)
+		r.To, _ = parseTimeOfDay(v.To)
+		r.Start, _ = parseDate(v.Start)
+		r.End, _ = parseDate(v.End)
+		for _, d := range v.Weekdays {
+			w, _ := parseWeekday(d)
+			r.Weekdays = append(r.Weekdays, w)
+		}
+		pricing.Rules = append(pricing.Rules, r)
+	}
+	for _, v := range p.Bundles {
+		pricing.Bundles = append(pricing.Bundles, machine.Bundle{Slot: v.Slot, Buy: v.Buy, Free: v.Free})
+	}
+
+	return pricing
+}
+
+// exportPricing write machine pricing in config format,
+// nil when the machine has no pricing
+func exportPricing(pricing machine.Pricing) *Pricing {
+	if len(pricing.Rules) == 0 && len(pricing.Bundles) == 0 {
+		return nil
+	}
+
+	p := &Pricing{}
+	for _, v := range pricing.Rules {
+		r := PriceRule{
+			Name:    v.Name,
+			Slots:   v.Slots,
+			Price:   v.Price,
+			Percent: v.Percent,
+		}
+		if v.From != 0 || v.To != 0 {
+			r.From, r.To = formatTimeOfDay(v.From), formatTimeOfDay(v.To)
+		}
+		if !v.Start.IsZero() {
+			r.Start = v.Start.Format(dateLayout)
+		}
+		if !v.End.IsZero() {
+			r.End = v.End.Format(dateLayout)
+		}
+		for _, d := range v.Weekdays {
+			r.Weekdays = append(r.Weekdays, weekdays[d])
+		}
+		p.Rules = append(p.Rules, r)
+	}
+	for _, v := range pricing.Bundles {
+		p.Bundles = append(p.Bundles, Bundle{Slot: v.Slot, Buy: v.Buy, Free: v.Free})
+	}
+
+	return p
+}
+
+// parseTimeOfDay returns the time since midnight of "15:04", zero when empty
+func parseTimeOfDay(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, nil
+	}
+	t, err := time.Parse(timeOfDayLayout, s)
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func formatTimeOfDay(d time.Duration) string {
+	return time.Time{}.Add(d).Format(timeOfDayLayout)
+}
+
+// parseDate returns midnight of a local date, zero time when empty
+func parseDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+
+	return time.ParseInLocation(dateLayout, s, time.Local)
+}
+
+func parseWeekday(s string) (time.Weekday, error) {
+	for i, v := range weekdays {
+		if strings.EqualFold(v, s) {
+			return time.Weekday(i), nil
+		}
+	}
+
+	return 0, fmt.Errorf("%s is not a weekday", s)
+}
@@ -0,0 +1,125 @@
+package config
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chapterzero/sai_vending/machine"
+)
+
+const pricingConfig = `{
+  "currency": "JPY",
+  "drawer": {"10": 20, "100": 10},
+  "items": [
+    {"slot": "A1", "name": "Canned Coffee", "price": 120, "stock": 10},
+    {"slot": "A2", "name": "Water PET bottle", "price": 100, "stock": 10}
+  ],
+  "pricing": {
+    "rules": [
+      {"name": "Water promotion", "slots": ["A2"], "start": "2026-10-01", "end": "2026-11-01", "price": 90},
+      {"name": "Happy hour", "from": "15:00", "to": "17:00", "weekdays": ["mon", "tue", "wed", "thu", "fri"], "percent": 20}
+    ],
+    "bundles": [{"slot": "A1", "buy": 2, "free": 1}]
+  }
+}`
+
+func TestBuildPricing(t *testing.T) {
+	c, err := Parse(strings.NewReader(pricingConfig))
+	if err != nil {
+		t.Errorf("Expected error nil, got %v", err)
+		return
+	}
+
+	testCases := []struct {
+		name           string
+		now            time.Time
+		expectedPrices []int
+	}{
+		{"Wednesday happy hour", time.Date(2026, 10, 14, 16, 0, 0, 0, time.Local), []int{100, 80}},
+		{"Saturday", time.Date(2026, 10, 17, 16, 0, 0, 0, time.Local), []int{120, 90}},
+		{"After the promotion", time.Date(2026, 11, 1, 10, 0, 0, 0, time.Local), []int{120, 100}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			now := tc.now
+			m := c.Build(machine.WithClock(func() time.Time { return now }))
+			prices := []int{}
+			for _, slot := range []string{"A1", "A2"} {
+				price, _ := m.Price(slot)
+				prices = append(prices, price)
+			}
+			if !reflect.DeepEqual(tc.expectedPrices, prices) {
+				t.Errorf("Expected %v, got %v", tc.expectedPrices, prices)
+			}
+		})
+	}
+
+	exported := FromMachine(c.Build())
+	buf := &bytes.Buffer{}
+	exported.Write(buf)
+	reloaded, err := Parse(buf)
+	if err != nil {
+		t.Errorf("Expected exported config valid, got %v", err)
+		return
+	}
+	if !reflect.DeepEqual(c.Pricing, reloaded.Pricing) {
+		t.Errorf("Expected %+v, got %+v", c.Pricing, reloaded.Pricing)
+	}
+}
+
+func TestParseInvalidPricing(t *testing.T) {
+	testCases := []struct {
+		name          string
+		pricing       string
+		expectedError string
+	}{
+		{
+			name:          "Time of day",
+			pricing:       `{"rules": [{"from": "25:00", "to": "3pm", "percent": 10}]}`,
+			expectedError: "pricing.rules[0].from: 25:00 is not a time of day, ex: 15:00; pricing.rules[0].to: 3pm is not a time of day, ex: 15:00",
+		},
+		{
+			name:          "From without to",
+			pricing:       `{"rules": [{"from": "15:00", "percent": 10}]}`,
+			expectedError: "pricing.rules[0]: from and to go together",
+		},
+		{
+			name:          "Weekday",
+			pricing:       `{"rules": [{"weekdays": ["monday"], "percent": 10}]}`,
+			expectedError: "pricing.rules[0].weekdays[0]: monday is not a weekday, ex: mon",
+		},
+		{
+			name:          "Dates",
+			pricing:       `{"rules": [{"start": "2026-11-01", "end": "2026-10-01", "price": 100}]}`,
+			expectedError: "pricing.rules[0].end: must be after start",
+		},
+		{
+			name:          "Nothing to change",
+			pricing:       `{"rules": [{"name": "Happy hour"}]}`,
+			expectedError: "pricing.rules[0]: price or percent required",
+		},
+		{
+			name:          "Percent",
+			pricing:       `{"rules": [{"percent": 100}]}`,
+			expectedError: "pricing.rules[0].percent: must be between 0 and 99",
+		},
+		{
+			name:          "Bundle",
+			pricing:       `{"bundles": [{"slot": "A1", "buy": 0, "free": 1}]}`,
+			expectedError: "pricing.bundles[0].buy: must be positive",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			input := `{"currency": "JPY", "drawer": {}, "items": [], "pricing": ` + tc.pricing + `}`
+			_, err := Parse(strings.NewReader(input))
+			if err == nil || err.Error() != tc.expectedError {
+				t.Errorf("Expected error '%s', got '%v'", tc.expectedError, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/chapterzero/sai_vending/machine"
+)
+
+// Command describe a verb of the command language
+type Command struct {
+	Name    string
+	Aliases []string
+	// arguments after the verb, ex: "<coin>..."
+	Usage   string
+	Summary string
+	Handler Handler
+	// print machine display after the command succeeds
+	Display bool
+}
+
+// Registry resolve a command line to its Command by name or alias
+type Registry struct {
+	commands []*Command
+	byName   map[string]*Command
+}
+
+func NewRegistry() *Registry {
+	return &Registry{byName: make(map[string]*Command)}
+}
+
+// DefaultRegistry holds the customer commands, aliases keep the
+// numeric command codes of the original CLI working
+func DefaultRegistry() *Registry {
+	r := NewRegistry()
+	r.Register(&Command{
+		Name:    "insert",
+		Aliases: []string{"1", "push"},
+		Usage:   "<coin>...",
+		Summary: "insert one or more coins, ex: insert 100 100 10",
+		Handler: &InsertHandler{},
+		Display: true,
+	})
+	r.Register(&Command{
+		Name:    "buy",
+		Aliases: []string{"2"},
+		Usage:   "<slot|name>",
+		Summary: "buy an item by slot code or name, ex: buy 1, buy canned coffee",
+		Handler: &BuyHandler{},
+		Display: true,
+	})
+	r.Register(&Command{
+		Name:    "add",
+		Aliases: []string{"cart"},
+		Usage:   "<slot|name> [quantity]",
+		Summary: "put items in the cart, ex: add 1 2, add canned coffee",
+		Handler: &AddToCartHandler{},
+		Display: true,
+	})
+	r.Register(&Command{
+		Name:    "remove",
+		Usage:   "<slot|name>",
+		Summary: "take an item out of the cart",
+		Handler: &RemoveFromCartHandler{},
+		Display: true,
+	})
+	r.Register(&Command{
+		Name:    "checkout",
+		Aliases: []string{"pay"},
+		Summary: "buy every item of the cart at once",
+		Handler: &CheckoutHandler{},
+		Display: true,
+	})
+	r.Register(&Command{
+		Name:    "take-items",
+		Aliases: []string{"3"},
+		Summary: "take items from the outlet",
+		Handler: &GetItemHandler{},
+		Display: true,
+	})
+	r.Register(&Command{
+		Name:    "cancel",
+		Aliases: []string{"4", "return"},
+		Summary: "return inserted money to the return gate and empty the cart",
+		Handler: &ReturnInputHandler{},
+		Display: true,
+	})
+	r.Register(&Command{
+		Name:    "take-change",
+		Aliases: []string{"5"},
+		Summary: "take coins from the return gate",
+		Handler: &GetReturnHandler{},
+		Display: true,
+	})
+	r.Register(&Command{
+		Name:    "receipt",
+		Summary: "print the receipt of the last purchase",
+		Handler: &ReceiptHandler{},
+	})
+	r.Register(&Command{
+		Name:    "status",
+		Aliases: []string{"s"},
+		Usage:   "[text|tabs|json|compact]",
+		Summary: "show the machine, ex: status compact",
+		Handler: &StatusHandler{},
+	})
+	r.Register(&Command{
+		Name:    "help",
+		Aliases: []string{"h", "?"},
+		Summary: "show this help",
+		Handler: &HelpHandler{Registry: r},
+	})
+
+	return r
+}
+
+// Register add c, its name and aliases must not be taken yet
+func (r *Registry) Register(c *Command) {
+	for _, v := range append([]string{c.Name}, c.Aliases...) {
+		key := strings.ToLower(v)
+		if _, ok := r.byName[key]; ok {
+			panic(fmt.Sprintf("handlers: command %s registered twice", v))
+		}
+		r.byName[key] = c
+	}
+	r.commands = append(r.commands, c)
+}
+
+// Lookup find a command by name or alias, case insensitive
+func (r *Registry) Lookup(name string) (*Command, bool) {
+	c, ok := r.byName[strings.ToLower(name)]
+	return c, ok
+}
+
+// Parse split line and find its command, the handler receives
+// the parsed line with the verb as 1st element
+func (r *Registry) Parse(line string) (*Command, []string, error) {
+	args, err := Split(line)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(args) == 0 {
+		return nil, nil, machine.Errorf("Empty command, type help for the list of commands")
+	}
+
+	c, ok := r.Lookup(args[0])
+	if !ok {
+		return nil, nil, machine.Errorf("Invalid command %s, type help for the list of commands", args[0])
+	}
+	return c, args, nil
+}
+
+// Help list every command generated from its metadata
+func (r *Registry) Help() string {
+	lines := []string{}
+	width := 0
+	for _, c := range r.commands {
+		if n := len(c.synopsis()); n > width {
+			width = n
+		}
+	}
+	for _, c := range r.commands {
+		line := fmt.Sprintf("%-*s  %s", width, c.synopsis(), c.Summary)
+		if len(c.Aliases) > 0 {
+			aliases := append([]string{}, c.Aliases...)
+			sort.Strings(aliases)
+			line += fmt.Sprintf(" (alias: %s)", strings.Join(aliases, ", "))
+		}
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func (c *Command) synopsis() string {
+	if c.Usage == "" {
+		return c.Name
+	}
+	return c.Name + " " + c.Usage
+}
+
+// Split break a command line into words separated by any whitespace.
+// Single or double quotes group words, ex: buy "Canned Coffee",
+// backslash escape the next character inside double quotes or outside quotes
+func Split(line string) ([]string, error) {
+	args := []string{}
+	word := strings.Builder{}
+	inWord := false
+	var quote rune
+
+	runes := []rune(line)
+	for i := 0; i < len(runes); i++ {
+		ch := runes[i]
+		switch {
+		case quote == '\'':
+			if ch == '\'' {
+				quote = 0
+				continue
+			}
+			word.WriteRune(ch)
+		case ch == '\\' && quote != '\'':
+			if i+1 >= len(runes) {
+				return nil, machine.Errorf("Unfinished escape at end of command")
+			}
+			i++
+			word.WriteRune(runes[i])
+			inWord = true
+		case quote == '"':
+			if ch == '"' {
+				quote = 0
+				continue
+			}
+			word.WriteRune(ch)
+		case ch == '"' || ch == '\'':
+			quote = ch
+			inWord = true
+		case ch == ' ' || ch == '\t' || ch == '\r' || ch == '\n':
+			if inWord {
+				args = append(args, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(ch)
+			inWord = true
+		}
+	}
+
+	if quote != 0 {
+		return nil, machine.Errorf("Missing closing quote %c", quote)
+	}
+	if inWord {
+		args = append(args, word.String())
+	}
+	return args, nil
+}
+
+// Execute parse line and run its handler on m
+func (r *Registry) Execute(m *machine.Machine, line string) (*Command, error) {
+	c, args, err := r.Parse(line)
+	if err != nil {
+		return nil, err
+	}
+	return c, c.Handler.Handle(m, args)
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/chapterzero/sai_vending/machine"
+)
+
+func TestSplit(t *testing.T) {
+	testCases := []struct {
+		name                 string
+		line                 string
+		expected             []string
+		expectedErrorMessage string
+	}{
+		{
+			name:     "Single spaces",
+			line:     "insert 100 10",
+			expected: []string{"insert", "100", "10"},
+		},
+		{
+			name:     "Repeated whitespace",
+			line:     "  insert \t100   10  ",
+			expected: []string{"insert", "100", "10"},
+		},
+		{
+			name:     "Double quotes",
+			line:     `buy "Canned Coffee"`,
+			expected: []string{"buy", "Canned Coffee"},
+		},
+		{
+			name:     "Single quotes keep backslash",
+			line:     `buy 'Sport \drinks'`,
+			expected: []string{"buy", `Sport \drinks`},
+		},
+		{
+			name:     "Escaped quote and empty argument",
+			line:     `say "a \"b\"" ""`,
+			expected: []string{"say", `a "b"`, ""},
+		},
+		{
+			name:     "Quotes inside a word",
+			line:     `buy Canned" "Coffee`,
+			expected: []string{"buy", "Canned Coffee"},
+		},
+		{
+			name:     "Empty line",
+			line:     "   ",
+			expected: []string{},
+		},
+		{
+			name:                 "Missing closing quote",
+			line:                 `buy "Canned Coffee`,
+			expectedErrorMessage: `Missing closing quote "`,
+		},
+		{
+			name:                 "Unfinished escape",
+			line:                 `buy \`,
+			expectedErrorMessage: "Unfinished escape at end of command",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := Split(tc.line)
+			if tc.expectedErrorMessage != "" {
+				if err == nil || err.Error() != tc.expectedErrorMessage {
+					t.Errorf("Expected error message '%s', got '%v'", tc.expectedErrorMessage, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Expected got nil error, got %s", err.Error())
+			}
+			if !reflect.DeepEqual(tc.expected, actual) {
+				t.Errorf("Expected %q, got %q", tc.expected, actual)
+			}
+		})
+	}
+}
+
+func TestRegistryLookup(t *testing.T) {
+	r := DefaultRegistry()
+	testCases := map[string]string{
+		"insert":      "insert",
+		"1":           "insert",
+		"PUSH":        "insert",
+		"2":           "buy",
+		"3":           "take-items",
+		"return":      "cancel",
+		"5":           "take-change",
+		"s":           "status",
+		"?":           "help",
+		"Take-Change": "take-change",
+	}
+
+	for name, expected := range testCases {
+		c, ok := r.Lookup(name)
+		if !ok || c.Name != expected {
+			t.Errorf("Expected %s resolve to %s, got %v", name, expected, c)
+		}
+	}
+	if _, ok := r.Lookup("6"); ok {
+		t.Errorf("Expected 6 not registered")
+	}
+}
+
+func TestRegistryRegisterTwice(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected panic on duplicated alias")
+		}
+	}()
+
+	r := DefaultRegistry()
+	r.Register(&Command{Name: "add", Aliases: []string{"1"}})
+}
+
+func TestRegistryParseError(t *testing.T) {
+	r := DefaultRegistry()
+	testCases := map[string]string{
+		"":            "Empty command, type help for the list of commands",
+		"dance":       "Invalid command dance, type help for the list of commands",
+		`insert "100`: `Missing closing quote "`,
+	}
+
+	for line, expected := range testCases {
+		_, _, err := r.Parse(line)
+		if err == nil || err.Error() != expected {
+			t.Errorf("Expected error message '%s', got '%v'", expected, err)
+		}
+	}
+}
+
+func TestRegistryHelp(t *testing.T) {
+	r := NewRegistry()
+	r.Register(&Command{Name: "insert", Aliases: []string{"push", "1"}, Usage: "<coin>...", Summary: "insert coins"})
+	r.Register(&Command{Name: "help", Summary: "show this help"})
+
+	expected := strings.Join([]string{
+		"insert <coin>...  insert coins (alias: 1, push)",
+		"help              show this help",
+	}, "\n")
+	if r.Help() != expected {
+		t.Errorf("Expected \n%s\ngot \n%s", expected, r.Help())
+	}
+}
+
+func TestRegistryExecute(t *testing.T) {
+	m := machine.New(map[machine.Currency]int{machine.C10: 10, machine.C100: 4}, []machine.Inventory{
+		machine.Inventory{Item: machine.Item{Name: "Item 1", Price: 120}, Stock: 9},
+	})
+	r := DefaultRegistry()
+
+	c, err := r.Execute(m, "insert 100  10 10")
+	if err != nil {
+		t.Errorf("Expected got nil error, got %s", err.Error())
+	}
+	if c.Name != "insert" || !c.Display {
+		t.Errorf("Expected insert command with display, got %+v", c)
+	}
+	if m.TotalInputRegister() != 120 {
+		t.Errorf("Expected input total 120, got %d", m.TotalInputRegister())
+	}
+
+	// invalid coin, nothing inserted
+	_, err = r.Execute(m, "1 10 30 10")
+	if err == nil || err.Error() != "30 is not a valid coin" {
+		t.Errorf("Expected error message '30 is not a valid coin', got '%v'", err)
+	}
+	if m.TotalInputRegister() != 120 {
+		t.Errorf("Expected input total 120, got %d", m.TotalInputRegister())
+	}
+
+	if _, err := r.Execute(m, "buy 1"); err != nil {
+		t.Errorf("Expected got nil error, got %s", err.Error())
+	}
+
+	c, err = r.Execute(m, "status")
+	if err != nil || c.Display {
+		t.Errorf("Expected status printing display by itself, got %+v %v", c, err)
+	}
+	if _, err := r.Execute(m, "status compact"); err != nil {
+		t.Errorf("Expected got nil error, got %s", err.Error())
+	}
+	if _, err := r.Execute(m, "status yaml"); err == nil || err.Error() != "yaml is not a display format, use text, tabs, json or compact" {
+		t.Errorf("Expected unknown display format error, got '%v'", err)
+	}
+	if _, err := r.Execute(m, "help"); err != nil {
+		t.Errorf("Expected got nil error, got %s", err.Error())
+	}
+}
+
+func TestInsertHandleRejectedCoinKeepsInserting(t *testing.T) {
+	m := machine.New(map[machine.Currency]int{}, []machine.Inventory{
+		machine.Inventory{Item: machine.Item{Name: "Item 1", Price: 30}, Stock: 9},
+	})
+	h := &InsertHandler{}
+
+	// 50 cannot be changed for a 30 item, 10 coins need no change.
+	// The rejection is reported and the command succeeds so the
+	// display shows the new input amount
+	if err := h.Handle(m, []string{"insert", "50", "10", "10"}); err != nil {
+		t.Errorf("Expected got nil error, got %s", err.Error())
+	}
+	if m.TotalInputRegister() != 20 {
+		t.Errorf("Expected input total 20, got %d", m.TotalInputRegister())
+	}
+	if gate := m.Snapshot().ReturnGate; len(gate) != 1 || gate[0] != machine.C50 {
+		t.Errorf("Expected 50 in the return gate, got %v", gate)
+	}
+
+	// the command fails when every coin is rejected
+	err := h.Handle(m, []string{"insert", "500", "500"})
+	if !errors.Is(err, machine.ErrCannotMakeChange) {
+		t.Errorf("Expected error %v, got %v", machine.ErrCannotMakeChange, err)
+	}
+}
@@ -1,44 +1,146 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 
 	"github.com/chapterzero/sai_vending/machine"
 )
 
+// ErrUsage is matched by UsageError
+var ErrUsage = errors.New("Invalid command usage")
+
+// ErrNothingBought is returned by ReceiptHandler before the first sale
+var ErrNothingBought = errors.New("Nothing bought yet")
+
+// UsageError is returned when a command misses its arguments
+type UsageError struct {
+	Command string
+	// Need describes the arguments, ex: "at least one coin"
+	Need string
+	// Example arguments after the command, ex: "50"
+	Example string
+}
+
+func (e *UsageError) Error() string {
+	return e.Localize(machine.English)
+}
+
+func (e *UsageError) Localize(l machine.Locale) string {
+	return l.Sprintf("%s need %s, example: %s %s", e.Command, l.Text(e.Need), e.Command, l.Text(e.Example))
+}
+
+func (e *UsageError) Is(target error) bool {
+	return target == ErrUsage
+}
+
 type Handler interface {
 	Handle(m *machine.Machine, cmd []string) error
 }
 
 type InsertHandler struct{}
 
+// Handle inserts every coin of cmd in order, nothing is inserted when
+// one of them is not valid. Rejected coins go to return gate while the
+// others are still inserted, rejections are reported and the command
+// only fails when every coin was rejected
 func (h *InsertHandler) Handle(m *machine.Machine, cmd []string) error {
 	if len(cmd) < 2 {
-		return fmt.Errorf("Command 1 (PUSH) need 2nd argument: coin, example: 1 50")
+		return &UsageError{Command: cmd[0], Need: "at least one coin", Example: "50"}
 	}
 
-	c, err := machine.NewCurrencyFromString(cmd[1])
-	if err != nil {
-		return err
+	coins := []machine.Currency{}
+	for _, v := range cmd[1:] {
+		c, err := m.Currency().Parse(v)
+		if err != nil {
+			return err
+		}
+		coins = append(coins, c)
 	}
 
-	return m.Insert(c)
+	var first error
+	rejected := []string{}
+	for _, c := range coins {
+		if err := m.Insert(c); err != nil {
+			if first == nil {
+				first = err
+			}
+			rejected = append(rejected, m.Locale().Sprintf("Returned %s, %s", m.Currency().Format(int(c)), m.Locale().Message(err)))
+		}
+	}
+	if len(rejected) == len(coins) {
+		return first
+	}
+	for _, v := range rejected {
+		fmt.Println(v)
+	}
+
+	return nil
 }
 
 type BuyHandler struct{}
 
+// Handle buy by slot code or item name, words after the verb
+// are joined so the name does not need quotes
 func (h *BuyHandler) Handle(m *machine.Machine, cmd []string) error {
 	if len(cmd) < 2 {
-		return fmt.Errorf("Command 2 (BUY) need 2nd argument: #item, example: 2 1 to buy first item")
+		return &UsageError{Command: cmd[0], Need: "slot or item name", Example: "1 to buy slot 1"}
+	}
+
+	slot, err := m.FindSlot(strings.Join(cmd[1:], " "))
+	if err != nil {
+		return err
+	}
+
+	return m.BuySlot(slot)
+}
+
+type AddToCartHandler struct{}
+
+// Handle add items to the cart, a number after the slot or name
+// is the quantity, ex: add canned coffee 2
+func (h *AddToCartHandler) Handle(m *machine.Machine, cmd []string) error {
+	if len(cmd) < 2 {
+		return &UsageError{Command: cmd[0], Need: "slot or item name", Example: "1 2 to add two of slot 1"}
+	}
+
+	slot, err := m.FindSlot(strings.Join(cmd[1:], " "))
+	if err == nil {
+		return m.AddToCart(slot, 1)
+	}
+	if len(cmd) > 2 {
+		if qty, convErr := strconv.Atoi(cmd[len(cmd)-1]); convErr == nil {
+			slot, err = m.FindSlot(strings.Join(cmd[1:len(cmd)-1], " "))
+			if err == nil {
+				return m.AddToCart(slot, qty)
+			}
+		}
+	}
+
+	return err
+}
+
+type RemoveFromCartHandler struct{}
+
+func (h *RemoveFromCartHandler) Handle(m *machine.Machine, cmd []string) error {
+	if len(cmd) < 2 {
+		return &UsageError{Command: cmd[0], Need: "slot or item name", Example: "1"}
 	}
 
-	idx, err := strconv.Atoi(cmd[1])
+	slot, err := m.FindSlot(strings.Join(cmd[1:], " "))
 	if err != nil {
 		return err
 	}
 
-	return m.Buy(idx - 1)
+	return m.RemoveFromCart(slot)
+}
+
+type CheckoutHandler struct{}
+
+func (h *CheckoutHandler) Handle(m *machine.Machine, cmd []string) error {
+	return m.Checkout()
 }
 
 type GetItemHandler struct{}
@@ -49,11 +151,11 @@ func (h *GetItemHandler) Handle(m *machine.Machine, cmd []string) error {
 		if i != 0 {
 			str = str + ", "
 		}
-		str += item.Name
+		str += item.LocalName(m.Locale())
 	}
 
 	if str != "" {
-		fmt.Println("GOT Items:", str)
+		fmt.Println(m.Locale().Sprintf("GOT Items: %s", str))
 	}
 
 	return nil
@@ -61,8 +163,10 @@ func (h *GetItemHandler) Handle(m *machine.Machine, cmd []string) error {
 
 type ReturnInputHandler struct{}
 
+// Handle return the money and empty the cart
 func (h *ReturnInputHandler) Handle(m *machine.Machine, cmd []string) error {
 	m.ReturnInput()
+	m.ClearCart()
 	return nil
 }
 
@@ -74,11 +178,55 @@ func (h *GetReturnHandler) Handle(m *machine.Machine, cmd []string) error {
 		if i != 0 {
 			str = str + ", "
 		}
-		str += c.Str()
+		str += m.Currency().Format(int(c))
 	}
 	if str != "" {
-		fmt.Println("GOT Changes:", str)
+		fmt.Println(m.Locale().Sprintf("GOT Changes: %s", str))
 	}
 
 	return nil
 }
+
+type ReceiptHandler struct{}
+
+func (h *ReceiptHandler) Handle(m *machine.Machine, cmd []string) error {
+	receipt := m.LastReceipt()
+	if receipt == nil {
+		return ErrNothingBought
+	}
+
+	fmt.Println(receipt.String())
+	return nil
+}
+
+// StatusHandler prints the machine with Renderer, a format given after
+// the command is used instead, ex: status json
+type StatusHandler struct {
+	// machine.TabRenderer when nil
+	Renderer machine.Renderer
+}
+
+func (h *StatusHandler) Handle(m *machine.Machine, cmd []string) error {
+	r := h.Renderer
+	if len(cmd) > 1 {
+		var err error
+		if r, err = machine.LookupRenderer(cmd[1]); err != nil {
+			return err
+		}
+	}
+	if r == nil {
+		r = machine.TabRenderer{}
+	}
+
+	fmt.Println(r.Render(m.Snapshot()))
+	return nil
+}
+
+type HelpHandler struct {
+	Registry *Registry
+}
+
+func (h *HelpHandler) Handle(m *machine.Machine, cmd []string) error {
+	fmt.Println(h.Registry.Help())
+	return nil
+}
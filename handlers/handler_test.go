@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"errors"
+	"strings"
 	"testing"
 
 	"github.com/chapterzero/sai_vending/machine"
@@ -8,24 +10,24 @@ import (
 
 func TestInsertHandle(t *testing.T) {
 	testCases := []struct {
-		name                 string
-		cmd                  []string
-		expectedErrorMessage string
+		name          string
+		cmd           []string
+		expectedError error
 	}{
 		{
-			name:                 "Missing required argument",
-			cmd:                  []string{"1"},
-			expectedErrorMessage: "Command 1 (PUSH) need 2nd argument: coin, example: 1 50",
+			name:          "Missing required argument",
+			cmd:           []string{"1"},
+			expectedError: ErrUsage,
 		},
 		{
-			name:                 "Invalid coin",
-			cmd:                  []string{"1", "30"},
-			expectedErrorMessage: "30 is not a valid coin",
+			name:          "Invalid coin",
+			cmd:           []string{"1", "30"},
+			expectedError: machine.ErrInvalidCoin,
 		},
 		{
-			name:                 "Successful",
-			cmd:                  []string{"1", "10"},
-			expectedErrorMessage: "",
+			name:          "Successful",
+			cmd:           []string{"1", "10"},
+			expectedError: nil,
 		},
 	}
 
@@ -34,39 +36,62 @@ func TestInsertHandle(t *testing.T) {
 			m := machine.New(map[machine.Currency]int{}, []machine.Inventory{})
 			h := &InsertHandler{}
 			err := h.Handle(m, tc.cmd)
-			if tc.expectedErrorMessage == "" {
+			if tc.expectedError == nil {
 				if err != nil {
 					t.Errorf("Expected got nil error, got %s", err.Error())
 				}
 			} else {
-				if err.Error() != tc.expectedErrorMessage {
-					t.Errorf("Expected error message %s, got %s", tc.expectedErrorMessage, err.Error())
+				if !errors.Is(err, tc.expectedError) {
+					t.Errorf("Expected error %v, got %v", tc.expectedError, err)
 				}
 			}
 		})
 	}
 }
 
+func TestInsertHandleCurrency(t *testing.T) {
+	m := machine.New(map[machine.Currency]int{}, []machine.Inventory{}, machine.WithCurrency(machine.EUR))
+	h := &InsertHandler{}
+
+	if err := h.Handle(m, []string{"1", "0.50"}); err != nil {
+		t.Errorf("Expected got nil error, got %s", err.Error())
+	}
+	if m.TotalInputRegister() != 50 {
+		t.Errorf("Expected input total 50, got %d", m.TotalInputRegister())
+	}
+
+	err := h.Handle(m, []string{"1", "500"})
+	coinErr := &machine.CoinError{}
+	if !errors.As(err, &coinErr) || coinErr.Value != "500" {
+		t.Errorf("Expected 500 to be an invalid coin, got '%v'", err)
+	}
+}
+
 func TestBuyHandle(t *testing.T) {
 	testCases := []struct {
-		name                 string
-		cmd                  []string
-		expectedErrorMessage string
+		name          string
+		cmd           []string
+		expectedError error
 	}{
 		{
-			name:                 "Missing required argument",
-			cmd:                  []string{"2"},
-			expectedErrorMessage: "Command 2 (BUY) need 2nd argument: #item, example: 2 1 to buy first item",
+			name:          "Missing required argument",
+			cmd:           []string{"2"},
+			expectedError: ErrUsage,
+		},
+		{
+			name:          "Unknown slot",
+			cmd:           []string{"2", "a"},
+			expectedError: machine.ErrInvalidSlot,
 		},
 		{
-			name:                 "Invalid item index",
-			cmd:                  []string{"2", "a"},
-			expectedErrorMessage: "strconv.Atoi: parsing \"a\": invalid syntax",
+			name:          "Successful",
+			cmd:           []string{"2", "1"},
+			expectedError: nil,
 		},
 		{
-			name:                 "Successful",
-			cmd:                  []string{"2", "1"},
-			expectedErrorMessage: "",
+			name:          "Successful by name",
+			cmd:           []string{"buy", "item", "1"},
+			expectedError: nil,
 		},
 	}
 
@@ -74,11 +99,11 @@ func TestBuyHandle(t *testing.T) {
 		t.Run(tc.name, func(t *testing.T) {
 			m := machine.New(map[machine.Currency]int{}, []machine.Inventory{
 				machine.Inventory{
-					machine.Item{
+					Item: machine.Item{
 						Name:  "Item 1",
 						Price: 10,
 					},
-					99,
+					Stock: 99,
 				},
 			})
 
@@ -86,9 +111,9 @@ func TestBuyHandle(t *testing.T) {
 
 			h := &BuyHandler{}
 			err := h.Handle(m, tc.cmd)
-			if tc.expectedErrorMessage != "" {
-				if err.Error() != tc.expectedErrorMessage {
-					t.Errorf("Expected error message '%s', got '%s'", tc.expectedErrorMessage, err.Error())
+			if tc.expectedError != nil {
+				if !errors.Is(err, tc.expectedError) {
+					t.Errorf("Expected error %v, got %v", tc.expectedError, err)
 				}
 			} else {
 				if err != nil {
@@ -102,11 +127,11 @@ func TestBuyHandle(t *testing.T) {
 func TestGetItemHandler(t *testing.T) {
 	m := machine.New(map[machine.Currency]int{machine.C10: 9, machine.C100: 4}, []machine.Inventory{
 		machine.Inventory{
-			machine.Item{
+			Item: machine.Item{
 				Name:  "Item 1",
 				Price: 10,
 			},
-			99,
+			Stock: 99,
 		},
 	})
 
@@ -125,11 +150,11 @@ func TestGetItemHandler(t *testing.T) {
 func TestReturnInputHandler(t *testing.T) {
 	m := machine.New(map[machine.Currency]int{machine.C10: 9, machine.C100: 4}, []machine.Inventory{
 		machine.Inventory{
-			machine.Item{
+			Item: machine.Item{
 				Name:  "Item 1",
 				Price: 10,
 			},
-			99,
+			Stock: 99,
 		},
 	})
 
@@ -147,11 +172,11 @@ func TestReturnInputHandler(t *testing.T) {
 func TestGetReturnHandler(t *testing.T) {
 	m := machine.New(map[machine.Currency]int{machine.C10: 9, machine.C100: 4}, []machine.Inventory{
 		machine.Inventory{
-			machine.Item{
+			Item: machine.Item{
 				Name:  "Item 1",
 				Price: 10,
 			},
-			99,
+			Stock: 99,
 		},
 	})
 
@@ -165,3 +190,135 @@ func TestGetReturnHandler(t *testing.T) {
 		t.Errorf("Expected got nil error, got %s", err.Error())
 	}
 }
+
+func TestCartHandlers(t *testing.T) {
+	m := machine.New(map[machine.Currency]int{machine.C10: 9, machine.C100: 4}, []machine.Inventory{
+		machine.Inventory{Item: machine.Item{Name: "Item 1", Price: 120}, Stock: 9},
+		machine.Inventory{Item: machine.Item{Name: "Canned coffee", Price: 100}, Stock: 9},
+	})
+	r := DefaultRegistry()
+
+	testCases := []struct {
+		line          string
+		expectedError error
+	}{
+		{"add", ErrUsage},
+		{"add item 1", nil},
+		{"add canned coffee 2", nil},
+		{"cart 1 2", nil},
+		{"add tea 2", machine.ErrInvalidSlot},
+		{"add 2 20", machine.ErrSoldOut},
+		{"remove 1", nil},
+		{"remove item 1", machine.ErrNotInCart},
+		{"checkout", machine.ErrInsufficientFunds},
+		{"insert 100 100", nil},
+		{"pay", nil},
+		{"checkout", machine.ErrCartEmpty},
+	}
+	for _, tc := range testCases {
+		_, err := r.Execute(m, tc.line)
+		if tc.expectedError == nil {
+			if err != nil {
+				t.Errorf("%s: expected got nil error, got %s", tc.line, err.Error())
+			}
+			continue
+		}
+		if !errors.Is(err, tc.expectedError) {
+			t.Errorf("%s: expected error %v, got %v", tc.line, tc.expectedError, err)
+		}
+	}
+
+	if items := m.GetItems(); len(items) != 2 || items[0].Name != "Canned coffee" {
+		t.Errorf("Expected 2 canned coffee, got %v", items)
+	}
+
+	r.Execute(m, "add 1")
+	r.Execute(m, "cancel")
+	if len(m.Cart()) != 0 {
+		t.Errorf("Expected cart emptied on cancel, got %+v", m.Cart())
+	}
+}
+
+func TestReceiptHandler(t *testing.T) {
+	m := machine.New(map[machine.Currency]int{machine.C10: 9}, []machine.Inventory{
+		machine.Inventory{Item: machine.Item{Name: "Item 1", Price: 120}, Stock: 9},
+	})
+	r := DefaultRegistry()
+
+	if _, err := r.Execute(m, "receipt"); err != ErrNothingBought {
+		t.Errorf("Expected error %v, got %v", ErrNothingBought, err)
+	}
+	r.Execute(m, "insert 100 10 10")
+	r.Execute(m, "buy 1")
+	if _, err := r.Execute(m, "receipt"); err != nil {
+		t.Errorf("Expected got nil error, got %s", err.Error())
+	}
+}
+
+func TestUsageErrorLocalize(t *testing.T) {
+	err := &UsageError{Command: "buy", Need: "slot or item name", Example: "1 to buy slot 1"}
+	if err.Error() != "buy need slot or item name, example: buy 1 to buy slot 1" {
+		t.Errorf("Unexpected message %s", err.Error())
+	}
+	if msg := machine.Japanese.Message(err); msg != "buyには番号か商品名が必要です、例: buy 1 (番号1を購入)" {
+		t.Errorf("Unexpected japanese message %s", msg)
+	}
+}
+
+func TestJapaneseErrors(t *testing.T) {
+	m := machine.New(map[machine.Currency]int{machine.C10: 9}, []machine.Inventory{
+		machine.Inventory{Item: machine.Item{Name: "Item 1", Price: 120}, Stock: 9},
+	}, machine.WithLocale(machine.Japanese))
+	r := DefaultRegistry()
+	r.Register(ServiceCommand("1234", nil))
+
+	testCases := []struct {
+		line     string
+		expected string
+	}{
+		{"dance", "danceというコマンドはありません、help でコマンド一覧を表示します"},
+		{`insert "100`, `閉じる引用符"がありません`},
+		{`insert 100\`, "コマンドの最後のエスケープが終わっていません"},
+		{"add 1 0", "数量は1以上にしてください"},
+		{"service", "serviceにはサブコマンドが必要です、例: service help"},
+		{"service restock 1 1", "メンテナンスモードはロックされています、service login <暗証番号> を入力してください"},
+		{"service login", "loginには暗証番号が必要です、例: login 1234"},
+		{"service login 0000", "暗証番号が違います"},
+		{"service login 1234", ""},
+		{"service frobnicate", "frobnicateというサービスコマンドはありません、service help でコマンド一覧を表示します"},
+		{"service restock 1", "restockには番号と数量が必要です、例: restock A1 10"},
+		{"service restock 1 x", "数量xが正しくありません"},
+		{"service restock 1 0", "補充数は1以上にしてください"},
+		{"service add-item", `add-itemには番号、商品名、価格と在庫が必要です、例: add-item B1 "Green tea" 130 10 20`},
+		{"service price", "priceには番号と価格が必要です、例: price A1 130"},
+		{"service price 1 abc", "価格abcが正しくありません"},
+		{"service load", "loadには硬貨の枚数が必要です、例: load 100=20"},
+		{"service load 50", "枚数50が正しくありません、例: 100=20"},
+		{"insert 100", ""},
+		{"service withdraw all", "お客様の取引中です、お金を返却してから回収してください"},
+	}
+
+	for _, tc := range testCases {
+		_, err := r.Execute(m, tc.line)
+		if tc.expected == "" {
+			if err != nil {
+				t.Errorf("%s: expected got nil error, got %s", tc.line, err.Error())
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%s: expected error %s, got nil", tc.line, tc.expected)
+			continue
+		}
+		if msg := m.Locale().Message(err); msg != tc.expected {
+			t.Errorf("%s: expected %s, got %s", tc.line, tc.expected, msg)
+		}
+	}
+
+	report := ServiceReport(m)
+	for _, expected := range []string{"[商品棚]", "1. Item 1\t\t120 JPY\t\t在庫 9", "[現金]", "釣銭\t\t90 JPY", "回収済\t\t0 JPY"} {
+		if !strings.Contains(report, expected) {
+			t.Errorf("Expected %q in the report, got \n%s", expected, report)
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/chapterzero/sai_vending/machine"
+)
+
+// PaymentCommand returns a command buying an item with the inserted
+// coins, p pays what they do not cover, ex: card 1
+func PaymentCommand(name string, p machine.PaymentMethod) *Command {
+	return &Command{
+		Name:    name,
+		Usage:   "<slot|name>",
+		Summary: fmt.Sprintf("buy an item, %s pays what the inserted coins do not cover, ex: %s 1", p.Name(), name),
+		Handler: &PaymentHandler{Method: p},
+		Display: true,
+	}
+}
+
+type PaymentHandler struct {
+	Method machine.PaymentMethod
+}
+
+func (h *PaymentHandler) Handle(m *machine.Machine, cmd []string) error {
+	if len(cmd) < 2 {
+		return &UsageError{Command: cmd[0], Need: "slot or item name", Example: "1 to buy slot 1"}
+	}
+
+	slot, err := m.FindSlot(strings.Join(cmd[1:], " "))
+	if err != nil {
+		return err
+	}
+
+	return m.BuyMixed(slot, h.Method)
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/chapterzero/sai_vending/machine"
+)
+
+func TestPaymentHandler(t *testing.T) {
+	m := machine.New(map[machine.Currency]int{machine.C10: 9, machine.C100: 4}, []machine.Inventory{
+		machine.Inventory{Item: machine.Item{Name: "Item 1", Price: 120}, Stock: 2},
+	})
+	reader := machine.NewSimulatedReader("ic_card", machine.CardDecline, machine.CardApprove)
+	r := DefaultRegistry()
+	r.Register(PaymentCommand("card", reader))
+
+	testCases := []struct {
+		line          string
+		expectedError error
+	}{
+		{"card", ErrUsage},
+		{"card tea", machine.ErrInvalidSlot},
+		{"card item 1", machine.ErrPaymentDeclined},
+		{"card 1", nil},
+		{"insert 100", nil},
+		{"card 1", nil},
+		{"card 1", machine.ErrSoldOut},
+	}
+	for _, tc := range testCases {
+		_, err := r.Execute(m, tc.line)
+		if tc.expectedError == nil {
+			if err != nil {
+				t.Errorf("%s: expected got nil error, got %s", tc.line, err.Error())
+			}
+			continue
+		}
+		if !errors.Is(err, tc.expectedError) {
+			t.Errorf("%s: expected error %v, got %v", tc.line, tc.expectedError, err)
+		}
+	}
+
+	// 120 then 20 on top of the inserted 100
+	if reader.Charged() != 140 || m.TotalInputRegister() != 0 {
+		t.Errorf("Expected 140 charged and coins taken, got %d %d", reader.Charged(), m.TotalInputRegister())
+	}
+	if items := m.GetItems(); len(items) != 2 || items[0].Name != "Item 1" {
+		t.Errorf("Expected 2 item 1 dispensed, got %v", items)
+	}
+}
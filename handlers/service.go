@@ -0,0 +1,454 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chapterzero/sai_vending/machine"
+)
+
+// ServiceCommand returns the maintenance command protected by pin,
+// every sub command except login and help is refused until the operator
+// logged in. Every sub command is written to audit, see ServiceHandler.Audit
+func ServiceCommand(pin string, audit io.Writer) *Command {
+	h := NewServiceHandler(pin)
+	h.AuditTo(audit)
+
+	return &Command{
+		Name:    "service",
+		Aliases: []string{"svc"},
+		Usage:   "<sub command>",
+		Summary: "operator maintenance, ex: service login 1234, service help",
+		Handler: h,
+	}
+}
+
+// AuditEntry is a service sub command, refused and failed ones included
+type AuditEntry struct {
+	Time    time.Time `json:"time"`
+	Command string    `json:"command"`
+	// arguments of the sub command, the pin of login is never kept
+	Args []string `json:"args,omitempty"`
+	// error of a refused or failed sub command, empty on success
+	Error string `json:"error,omitempty"`
+}
+
+// ServiceHandler dispatch maintenance sub commands,
+// the login session lasts until logout
+type ServiceHandler struct {
+	pin      string
+	commands *Registry
+
+	// login session and audit trail of the sub commands,
+	// the trail is written to auditOut as JSON lines
+	mu       sync.Mutex
+	active   bool
+	audit    []AuditEntry
+	auditOut io.Writer
+	now      func() time.Time
+}
+
+func NewServiceHandler(pin string) *ServiceHandler {
+	h := &ServiceHandler{pin: pin, commands: NewRegistry(), now: time.Now}
+	h.commands.Register(&Command{
+		Name:    "login",
+		Usage:   "<pin>",
+		Summary: "enter maintenance mode",
+		Handler: &LoginHandler{Service: h},
+	})
+	h.commands.Register(&Command{
+		Name:    "logout",
+		Summary: "leave maintenance mode",
+		Handler: &LogoutHandler{Service: h},
+	})
+	h.commands.Register(&Command{
+		Name:    "restock",
+		Usage:   "<slot> <quantity>",
+		Summary: "add items to a slot, ex: restock A1 10",
+		Handler: &RestockHandler{},
+	})
+	h.commands.Register(&Command{
+		Name:    "add-item",
+		Usage:   "<slot> <name> <price> <stock> [capacity]",
+		Summary: "put a new item in the machine, price in the smallest unit, ex: add-item B1 \"Green tea\" 130 10 20",
+		Handler: &AddItemHandler{},
+	})
+	h.commands.Register(&Command{
+		Name:    "price",
+		Usage:   "<slot> <price>",
+		Summary: "change the price of a slot, in the smallest unit, ex: price A1 130",
+		Handler: &PriceHandler{},
+	})
+	h.commands.Register(&Command{
+		Name:    "load",
+		Usage:   "<coin>=<count>...",
+		Summary: "load coins into the drawer, ex: load 100=20 10=50",
+		Handler: &LoadCoinsHandler{},
+	})
+	h.commands.Register(&Command{
+		Name:    "withdraw",
+		Usage:   "all | <coin>=<float>...",
+		Summary: "take cash out leaving the float per coin, ex: withdraw 100=20 10=50, withdraw all empties the drawer",
+		Handler: &WithdrawHandler{},
+	})
+	h.commands.Register(&Command{
+		Name:    "collect",
+		Summary: "take cash out leaving the configured float",
+		Handler: &CollectHandler{},
+	})
+	h.commands.Register(&Command{
+		Name:    "top-up",
+		Summary: "load the coins missing to reach the configured float",
+		Handler: &TopUpHandler{},
+	})
+	h.commands.Register(&Command{
+		Name:    "report",
+		Summary: "print stock and cash of the machine",
+		Handler: &ReportHandler{},
+	})
+	h.commands.Register(&Command{
+		Name:    "help",
+		Summary: "show this help",
+		Handler: &HelpHandler{Registry: h.commands},
+	})
+
+	return h
+}
+
+// Active tells whether the operator is logged in
+func (h *ServiceHandler) Active() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.active
+}
+
+func (h *ServiceHandler) setActive(active bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.active = active
+}
+
+// AuditTo writes every audit entry to w as a JSON line,
+// entries are kept in memory without it
+func (h *ServiceHandler) AuditTo(w io.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.auditOut = w
+}
+
+// Audit returns the sub commands run so far, oldest first
+func (h *ServiceHandler) Audit() []AuditEntry {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return append([]AuditEntry{}, h.audit...)
+}
+
+func (h *ServiceHandler) Handle(m *machine.Machine, cmd []string) error {
+	if len(cmd) < 2 {
+		return &UsageError{Command: cmd[0], Need: "a sub command", Example: "help"}
+	}
+
+	err := h.handle(m, cmd)
+	if auditErr := h.record(cmd[1:], err); auditErr != nil && err == nil {
+		return machine.Errorf("Unable to write the audit trail: %w", auditErr)
+	}
+
+	return err
+}
+
+func (h *ServiceHandler) handle(m *machine.Machine, cmd []string) error {
+	c, ok := h.commands.Lookup(cmd[1])
+	if !ok {
+		return machine.Errorf("Invalid service command %s, type %s help for the list of commands", cmd[1], cmd[0])
+	}
+	if !h.Active() && c.Name != "login" && c.Name != "help" {
+		return machine.Errorf("Maintenance mode is locked, enter %s login <pin>", cmd[0])
+	}
+
+	return c.Handler.Handle(m, cmd[1:])
+}
+
+// record appends cmd and its result to the audit trail. Only the name
+// of login and of unknown commands is kept, a mistyped login would
+// otherwise write the pin in the trail
+func (h *ServiceHandler) record(cmd []string, err error) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	e := AuditEntry{Time: h.now(), Command: cmd[0]}
+	if c, ok := h.commands.Lookup(cmd[0]); ok && c.Name != "login" {
+		e.Args = append([]string{}, cmd[1:]...)
+	}
+	if err != nil {
+		e.Error = err.Error()
+	}
+	h.audit = append(h.audit, e)
+
+	if h.auditOut == nil {
+		return nil
+	}
+	line, jsonErr := json.Marshal(e)
+	if jsonErr != nil {
+		return jsonErr
+	}
+	_, writeErr := h.auditOut.Write(append(line, '\n'))
+	return writeErr
+}
+
+type LoginHandler struct {
+	Service *ServiceHandler
+}
+
+func (h *LoginHandler) Handle(m *machine.Machine, cmd []string) error {
+	if len(cmd) != 2 {
+		return &UsageError{Command: cmd[0], Need: "the operator pin", Example: "1234"}
+	}
+	if h.Service.pin == "" || subtle.ConstantTimeCompare([]byte(cmd[1]), []byte(h.Service.pin)) != 1 {
+		h.Service.setActive(false)
+		return machine.Errorf("Wrong operator pin")
+	}
+
+	h.Service.setActive(true)
+	fmt.Println(m.Locale().Text("Maintenance mode, type service help for the list of commands"))
+	return nil
+}
+
+type LogoutHandler struct {
+	Service *ServiceHandler
+}
+
+func (h *LogoutHandler) Handle(m *machine.Machine, cmd []string) error {
+	h.Service.setActive(false)
+	return nil
+}
+
+type RestockHandler struct{}
+
+func (h *RestockHandler) Handle(m *machine.Machine, cmd []string) error {
+	if len(cmd) != 3 {
+		return &UsageError{Command: cmd[0], Need: "slot and quantity", Example: "A1 10"}
+	}
+	qty, err := strconv.Atoi(cmd[2])
+	if err != nil {
+		return machine.Errorf("Invalid quantity %s", cmd[2])
+	}
+
+	return m.Restock(cmd[1], qty)
+}
+
+type AddItemHandler struct{}
+
+func (h *AddItemHandler) Handle(m *machine.Machine, cmd []string) error {
+	if len(cmd) != 5 && len(cmd) != 6 {
+		return &UsageError{Command: cmd[0], Need: "slot, name, price and stock", Example: `B1 "Green tea" 130 10 20`}
+	}
+
+	numbers := []int{}
+	for _, v := range cmd[3:] {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return machine.Errorf("Invalid number %s", v)
+		}
+		numbers = append(numbers, n)
+	}
+	inv := machine.Inventory{
+		Slot:  cmd[1],
+		Item:  machine.Item{Name: cmd[2], Price: numbers[0]},
+		Stock: numbers[1],
+	}
+	if len(numbers) == 3 {
+		inv.Capacity = numbers[2]
+	}
+
+	_, err := m.AddItem(inv)
+	return err
+}
+
+type PriceHandler struct{}
+
+func (h *PriceHandler) Handle(m *machine.Machine, cmd []string) error {
+	if len(cmd) != 3 {
+		return &UsageError{Command: cmd[0], Need: "slot and price", Example: "A1 130"}
+	}
+	price, err := strconv.Atoi(cmd[2])
+	if err != nil {
+		return machine.Errorf("Invalid price %s", cmd[2])
+	}
+
+	return m.SetPrice(cmd[1], price)
+}
+
+type LoadCoinsHandler struct{}
+
+func (h *LoadCoinsHandler) Handle(m *machine.Machine, cmd []string) error {
+	if len(cmd) < 2 {
+		return &UsageError{Command: cmd[0], Need: "at least one coin count", Example: "100=20"}
+	}
+	coins, err := parseCoinCounts(m, cmd[1:])
+	if err != nil {
+		return err
+	}
+
+	return m.LoadCoins(coins)
+}
+
+type WithdrawHandler struct{}
+
+// Handle withdraw down to the float given per coin, coins not given
+// keep their count. "all" is a float of zero and empties the drawer
+func (h *WithdrawHandler) Handle(m *machine.Machine, cmd []string) error {
+	if len(cmd) < 2 {
+		return &UsageError{Command: cmd[0], Need: "all or the float per coin", Example: "100=20 10=50"}
+	}
+
+	float := map[machine.Currency]int{}
+	if len(cmd) == 2 && cmd[1] == "all" {
+		for _, c := range m.Currency().Coins {
+			float[c] = 0
+		}
+	} else {
+		var err error
+		if float, err = parseCoinCounts(m, cmd[1:]); err != nil {
+			return err
+		}
+	}
+
+	coins, err := m.WithdrawToFloat(float)
+	if err != nil {
+		return err
+	}
+	printWithdrawn(m, coins)
+
+	return nil
+}
+
+type CollectHandler struct{}
+
+func (h *CollectHandler) Handle(m *machine.Machine, cmd []string) error {
+	coins, err := m.CollectCash()
+	if err != nil {
+		return err
+	}
+	printWithdrawn(m, coins)
+
+	return nil
+}
+
+type TopUpHandler struct{}
+
+func (h *TopUpHandler) Handle(m *machine.Machine, cmd []string) error {
+	loaded, err := m.TopUp()
+	if err != nil {
+		return err
+	}
+
+	currency := m.Currency()
+	str := ""
+	for i := len(currency.Coins) - 1; i >= 0; i-- {
+		if n := loaded[currency.Coins[i]]; n > 0 {
+			if str != "" {
+				str += ", "
+			}
+			str += fmt.Sprintf("%s x %d", currency.Format(int(currency.Coins[i])), n)
+		}
+	}
+	if str == "" {
+		str = m.Locale().Text("nothing, the drawer is at float level")
+	}
+	fmt.Println(m.Locale().Sprintf("Load %s", str))
+
+	return nil
+}
+
+func printWithdrawn(m *machine.Machine, coins []machine.Currency) {
+	ttl := 0
+	for _, c := range coins {
+		ttl += int(c)
+	}
+	fmt.Println(m.Locale().Sprintf("Withdrawn %d coins and notes, %s", len(coins), m.Currency().Format(ttl)))
+}
+
+type ReportHandler struct{}
+
+func (h *ReportHandler) Handle(m *machine.Machine, cmd []string) error {
+	fmt.Println(ServiceReport(m))
+	return nil
+}
+
+// ServiceReport list stock per slot and the cash in the machine,
+// in the machine locale
+func ServiceReport(m *machine.Machine) string {
+	l := m.Locale()
+	currency := m.Currency()
+	state := m.State()
+
+	lines := []string{l.Text("[Slots]")}
+	for _, v := range state.Inventories {
+		stock := strconv.Itoa(v.Stock)
+		if v.Capacity > 0 {
+			stock += "/" + strconv.Itoa(v.Capacity)
+		}
+		lines = append(lines, l.Sprintf("%s. %s\t\t%s\t\tstock %s", v.Slot, v.LocalName(l), currency.Format(v.Price), stock))
+	}
+
+	cash := m.CashReport()
+	lines = append(lines, l.Text("[Cash]"))
+	for _, v := range cash.Counts {
+		line := fmt.Sprintf("%s\t\tx %d", currency.Format(int(v.Currency)), v.Count)
+		if v.Capacity > 0 {
+			line += fmt.Sprintf("/%d", v.Capacity)
+		}
+		if v.CashBox > 0 {
+			line += l.Sprintf("\t\tcash box %d", v.CashBox)
+		}
+		if v.Float > 0 {
+			line += l.Sprintf("\t\tfloat %d", v.Float)
+		}
+		if v.Shortfall > 0 {
+			line += l.Sprintf(", %d short", v.Shortfall)
+		}
+		lines = append(lines, line)
+	}
+	lines = append(lines, l.Sprintf("Drawer\t\t%s", currency.Format(cash.Drawer)))
+	if cash.CashBox > 0 {
+		lines = append(lines, l.Sprintf("Cash box\t\t%s", currency.Format(cash.CashBox)))
+	}
+	if stacked, capacity := m.StackerLevel(); capacity > 0 {
+		lines = append(lines, l.Sprintf("Stacker\t\t%d/%d notes, %s", stacked, capacity, currency.Format(cash.Stacker)))
+	}
+	lines = append(lines, l.Sprintf("Collected\t\t%s", currency.Format(cash.Collected)))
+
+	return strings.Join(lines, "\n")
+}
+
+// parseCoinCounts read arguments written as <coin>=<count>
+func parseCoinCounts(m *machine.Machine, args []string) (map[machine.Currency]int, error) {
+	counts := make(map[machine.Currency]int)
+	for _, v := range args {
+		parts := strings.SplitN(v, "=", 2)
+		if len(parts) != 2 {
+			return nil, machine.Errorf("Invalid coin count %s, example: 100=20", v)
+		}
+		c, err := m.Currency().Parse(parts[0])
+		if err != nil {
+			return nil, err
+		}
+		n, err := strconv.Atoi(parts[1])
+		if err != nil || n < 0 {
+			return nil, machine.Errorf("Invalid coin count %s, example: 100=20", v)
+		}
+		counts[c] += n
+	}
+
+	return counts, nil
+}
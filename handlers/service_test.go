@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/chapterzero/sai_vending/machine"
+)
+
+func createServiceTestMachine() *machine.Machine {
+	return machine.New(map[machine.Currency]int{machine.C10: 20, machine.C100: 5}, []machine.Inventory{
+		machine.Inventory{Slot: "A1", Item: machine.Item{Name: "Canned coffee", Price: 120}, Stock: 2, Capacity: 10},
+	}, machine.WithNotes(10, machine.N1000), machine.WithFloat(map[machine.Currency]int{machine.C10: 30, machine.C100: 5}),
+		machine.WithTubes(map[machine.Currency]int{machine.C100: 10}))
+}
+
+func TestServiceLocked(t *testing.T) {
+	m := createServiceTestMachine()
+	r := DefaultRegistry()
+	r.Register(ServiceCommand("1234", nil))
+
+	testCases := []struct {
+		line                 string
+		expectedErrorMessage string
+	}{
+		{"service", "service need a sub command, example: service help"},
+		{"service restock A1 1", "Maintenance mode is locked, enter service login <pin>"},
+		{"svc login 0000", "Wrong operator pin"},
+		{"service login", "login need the operator pin, example: login 1234"},
+		{"service login 1234", ""},
+		{"service refill A1 1", "Invalid service command refill, type service help for the list of commands"},
+		{"service restock A1 1", ""},
+		{"service logout", ""},
+		{"service restock A1 1", "Maintenance mode is locked, enter service login <pin>"},
+	}
+
+	for _, tc := range testCases {
+		_, err := r.Execute(m, tc.line)
+		if tc.expectedErrorMessage == "" {
+			if err != nil {
+				t.Errorf("%s: expected got nil error, got %s", tc.line, err.Error())
+			}
+			continue
+		}
+		if err == nil || err.Error() != tc.expectedErrorMessage {
+			t.Errorf("%s: expected error message '%s', got '%v'", tc.line, tc.expectedErrorMessage, err)
+		}
+	}
+
+	if stock := m.State().Inventories[0].Stock; stock != 3 {
+		t.Errorf("Expected stock 3 after one restock, got %d", stock)
+	}
+}
+
+func TestServiceWithoutPin(t *testing.T) {
+	h := NewServiceHandler("")
+	m := createServiceTestMachine()
+
+	if err := h.Handle(m, []string{"service", "login", ""}); err == nil || h.Active() {
+		t.Errorf("Expected login refused without operator pin, got %v", err)
+	}
+}
+
+func TestServiceCommands(t *testing.T) {
+	m := createServiceTestMachine()
+	h := NewServiceHandler("1234")
+	if err := h.Handle(m, []string{"service", "login", "1234"}); err != nil || !h.Active() {
+		t.Errorf("Expected logged in, got %v", err)
+	}
+
+	testCases := []struct {
+		name                 string
+		cmd                  []string
+		expectedErrorMessage string
+	}{
+		{"Restock", []string{"restock", "A1", "3"}, ""},
+		{"Restock invalid quantity", []string{"restock", "A1", "x"}, "Invalid quantity x"},
+		{"Add item", []string{"add-item", "B1", "Green tea", "130", "4", "10"}, ""},
+		{"Add item missing stock", []string{"add-item", "B2", "Tea", "130"}, "add-item need slot, name, price and stock, example: add-item B1 \"Green tea\" 130 10 20"},
+		{"Price", []string{"price", "B1", "140"}, ""},
+		{"Price invalid", []string{"price", "B1", "1.40"}, "Invalid price 1.40"},
+		{"Load", []string{"load", "50=10", "10=5"}, ""},
+		{"Load invalid count", []string{"load", "50"}, "Invalid coin count 50, example: 100=20"},
+		{"Load invalid coin", []string{"load", "30=1"}, "30 is not a valid coin"},
+		{"Withdraw", []string{"withdraw", "10=20", "50=5", "100=5"}, ""},
+		{"Top up", []string{"top-up"}, ""},
+		{"Collect", []string{"collect"}, ""},
+		{"Withdraw to float", []string{"withdraw", "10=20", "50=5", "100=5"}, ""},
+		{"Withdraw without float", []string{"withdraw"}, "withdraw need all or the float per coin, example: withdraw 100=20 10=50"},
+		{"Report", []string{"report"}, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := h.Handle(m, append([]string{"service"}, tc.cmd...))
+			if tc.expectedErrorMessage == "" {
+				if err != nil {
+					t.Errorf("Expected got nil error, got %s", err.Error())
+				}
+			} else {
+				if err == nil || err.Error() != tc.expectedErrorMessage {
+					t.Errorf("Expected error message '%s', got '%v'", tc.expectedErrorMessage, err)
+				}
+			}
+		})
+	}
+
+	expected := strings.Join([]string{
+		"[Slots]",
+		"A1. Canned coffee\t\t120 JPY\t\tstock 5/10",
+		"B1. Green tea\t\t140 JPY\t\tstock 4/10",
+		"[Cash]",
+		"500 JPY\t\tx 0",
+		"100 JPY\t\tx 5/10\t\tfloat 5",
+		"50 JPY\t\tx 0",
+		"10 JPY\t\tx 20\t\tfloat 30, 10 short",
+		"1000 JPY\t\tx 0",
+		"Drawer\t\t700 JPY",
+		"Stacker\t\t0/10 notes, 0 JPY",
+		"Collected\t\t650 JPY",
+	}, "\n")
+	if report := ServiceReport(m); report != expected {
+		t.Errorf("Expected \n%s\ngot \n%s", expected, report)
+	}
+}
+
+func TestServiceWithdrawAll(t *testing.T) {
+	m := createServiceTestMachine()
+	h := NewServiceHandler("1234")
+	h.Handle(m, []string{"service", "login", "1234"})
+
+	if err := h.Handle(m, []string{"service", "withdraw"}); err == nil {
+		t.Errorf("Expected withdraw without float refused")
+	}
+	if drawer := m.CashReport().Drawer; drawer != 700 {
+		t.Errorf("Expected drawer kept at 700 JPY, got %d", drawer)
+	}
+
+	if err := h.Handle(m, []string{"service", "withdraw", "all"}); err != nil {
+		t.Errorf("Expected got nil error, got %s", err.Error())
+	}
+	if drawer := m.CashReport().Drawer; drawer != 0 {
+		t.Errorf("Expected empty drawer, got %d", drawer)
+	}
+}
+
+func TestServiceWithdrawOneCoin(t *testing.T) {
+	m := createServiceTestMachine()
+	h := NewServiceHandler("1234")
+	h.Handle(m, []string{"service", "login", "1234"})
+
+	if err := h.Handle(m, []string{"service", "withdraw", "100=2"}); err != nil {
+		t.Errorf("Expected got nil error, got %s", err.Error())
+	}
+	expected := map[machine.Currency]int{machine.C10: 20, machine.C100: 2}
+	if actual := m.State().MainRegister; !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected only 100 JPY withdrawn to %v, got %v", expected, actual)
+	}
+}
+
+func TestServiceAudit(t *testing.T) {
+	m := createServiceTestMachine()
+	out := &bytes.Buffer{}
+	r := DefaultRegistry()
+	r.Register(ServiceCommand("1234", out))
+
+	for _, line := range []string{
+		"service restock A1 1",
+		"service login 0000",
+		"service lgoin 4321",
+		"service login 1234",
+		"service restock A1 1",
+		"service logout",
+	} {
+		r.Execute(m, line)
+	}
+
+	c, _ := r.Lookup("service")
+	audit := c.Handler.(*ServiceHandler).Audit()
+	expected := []AuditEntry{
+		{Command: "restock", Args: []string{"A1", "1"}, Error: "Maintenance mode is locked, enter service login <pin>"},
+		{Command: "login", Error: "Wrong operator pin"},
+		{Command: "lgoin", Error: "Invalid service command lgoin, type service help for the list of commands"},
+		{Command: "login"},
+		{Command: "restock", Args: []string{"A1", "1"}},
+		{Command: "logout", Args: []string{}},
+	}
+	if len(audit) != len(expected) {
+		t.Errorf("Expected %d audit entries, got %+v", len(expected), audit)
+		return
+	}
+	for i, v := range audit {
+		if v.Time.IsZero() {
+			t.Errorf("Expected time of audit entry %d", i)
+		}
+		v.Time = expected[i].Time
+		if !reflect.DeepEqual(expected[i], v) {
+			t.Errorf("Expected audit entry %+v, got %+v", expected[i], v)
+		}
+	}
+
+	// one JSON line per entry, the pin is never written
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != len(expected) {
+		t.Errorf("Expected %d audit lines, got %d", len(expected), len(lines))
+	}
+	for _, v := range lines {
+		e := AuditEntry{}
+		if err := json.Unmarshal([]byte(v), &e); err != nil {
+			t.Errorf("Expected a JSON line, got %s", v)
+		}
+	}
+	if strings.Contains(out.String(), "1234") || strings.Contains(out.String(), "0000") || strings.Contains(out.String(), "4321") {
+		t.Errorf("Expected no pin in the audit trail, got %s", out.String())
+	}
+}
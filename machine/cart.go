@@ -0,0 +1,194 @@
+package machine
+
+import "errors"
+
+// ErrCartEmpty is returned by Checkout when nothing was added
+var ErrCartEmpty = errors.New("Cart is empty")
+
+// ErrNotInCart is matched by RemoveFromCart errors
+var ErrNotInCart = errors.New("not in the cart")
+
+// CartLine is a quantity of the item in one slot,
+// Amount is their price after pricing rules and bundles
+type CartLine struct {
+	Slot     string `json:"slot"`
+	Item     Item   `json:"item"`
+	Quantity int    `json:"quantity"`
+	Amount   int    `json:"amount,omitempty"`
+}
+
+// AddToCart select qty more items of slot, nothing is paid
+// until Checkout. The cart only lives in memory, it is not part
+// of the saved state
+func (m *Machine) AddToCart(slot string, qty int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.slotIndex(slot)
+	if i < 0 {
+		return m.slotError(slot)
+	}
+	if qty <= 0 {
+		return Errorf("Quantity must be positive")
+	}
+
+	v := m.inventories[i]
+	n := m.cartIndex(v.Slot)
+	selected := 0
+	if n >= 0 {
+		selected = m.cart[n].Quantity
+	}
+	if selected+qty > v.Stock {
+		return &StockError{Slot: v.Slot, Item: v.Item, Stock: v.Stock, Quantity: selected + qty}
+	}
+
+	if n < 0 {
+		m.cart = append(m.cart, CartLine{Slot: v.Slot, Quantity: qty})
+		return nil
+	}
+	m.cart[n].Quantity += qty
+
+	return nil
+}
+
+// RemoveFromCart drop slot from the cart
+func (m *Machine) RemoveFromCart(slot string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := -1
+	if i := m.slotIndex(slot); i >= 0 {
+		n = m.cartIndex(m.inventories[i].Slot)
+	}
+	if n < 0 {
+		return Errorf("Slot %s is %w", slot, ErrNotInCart)
+	}
+	m.cart = append(m.cart[:n:n], m.cart[n+1:]...)
+
+	return nil
+}
+
+// ClearCart empty the cart
+func (m *Machine) ClearCart() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.cart = nil
+}
+
+// Cart returns the selected items at their current price
+func (m *Machine) Cart() []CartLine {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.cartLines()
+}
+
+// CartTotal returns the price of every item in the cart
+func (m *Machine) CartTotal() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.cartTotal(m.cartLines())
+}
+
+// Checkout buy every item of the cart with a single settlement,
+// either every item is dispensed or nothing changes. The change
+// goes back to input register like Buy
+func (m *Machine) Checkout() error {
+	_, err := m.CheckoutReceipt()
+	return err
+}
+
+// CheckoutReceipt is Checkout returning the receipt of the sale, see BuyReceipt
+func (m *Machine) CheckoutReceipt() (*Receipt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	err := m.transact(func() error {
+		return m.checkout()
+	})
+	if err == nil {
+		m.cart = nil
+	}
+
+	return m.sold(err)
+}
+
+func (m *Machine) checkout() error {
+	lines := m.cartLines()
+	if len(lines) == 0 {
+		return ErrCartEmpty
+	}
+	for _, v := range lines {
+		if i := m.slotIndex(v.Slot); m.inventories[i].Stock < v.Quantity {
+			return &StockError{Slot: v.Slot, Item: v.Item, Stock: m.inventories[i].Stock, Quantity: v.Quantity}
+		}
+	}
+
+	total := m.cartTotal(lines)
+	if input := m.totalInput(); input < total {
+		return &FundsError{Price: total, Inserted: input, cart: true, currency: m.Currency()}
+	}
+
+	// settle the whole cart on a copy, like buy
+	r := m.createRegisterCopy()
+	if err := settle(&r, total); err != nil {
+		return err
+	}
+
+	m.mainRegister, m.cashBox, m.stacker, m.inputRegister = r.main, r.cashBox, r.stacker, r.input
+	receipt := []ReceiptLine{}
+	for _, v := range lines {
+		i := m.slotIndex(v.Slot)
+		receipt = append(receipt, m.receiptLine(i, v.Quantity))
+		m.inventories[i].Stock -= v.Quantity
+		for q := 0; q < v.Quantity; q++ {
+			m.outlet = append(m.outlet, v.Item)
+			m.emit(ItemDispensed{Slot: v.Slot, Item: v.Item})
+		}
+	}
+
+	m.record(JournalEntry{Type: EntryCartSale, Lines: lines, Amount: total, Coins: r.taken, Overflow: r.overflow})
+	if len(r.change) > 0 {
+		m.record(JournalEntry{Type: EntryChangeIssued, Coins: r.change})
+		m.emit(ChangeIssued{Coins: r.change})
+	}
+	m.issueReceipt(receipt, []Tender{Tender{Method: Coins.Name(), Amount: sumCoins(r.taken)}}, r.change)
+
+	return nil
+}
+
+// cartLines resolve the items of the cart, lines of removed slots are skipped
+func (m *Machine) cartLines() []CartLine {
+	lines := []CartLine{}
+	for _, v := range m.cart {
+		i := m.slotIndex(v.Slot)
+		if i < 0 {
+			continue
+		}
+		lines = append(lines, CartLine{Slot: v.Slot, Item: m.inventories[i].Item, Quantity: v.Quantity, Amount: m.linePrice(i, v.Quantity)})
+	}
+
+	return lines
+}
+
+func (m *Machine) cartTotal(lines []CartLine) int {
+	total := 0
+	for _, v := range lines {
+		total += v.Amount
+	}
+
+	return total
+}
+
+// cartIndex returns the position of slot code in the cart, -1 when not found
+func (m *Machine) cartIndex(slot string) int {
+	for n, v := range m.cart {
+		if v.Slot == slot {
+			return n
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,196 @@
+package machine
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func createCartTestMachine(opts ...Option) *Machine {
+	return New(map[Currency]int{C10: 10, C50: 1, C100: 3}, []Inventory{
+		Inventory{Slot: "A1", Item: Item{Name: "Canned coffee", Price: 120}, Stock: 5},
+		Inventory{Slot: "A2", Item: Item{Name: "Water PET bottle", Price: 100}, Stock: 1},
+		Inventory{Slot: "A3", Item: Item{Name: "Sport drinks XT", Price: 150}, Stock: 2},
+	}, opts...)
+}
+
+func TestAddToCart(t *testing.T) {
+	m := createCartTestMachine()
+
+	testCases := []struct {
+		name          string
+		slot          string
+		qty           int
+		expectedError string
+	}{
+		{"Add", "A1", 2, ""},
+		{"Add more of same slot", "a1", 1, ""},
+		{"Add other slot", "A3", 2, ""},
+		{"More than stock", "A1", 3, "Only 5 Canned coffee left"},
+		{"Not positive", "A2", 0, "Quantity must be positive"},
+		{"Invalid slot", "B1", 1, "Invalid slot B1"},
+	}
+	for _, tc := range testCases {
+		err := m.AddToCart(tc.slot, tc.qty)
+		if tc.expectedError == "" && err != nil {
+			t.Errorf("%s: expected error nil, got %v", tc.name, err)
+		}
+		if tc.expectedError != "" && (err == nil || err.Error() != tc.expectedError) {
+			t.Errorf("%s: expected error '%s', got '%v'", tc.name, tc.expectedError, err)
+		}
+	}
+
+	expected := []CartLine{
+		CartLine{Slot: "A1", Item: Item{Name: "Canned coffee", Price: 120}, Quantity: 3, Amount: 360},
+		CartLine{Slot: "A3", Item: Item{Name: "Sport drinks XT", Price: 150}, Quantity: 2, Amount: 300},
+	}
+	if !reflect.DeepEqual(expected, m.Cart()) {
+		t.Errorf("Expected %+v, got %+v", expected, m.Cart())
+	}
+	if m.CartTotal() != 660 {
+		t.Errorf("Expected cart total 660, got %d", m.CartTotal())
+	}
+
+	if err := m.RemoveFromCart("A1"); err != nil {
+		t.Errorf("Expected error nil, got %v", err)
+	}
+	if err := m.RemoveFromCart("A2"); err == nil || err.Error() != "Slot A2 is not in the cart" {
+		t.Errorf("Expected error 'Slot A2 is not in the cart', got '%v'", err)
+	}
+	if m.CartTotal() != 300 {
+		t.Errorf("Expected cart total 300, got %d", m.CartTotal())
+	}
+	m.ClearCart()
+	if len(m.Cart()) != 0 {
+		t.Errorf("Expected empty cart, got %+v", m.Cart())
+	}
+}
+
+func TestCheckout(t *testing.T) {
+	j := &MemoryJournal{}
+	m := createCartTestMachine(WithJournal(j))
+	m.AddToCart("A1", 2)
+	m.AddToCart("A2", 1)
+	m.Insert(C500)
+
+	// 500 for 340, 160 change: 100 + 50 + 10
+	if err := m.Checkout(); err != nil {
+		t.Errorf("Expected error nil, got %v", err)
+	}
+	expectedItems := []Item{
+		Item{Name: "Canned coffee", Price: 120},
+		Item{Name: "Canned coffee", Price: 120},
+		Item{Name: "Water PET bottle", Price: 100},
+	}
+	if !reflect.DeepEqual(expectedItems, m.outlet) {
+		t.Errorf("Expected %v, got %v", expectedItems, m.outlet)
+	}
+	if !reflect.DeepEqual([]Currency{C10, C50, C100}, m.inputRegister) {
+		t.Errorf("Expected change in input register, got %v", m.inputRegister)
+	}
+	if m.inventories[0].Stock != 3 || m.inventories[1].Stock != 0 || len(m.Cart()) != 0 {
+		t.Errorf("Expected stock deducted and cart emptied, got %+v %+v", m.inventories, m.Cart())
+	}
+
+	replayed, err := Replay(j.Entries())
+	if err != nil {
+		t.Errorf("Expected error nil, got %v", err)
+		return
+	}
+	if !reflect.DeepEqual(m.State(), replayed.State()) {
+		t.Errorf("Expected %+v, got %+v", m.State(), replayed.State())
+	}
+}
+
+func TestCheckoutAtomic(t *testing.T) {
+	testCases := []struct {
+		name          string
+		prepare       func(m *Machine)
+		expectedError string
+	}{
+		{
+			name:          "Empty cart",
+			prepare:       func(m *Machine) { m.Insert(C500) },
+			expectedError: "Cart is empty",
+		},
+		{
+			name: "Not enough money",
+			prepare: func(m *Machine) {
+				m.AddToCart("A1", 2)
+				m.AddToCart("A3", 1)
+				m.Insert(C100)
+				m.Insert(C100)
+			},
+			expectedError: "Inserted money not enough, cart total is 390 JPY",
+		},
+		{
+			name: "Sold out after selection",
+			prepare: func(m *Machine) {
+				m.AddToCart("A3", 2)
+				m.AddToCart("A2", 1)
+				m.Insert(C500)
+				m.BuySlot("A3")
+			},
+			expectedError: "Only 1 Sport drinks XT left",
+		},
+		{
+			name: "Cannot make change",
+			prepare: func(m *Machine) {
+				m.Insert(C500)
+				m.AddToCart("A1", 1)
+				// 380 change left with 100 coins only
+				m.mainRegister = map[Currency]int{C100: 3}
+			},
+			expectedError: "Unable to return change",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := createCartTestMachine()
+			tc.prepare(m)
+			before := m.State()
+			cart := m.Cart()
+
+			err := m.Checkout()
+			if err == nil || err.Error() != tc.expectedError {
+				t.Errorf("Expected error '%s', got '%v'", tc.expectedError, err)
+			}
+			if !reflect.DeepEqual(before, m.State()) {
+				t.Errorf("Expected nothing changed, got %+v", m.State())
+			}
+			if !reflect.DeepEqual(cart, m.Cart()) {
+				t.Errorf("Expected cart kept, got %+v", m.Cart())
+			}
+		})
+	}
+}
+
+func TestDisplayCart(t *testing.T) {
+	m := createCartTestMachine()
+	m.AddToCart("A1", 2)
+	m.AddToCart("A3", 1)
+	m.Insert(C100)
+
+	expected := `
+[Input amount]			100 JPY
+[Change]				500 JPY			Change
+						100 JPY			Change
+						50 JPY			Change
+						10 JPY			Change
+[Return gate]			Empty
+[Items for sale]
+A1. Canned coffee		120 JPY
+A2. Water PET bottle		100 JPY			Available for purchase
+A3. Sport drinks XT		150 JPY
+[Cart]					2 x Canned coffee		240 JPY
+						1 x Sport drinks XT		150 JPY
+[Cart total]			390 JPY
+[Outlet]				Empty
+`
+	expected = strings.TrimSpace(expected)
+
+	if expected != m.Display() {
+		t.Errorf("Expected \n%s\ngot \n%s", expected, m.Display())
+	}
+}
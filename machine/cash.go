@@ -0,0 +1,210 @@
+package machine
+
+// WithFloat set the number of coins per denomination left in main
+// register by CollectCash and restored by TopUp. A coin missing
+// in float is collected entirely
+func WithFloat(float map[Currency]int) Option {
+	return func(m *Machine) {
+		m.float = copyRegister(float)
+	}
+}
+
+// Float returns a copy of the float levels given by WithFloat
+func (m *Machine) Float() map[Currency]int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return copyRegister(m.float)
+}
+
+// CollectCash take coins above the float level out of main register,
+// every coin out of the cash box and every note out of the stacker,
+// see WithdrawToFloat
+func (m *Machine) CollectCash() ([]Currency, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.withdrawToFloat(m.float)
+}
+
+// WithdrawToFloat take coins out of main register until each denomination
+// of float is down to its level, a denomination missing in float keeps its
+// coins. The cash box and the stacker are always emptied. It is refused
+// while a customer has money in the input register since their change
+// could not be guaranteed anymore
+func (m *Machine) WithdrawToFloat(float map[Currency]int) ([]Currency, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	levels := copyRegister(m.mainRegister)
+	for c, n := range float {
+		levels[c] = n
+	}
+	return m.withdrawToFloat(levels)
+}
+
+// withdrawToFloat empties the denominations missing in float
+func (m *Machine) withdrawToFloat(float map[Currency]int) ([]Currency, error) {
+	if len(m.inputRegister) > 0 {
+		return nil, Errorf("Customer transaction in progress, withdraw after the money is returned")
+	}
+
+	fromTubes := make(map[Currency]int)
+	for c, n := range m.mainRegister {
+		if n > float[c] {
+			fromTubes[c] = n - float[c]
+		}
+	}
+	withdrawn := copyRegister(fromTubes)
+	for c, n := range m.cashBox {
+		withdrawn[c] += n
+	}
+	for c, n := range m.stacker {
+		withdrawn[c] += n
+	}
+	coins := expandRegister(withdrawn)
+
+	err := m.transact(func() error {
+		for c, n := range fromTubes {
+			m.mainRegister[c] -= n
+		}
+		for c, n := range withdrawn {
+			m.collected[c] += n
+		}
+		m.cashBox = make(map[Currency]int)
+		m.stacker = make(map[Currency]int)
+		if len(coins) > 0 {
+			m.record(JournalEntry{Type: EntryCashWithdrawn, Coins: coins})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return coins, nil
+}
+
+// TopUp load the coins missing to bring every denomination of the
+// float back to its level, returns the coins loaded by count
+func (m *Machine) TopUp() (map[Currency]int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	shortfall := m.floatShortfall()
+	if len(shortfall) == 0 {
+		return shortfall, nil
+	}
+	err := m.transact(func() error {
+		m.loadCoins(shortfall)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return shortfall, nil
+}
+
+// floatShortfall returns the coins missing in main register
+// to reach the float level, by count. A float above the tube
+// capacity only fills the tube
+func (m *Machine) floatShortfall() map[Currency]int {
+	shortfall := make(map[Currency]int)
+	for c, n := range m.float {
+		if capacity := m.tubeCapacity[c]; capacity > 0 && n > capacity {
+			n = capacity
+		}
+		if m.mainRegister[c] < n {
+			shortfall[c] = n - m.mainRegister[c]
+		}
+	}
+
+	return shortfall
+}
+
+// CashCount is the money of one denomination in the machine
+type CashCount struct {
+	Currency Currency
+	// coins in the tube of main register or notes in the stacker
+	Count int
+	// tube capacity, 0 for notes and unlimited tubes
+	Capacity int
+	// coins in the cash box
+	CashBox int
+	// float level, 0 for notes and coins without float
+	Float int
+	// coins missing to reach the float level
+	Shortfall int
+	// coins or notes collected since the machine was provisioned
+	Collected int
+}
+
+// CashReport sums the money in the machine, amounts in minor units
+type CashReport struct {
+	// every coin then every accepted or stacked note, largest first
+	Counts []CashCount
+
+	// money in the tubes, available for change
+	Drawer  int
+	CashBox int
+	Stacker int
+	// Drawer, CashBox and Stacker, money in input register
+	// still belongs to the customer and is not counted
+	Total int
+
+	// amount collected since the machine was provisioned
+	Collected int
+}
+
+// CashReport count the money of every denomination
+func (m *Machine) CashReport() *CashReport {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	currency := m.Currency()
+	shortfall := m.floatShortfall()
+	report := &CashReport{}
+	add := func(c Currency, count int) {
+		report.Counts = append(report.Counts, CashCount{
+			Currency:  c,
+			Count:     count,
+			Capacity:  m.tubeCapacity[c],
+			CashBox:   m.cashBox[c],
+			Float:     m.float[c],
+			Shortfall: shortfall[c],
+			Collected: m.collected[c],
+		})
+		report.Collected += int(c) * m.collected[c]
+	}
+
+	for i := len(currency.Coins) - 1; i >= 0; i-- {
+		c := currency.Coins[i]
+		add(c, m.mainRegister[c])
+		report.Drawer += int(c) * m.mainRegister[c]
+		report.CashBox += int(c) * m.cashBox[c]
+	}
+	for i := len(currency.Notes) - 1; i >= 0; i-- {
+		c := currency.Notes[i]
+		if !m.acceptedNotes[c] && m.stacker[c] == 0 && m.collected[c] == 0 {
+			continue
+		}
+		add(c, m.stacker[c])
+		report.Stacker += int(c) * m.stacker[c]
+	}
+	report.Total = report.Drawer + report.CashBox + report.Stacker
+
+	return report
+}
+
+// expandRegister list every coin of register, largest first
+func expandRegister(register map[Currency]int) []Currency {
+	coins := []Currency{}
+	for _, c := range denominationsOf(register) {
+		for n := 0; n < register[c]; n++ {
+			coins = append(coins, c)
+		}
+	}
+
+	return coins
+}
@@ -0,0 +1,276 @@
+package machine
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func createCashTestMachine(opts ...Option) *Machine {
+	opts = append([]Option{
+		WithNotes(10, N1000),
+		WithFloat(map[Currency]int{C10: 10, C50: 2, C100: 4}),
+	}, opts...)
+
+	return New(map[Currency]int{C10: 30, C50: 1, C100: 9, C500: 3}, []Inventory{
+		Inventory{Slot: "A1", Item: Item{Name: "Canned coffee", Price: 120}, Stock: 10},
+		Inventory{Slot: "A2", Item: Item{Name: "Sport drinks XT", Price: 150}, Stock: 10},
+	}, opts...)
+}
+
+func TestCollectCash(t *testing.T) {
+	m := createCashTestMachine()
+	m.stacker[N1000] = 1
+
+	coins, err := m.CollectCash()
+	if err != nil {
+		t.Errorf("Expected error nil, got %v", err)
+	}
+	expected := []Currency{N1000, C500, C500, C500, C100, C100, C100, C100, C100}
+	for n := 0; n < 20; n++ {
+		expected = append(expected, C10)
+	}
+	if !reflect.DeepEqual(expected, coins) {
+		t.Errorf("Expected %v, got %v", expected, coins)
+	}
+	if !reflect.DeepEqual(map[Currency]int{C10: 10, C50: 1, C100: 4, C500: 0}, m.mainRegister) {
+		t.Errorf("Expected drawer down to float, got %v", m.mainRegister)
+	}
+
+	// nothing above the float anymore
+	coins, err = m.CollectCash()
+	if err != nil || len(coins) != 0 {
+		t.Errorf("Expected nothing collected twice, got %v %v", coins, err)
+	}
+}
+
+func TestChangeAfterCollection(t *testing.T) {
+	testCases := []struct {
+		name           string
+		coins          []Currency
+		slot           string
+		expectedChange []Currency
+	}{
+		{"500 for 120", []Currency{C500}, "A1", []Currency{C10, C10, C10, C50, C100, C100, C100}},
+		{"150 for 120", []Currency{C50, C100}, "A1", []Currency{C10, C10, C10}},
+		{"200 for 150", []Currency{C100, C100}, "A2", []Currency{C50}},
+		{"130 for 120", []Currency{C100, C10, C10, C10}, "A1", []Currency{C10}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := createCashTestMachine()
+			if _, err := m.CollectCash(); err != nil {
+				t.Errorf("Expected error nil, got %v", err)
+			}
+
+			for _, c := range tc.coins {
+				if err := m.Insert(c); err != nil {
+					t.Errorf("Expected %d accepted after collection, got %v", c, err)
+				}
+			}
+			if err := m.BuySlot(tc.slot); err != nil {
+				t.Errorf("Expected %s bought after collection, got %v", tc.slot, err)
+			}
+			m.ReturnInput()
+			change := m.GetReturn()
+			if tc.expectedChange != nil && !reflect.DeepEqual(tc.expectedChange, change) {
+				t.Errorf("Expected change %v, got %v", tc.expectedChange, change)
+			}
+		})
+	}
+}
+
+func TestCollectCashRefusedWithCredit(t *testing.T) {
+	m := createCashTestMachine()
+	m.Insert(C100)
+	if _, err := m.CollectCash(); err == nil || err.Error() != "Customer transaction in progress, withdraw after the money is returned" {
+		t.Errorf("Expected collection refused, got %v", err)
+	}
+}
+
+func TestTopUp(t *testing.T) {
+	m := createCashTestMachine()
+	m.mainRegister[C10] = 3
+
+	loaded, err := m.TopUp()
+	if err != nil {
+		t.Errorf("Expected error nil, got %v", err)
+	}
+	if !reflect.DeepEqual(map[Currency]int{C10: 7, C50: 1}, loaded) {
+		t.Errorf("Expected 7 x 10 and 1 x 50 loaded, got %v", loaded)
+	}
+	if m.mainRegister[C10] != 10 || m.mainRegister[C50] != 2 || m.mainRegister[C100] != 9 {
+		t.Errorf("Expected drawer up to float, got %v", m.mainRegister)
+	}
+
+	loaded, err = m.TopUp()
+	if err != nil || len(loaded) != 0 {
+		t.Errorf("Expected nothing loaded twice, got %v %v", loaded, err)
+	}
+}
+
+func TestCashReport(t *testing.T) {
+	j := &MemoryJournal{}
+	m := createCashTestMachine(WithJournal(j))
+	// 880 change: 500 + 3 x 100 + 50 + 3 x 10
+	m.Insert(N1000)
+	m.BuySlot("A1")
+	m.ReturnInput()
+	m.CollectCash()
+	m.Insert(C10)
+	m.BuySlot("A1")
+
+	// the customer credit is not counted, 5000 and 10000 notes are not accepted
+	expected := &CashReport{
+		Counts: []CashCount{
+			CashCount{Currency: C500, Count: 0, Collected: 2},
+			CashCount{Currency: C100, Count: 4, Float: 4, Collected: 2},
+			CashCount{Currency: C50, Count: 0, Float: 2, Shortfall: 2},
+			CashCount{Currency: C10, Count: 10, Float: 10, Collected: 17},
+			CashCount{Currency: N1000, Count: 0, Collected: 1},
+		},
+		Drawer:    500,
+		Total:     500,
+		Collected: 2370,
+	}
+	if report := m.CashReport(); !reflect.DeepEqual(expected, report) {
+		t.Errorf("Expected %+v, got %+v", expected, report)
+	}
+
+	// collected counts survive replay
+	replayed, err := Replay(j.Entries(), WithNotes(10, N1000))
+	if err != nil {
+		t.Errorf("Expected error nil, got %v", err)
+		return
+	}
+	if !reflect.DeepEqual(m.State(), replayed.State()) {
+		t.Errorf("Expected %+v, got %+v", m.State(), replayed.State())
+	}
+}
+
+func createTubeTestMachine(opts ...Option) *Machine {
+	opts = append([]Option{
+		WithTubes(map[Currency]int{C10: 12, C50: 2, C100: 3}),
+	}, opts...)
+
+	return New(map[Currency]int{C10: 10, C50: 2, C100: 2}, []Inventory{
+		Inventory{Slot: "A1", Item: Item{Name: "Canned coffee", Price: 120}, Stock: 10},
+		Inventory{Slot: "A2", Item: Item{Name: "Water PET bottle", Price: 100}, Stock: 10},
+	}, opts...)
+}
+
+func TestTubeOverflow(t *testing.T) {
+	j := &MemoryJournal{}
+	m := createTubeTestMachine(WithJournal(j))
+	for _, c := range []Currency{C100, C100, C10, C10, C10} {
+		if err := m.Insert(c); err != nil {
+			t.Errorf("Expected %d accepted, got %v", c, err)
+		}
+	}
+
+	// 1st 100 fills the 100 tube
+	if err := m.BuySlot("A2"); err != nil {
+		t.Errorf("Expected error nil, got %v", err)
+	}
+	if !reflect.DeepEqual(map[Currency]int{C10: 10, C50: 2, C100: 3}, m.mainRegister) || len(m.cashBox) != 0 {
+		t.Errorf("Expected 100 tube full, got %v %v", m.mainRegister, m.cashBox)
+	}
+
+	// 2nd 100 falls in the cash box, 10s fill the 10 tube
+	if err := m.BuySlot("A1"); err != nil {
+		t.Errorf("Expected error nil, got %v", err)
+	}
+	if !reflect.DeepEqual(map[Currency]int{C10: 12, C50: 2, C100: 3}, m.mainRegister) {
+		t.Errorf("Expected 10 tube full, got %v", m.mainRegister)
+	}
+	if !reflect.DeepEqual(map[Currency]int{C100: 1}, m.cashBox) {
+		t.Errorf("Expected 100 in cash box, got %v", m.cashBox)
+	}
+
+	entries := j.Entries()
+	if overflow := entries[len(entries)-1].Overflow; !reflect.DeepEqual([]Currency{C100}, overflow) {
+		t.Errorf("Expected overflow journaled, got %v", overflow)
+	}
+	replayed, err := Replay(entries, WithTubes(map[Currency]int{C10: 12, C50: 2, C100: 3}))
+	if err != nil {
+		t.Errorf("Expected error nil, got %v", err)
+		return
+	}
+	if !reflect.DeepEqual(m.State(), replayed.State()) {
+		t.Errorf("Expected %+v, got %+v", m.State(), replayed.State())
+	}
+}
+
+func TestChangeOnlyFromTubes(t *testing.T) {
+	m := createTubeTestMachine()
+	m.cashBox[C10] = 50
+	m.mainRegister[C10] = 1
+
+	// 150 for 120 needs 30 back, the tube only has one 10
+	m.Insert(C50)
+	if err := m.Insert(C100); err == nil || err.Error() != "Unable to return change for Canned coffee" {
+		t.Errorf("Expected 100 rejected with 10s in the cash box only, got %v", err)
+	}
+
+	m.LoadCoins(map[Currency]int{C10: 2})
+	if err := m.Insert(C100); err != nil {
+		t.Errorf("Expected 100 accepted after 10 tube loaded, got %v", err)
+	}
+	if err := m.BuySlot("A1"); err != nil {
+		t.Errorf("Expected error nil, got %v", err)
+	}
+	if m.mainRegister[C10] != 0 || m.cashBox[C10] != 50 {
+		t.Errorf("Expected change from the tube, got %v %v", m.mainRegister, m.cashBox)
+	}
+}
+
+func TestTubeLoadAndCollect(t *testing.T) {
+	m := createTubeTestMachine(WithFloat(map[Currency]int{C10: 20, C100: 2}))
+	if err := m.LoadCoins(map[Currency]int{C100: 2}); err == nil || err.Error() != "100 JPY tube holds at most 3 coins, 1 more fit" {
+		t.Errorf("Expected error '100 JPY tube holds at most 3 coins, 1 more fit', got '%v'", err)
+	}
+
+	// float above the tube capacity only fills the tube
+	loaded, err := m.TopUp()
+	if err != nil || !reflect.DeepEqual(map[Currency]int{C10: 2}, loaded) {
+		t.Errorf("Expected 2 x 10 loaded, got %v %v", loaded, err)
+	}
+
+	m.mainRegister[C100] = 3
+	m.cashBox[C100] = 4
+	coins, err := m.CollectCash()
+	if err != nil || !reflect.DeepEqual([]Currency{C100, C100, C100, C100, C100, C50, C50}, coins) {
+		t.Errorf("Expected cash box and tube excess collected, got %v %v", coins, err)
+	}
+	if len(m.cashBox) != 0 || m.mainRegister[C100] != 2 {
+		t.Errorf("Expected cash box emptied, got %v %v", m.cashBox, m.mainRegister)
+	}
+
+	report := m.CashReport()
+	if report.Counts[1] != (CashCount{Currency: C100, Count: 2, Capacity: 3, Float: 2, Collected: 5}) {
+		t.Errorf("Unexpected 100 count %+v", report.Counts[1])
+	}
+}
+
+func TestDisplayTubes(t *testing.T) {
+	m := createTubeTestMachine()
+
+	expected := `
+[Input amount]			0 JPY
+[Change]				500 JPY			Change
+						100 JPY			Change		Tube 2/3
+						50 JPY			Change		Tube 2/2
+						10 JPY			Change		Tube 10/12
+[Return gate]			Empty
+[Items for sale]
+A1. Canned coffee		120 JPY
+A2. Water PET bottle		100 JPY
+[Outlet]				Empty
+`
+	expected = strings.TrimSpace(expected)
+
+	if expected != m.Display() {
+		t.Errorf("Expected \n%s\ngot \n%s", expected, m.Display())
+	}
+}
@@ -0,0 +1,256 @@
+package machine
+
+import (
+	"sort"
+)
+
+// registers groups every money holder of the machine,
+// so a transaction can be simulated on a copy
+type registers struct {
+	main    map[Currency]int
+	cashBox map[Currency]int
+	stacker map[Currency]int
+	input   []Currency
+	isNote  func(Currency) bool
+	// coins a tube holds, unlimited when missing
+	capacity map[Currency]int
+
+	// filled by settle for the journal
+	taken    []Currency
+	change   []Currency
+	overflow []Currency
+}
+
+// settle takes money from input register until price is covered,
+// coins go to their tube in main register and notes to stacker,
+// then pays the change back to the front of input register
+func settle(r *registers, price int) error {
+	taken := 0
+	takenIdx := 0
+	for _, v := range r.input {
+		taken += int(v)
+		takenIdx++
+		r.deposit(v)
+		if taken >= price {
+			break
+		}
+	}
+
+	// deduct input, calculate change
+	r.taken = append([]Currency{}, r.input[:takenIdx]...)
+	rest := r.input[takenIdx:]
+
+	var err error
+	r.main, r.input, err = calculateChange(r.main, rest, taken, price)
+	r.change = r.input[:len(r.input)-len(rest)]
+
+	return err
+}
+
+// deposit route a taken coin to its tube, a full tube overflows
+// into the cash box which is never used for change
+func (r *registers) deposit(c Currency) {
+	switch {
+	case r.isNote(c):
+		r.stacker[c]++
+	case r.capacity[c] > 0 && r.main[c] >= r.capacity[c]:
+		r.cashBox[c]++
+		r.overflow = append(r.overflow, c)
+	default:
+		r.main[c]++
+	}
+}
+
+func calculateChange(mR map[Currency]int, iR []Currency, taken, itemPrice int) (map[Currency]int, []Currency, error) {
+	due := taken - itemPrice
+	coins, ok := makeChange(mR, due)
+	if !ok {
+		// drawer is left untouched so the caller never sees a half-paid result
+		return mR, iR, &ChangeError{Due: due, Shortfall: due - payable(mR, due)}
+	}
+
+	for _, c := range coins {
+		mR[c]--
+	}
+	// changes are returned to input register smallest coin first
+	iR = append(coins, iR...)
+
+	return mR, iR, nil
+}
+
+// makeChange returns the fewest coins from drawer adding up to amount,
+// sorted from the smallest coin. Every denomination in the drawer is used,
+// bounded by its count. ok is false when no combination exists.
+// drawer is never modified.
+func makeChange(drawer map[Currency]int, amount int) ([]Currency, bool) {
+	if amount == 0 {
+		return []Currency{}, true
+	}
+	if amount < 0 {
+		return nil, false
+	}
+
+	// split each denomination count into lots of 1, 2, 4, ... coins
+	// so the bounded problem becomes a 0/1 knapsack over the lots
+	type lot struct {
+		c Currency
+		n int
+	}
+	lots := []lot{}
+	for _, c := range denominationsOf(drawer) {
+		left := drawer[c]
+		for k := 1; left > 0; k *= 2 {
+			if k > left {
+				k = left
+			}
+			if int(c)*k <= amount {
+				lots = append(lots, lot{c, k})
+			}
+			left -= k
+		}
+	}
+
+	const unreachable = int(^uint(0) >> 1)
+	best := make([]int, amount+1)
+	for a := 1; a <= amount; a++ {
+		best[a] = unreachable
+	}
+	take := make([][]bool, len(lots))
+	for i, l := range lots {
+		take[i] = make([]bool, amount+1)
+		w := int(l.c) * l.n
+		for a := amount; a >= w; a-- {
+			if best[a-w] == unreachable {
+				continue
+			}
+			if best[a-w]+l.n < best[a] {
+				best[a] = best[a-w] + l.n
+				take[i][a] = true
+			}
+		}
+	}
+
+	if best[amount] == unreachable {
+		return nil, false
+	}
+
+	coins := make([]Currency, 0, best[amount])
+	for i, a := len(lots)-1, amount; i >= 0; i-- {
+		if !take[i][a] {
+			continue
+		}
+		for j := 0; j < lots[i].n; j++ {
+			coins = append(coins, lots[i].c)
+		}
+		a -= int(lots[i].c) * lots[i].n
+	}
+	sort.Slice(coins, func(i, j int) bool { return coins[i] < coins[j] })
+
+	return coins, true
+}
+
+// payable returns the largest amount up to limit
+// drawer can pay exactly, drawer is never modified
+func payable(drawer map[Currency]int, limit int) int {
+	if limit <= 0 {
+		return 0
+	}
+	reach := make([]bool, limit+1)
+	reach[0] = true
+	for _, c := range denominationsOf(drawer) {
+		// used[a] counts coins c spent to reach a in this round
+		used := make([]int, limit+1)
+		for a := int(c); a <= limit; a++ {
+			if !reach[a] && reach[a-int(c)] && used[a-int(c)] < drawer[c] {
+				reach[a] = true
+				used[a] = used[a-int(c)] + 1
+			}
+		}
+	}
+
+	for a := limit; a > 0; a-- {
+		if reach[a] {
+			return a
+		}
+	}
+	return 0
+}
+
+// denominationsOf returns denominations having at least one coin in drawer,
+// largest first
+func denominationsOf(drawer map[Currency]int) []Currency {
+	denominations := []Currency{}
+	for c, n := range drawer {
+		if n > 0 && c > 0 {
+			denominations = append(denominations, c)
+		}
+	}
+	sort.Slice(denominations, func(i, j int) bool { return denominations[i] > denominations[j] })
+
+	return denominations
+}
+
+// ChangeStatus tells whether the machine can give change to a customer
+// paying only with coins of one denomination
+type ChangeStatus struct {
+	Currency Currency
+	// ExactChangeOnly is true when paying some in stock item with
+	// this denomination leaves change the drawer cannot cover
+	ExactChangeOnly bool
+}
+
+// ChangeStatus derive change state per coin and accepted note from the
+// drawer content and item price list, largest denomination first
+func (m *Machine) ChangeStatus() []ChangeStatus {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.changeStatus()
+}
+
+func (m *Machine) changeStatus() []ChangeStatus {
+	denominations := m.denominations()
+	status := make([]ChangeStatus, 0, len(denominations))
+	for i := len(denominations) - 1; i >= 0; i-- {
+		status = append(status, ChangeStatus{
+			Currency:        denominations[i],
+			ExactChangeOnly: !m.canChangeFor(denominations[i]),
+		})
+	}
+
+	return status
+}
+
+// canChangeFor simulate paying every in stock item with the least number
+// of coin c, the coins are added to the drawer before change is computed
+func (m *Machine) canChangeFor(c Currency) bool {
+	for i, v := range m.inventories {
+		if v.Stock <= 0 {
+			continue
+		}
+
+		price := m.price(i)
+		n := (price + int(c) - 1) / int(c)
+		drawer := copyRegister(m.mainRegister)
+		if !m.Currency().IsNote(c) {
+			drawer[c] += n
+			if capacity := m.tubeCapacity[c]; capacity > 0 && drawer[c] > capacity {
+				drawer[c] = capacity
+			}
+		}
+		if _, ok := makeChange(drawer, n*int(c)-price); !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+func copyRegister(register map[Currency]int) map[Currency]int {
+	c := make(map[Currency]int, len(register))
+	for k, v := range register {
+		c[k] = v
+	}
+
+	return c
+}
@@ -0,0 +1,143 @@
+package machine
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMakeChange(t *testing.T) {
+	testCases := []struct {
+		name     string
+		drawer   map[Currency]int
+		amount   int
+		expected []Currency
+		ok       bool
+	}{
+		{
+			name:     "No change needed",
+			drawer:   map[Currency]int{},
+			amount:   0,
+			expected: []Currency{},
+			ok:       true,
+		},
+		{
+			name:     "Change with 50 coin",
+			drawer:   map[Currency]int{C50: 1},
+			amount:   50,
+			expected: []Currency{C50},
+			ok:       true,
+		},
+		{
+			name:     "Change with 500 coin",
+			drawer:   map[Currency]int{C500: 1, C100: 5},
+			amount:   500,
+			expected: []Currency{C500},
+			ok:       true,
+		},
+		{
+			name:     "Fewest coins prefer 50 over 10",
+			drawer:   map[Currency]int{C10: 20, C50: 2},
+			amount:   100,
+			expected: []Currency{C50, C50},
+			ok:       true,
+		},
+		{
+			name:     "Mixing every denomination",
+			drawer:   map[Currency]int{C10: 3, C50: 1, C100: 2, C500: 1},
+			amount:   780,
+			expected: []Currency{C10, C10, C10, C50, C100, C100, C500},
+			ok:       true,
+		},
+		{
+			name:     "Non greedy denomination set",
+			drawer:   map[Currency]int{Currency(50): 1, Currency(20): 3},
+			amount:   60,
+			expected: []Currency{Currency(20), Currency(20), Currency(20)},
+			ok:       true,
+		},
+		{
+			name:   "Remaining change but coins are empty",
+			drawer: map[Currency]int{C100: 1, C10: 2},
+			amount: 130,
+			ok:     false,
+		},
+		{
+			name:   "Empty drawer",
+			drawer: map[Currency]int{},
+			amount: 10,
+			ok:     false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			before := copyRegister(tc.drawer)
+			actual, ok := makeChange(tc.drawer, tc.amount)
+			if ok != tc.ok {
+				t.Errorf("Expected ok %v, got %v", tc.ok, ok)
+			}
+			if tc.ok && !reflect.DeepEqual(actual, tc.expected) {
+				t.Errorf("Expected coins %v, got %v", tc.expected, actual)
+			}
+			if !reflect.DeepEqual(before, tc.drawer) {
+				t.Errorf("Expected drawer untouched %v, got %v", before, tc.drawer)
+			}
+		})
+	}
+}
+
+func TestCalculateChange(t *testing.T) {
+	testCases := []struct {
+		name          string
+		mR            map[Currency]int
+		iR            []Currency
+		taken         int
+		itemPrice     int
+		expectedMR    map[Currency]int
+		expectedIR    []Currency
+		expectedError string
+	}{
+		{
+			name:       "Change prepended to input register",
+			mR:         map[Currency]int{C10: 5, C50: 1, C100: 1},
+			iR:         []Currency{C500},
+			taken:      200,
+			itemPrice:  120,
+			expectedMR: map[Currency]int{C10: 2, C50: 0, C100: 1},
+			expectedIR: []Currency{C10, C10, C10, C50, C500},
+		},
+		{
+			// previously the greedy loop took the 100 and both 10 coins
+			// before noticing it could not finish the change
+			name:          "Remaining change but coins are empty",
+			mR:            map[Currency]int{C100: 1, C10: 2},
+			iR:            []Currency{},
+			taken:         250,
+			itemPrice:     120,
+			expectedMR:    map[Currency]int{C100: 1, C10: 2},
+			expectedIR:    []Currency{},
+			expectedError: "Unable to return change",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			mR, iR, err := calculateChange(tc.mR, tc.iR, tc.taken, tc.itemPrice)
+			if tc.expectedError == "" {
+				if err != nil {
+					t.Errorf("Expected no error occured, got %s", err)
+				}
+			} else {
+				if err == nil || err.Error() != tc.expectedError {
+					t.Errorf("Expected error '%s', got '%v'", tc.expectedError, err)
+				}
+			}
+			if !reflect.DeepEqual(mR, tc.expectedMR) {
+				t.Errorf("Expected main register %v, got %v", tc.expectedMR, mR)
+			}
+			if !reflect.DeepEqual(iR, tc.expectedIR) {
+				t.Errorf("Expected input register %v, got %v", tc.expectedIR, iR)
+			}
+		})
+	}
+}
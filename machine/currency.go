@@ -2,12 +2,14 @@ package machine
 
 import (
 	"fmt"
+	"strconv"
+	"strings"
 )
 
+// Currency is a coin or note denomination, valued in minor units
+// of the machine CurrencyDef
 type Currency int
 
-const CUR_SYMBOL = "JPY"
-
 const (
 	C10  Currency = 10
 	C50  Currency = 50
@@ -15,21 +17,131 @@ const (
 	C500 Currency = 500
 )
 
+// bank notes, only taken by machine configured with WithNotes
+const (
+	N1000  Currency = 1000
+	N5000  Currency = 5000
+	N10000 Currency = 10000
+)
+
+// CurrencyDef describe the money a machine is working with
+type CurrencyDef struct {
+	// ISO 4217 code
+	Code string
+	// number of decimal digits between minor and major unit
+	MinorUnits int
+	// coin and note denominations in minor units, smallest first
+	Coins []Currency
+	Notes []Currency
+	// fmt pattern receiving the amount in major units, ex: "%s JPY"
+	Pattern string
+}
+
+// JPY yen coins and notes
+var JPY = &CurrencyDef{
+	Code:       "JPY",
+	MinorUnits: 0,
+	Coins:      []Currency{C10, C50, C100, C500},
+	Notes:      []Currency{N1000, N5000, N10000},
+	Pattern:    "%s JPY",
+}
+
+// EUR coins and notes, valued in cents
+var EUR = &CurrencyDef{
+	Code:       "EUR",
+	MinorUnits: 2,
+	Coins:      []Currency{5, 10, 20, 50, 100, 200},
+	Notes:      []Currency{500, 1000, 2000},
+	Pattern:    "€%s",
+}
+
+// DefaultCurrency is the currency of a machine built without WithCurrency,
+// Currency.Str and NewCurrencyFromString work with it too
+var DefaultCurrency = JPY
+
+// LookupCurrency returns the currency definition of an ISO 4217 code
+func LookupCurrency(code string) (*CurrencyDef, error) {
+	for _, v := range []*CurrencyDef{JPY, EUR} {
+		if v.Code == code {
+			return v, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%s is not a supported currency", code)
+}
+
+// Format print amount of minor units using the currency pattern
+func (d *CurrencyDef) Format(amount int) string {
+	return fmt.Sprintf(d.Pattern, d.FormatMajor(amount))
+}
+
+// FormatMajor print amount of minor units as a decimal in major units,
+// the way Parse reads it back, ex: "0.50"
+func (d *CurrencyDef) FormatMajor(amount int) string {
+	if d.MinorUnits == 0 {
+		return strconv.Itoa(amount)
+	}
+
+	unit := 1
+	for i := 0; i < d.MinorUnits; i++ {
+		unit *= 10
+	}
+	return fmt.Sprintf("%d.%0*d", amount/unit, d.MinorUnits, amount%unit)
+}
+
+// Parse read a denomination written in major units, ex: "0.50" for
+// 50 cent coin. Only coins and notes of the currency are valid
+func (d *CurrencyDef) Parse(s string) (Currency, error) {
+	invalid := &CoinError{Value: s}
+
+	whole, fraction := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, fraction = s[:i], s[i+1:]
+	}
+	if len(fraction) > d.MinorUnits {
+		return Currency(-1), invalid
+	}
+	fraction += strings.Repeat("0", d.MinorUnits-len(fraction))
+
+	v, err := strconv.Atoi(whole + fraction)
+	if err != nil || v <= 0 || strings.ContainsAny(s, "+-") {
+		return Currency(-1), invalid
+	}
+	if !d.IsCoin(Currency(v)) && !d.IsNote(Currency(v)) {
+		return Currency(-1), invalid
+	}
+
+	return Currency(v), nil
+}
+
+// IsCoin tells whether c is a coin of the currency
+func (d *CurrencyDef) IsCoin(c Currency) bool {
+	return contains(d.Coins, c)
+}
+
+// IsNote tells whether c is a note of the currency,
+// notes go to bill stacker instead of the coin drawer
+func (d *CurrencyDef) IsNote(c Currency) bool {
+	return contains(d.Notes, c)
+}
+
+// Str print c in DefaultCurrency, see CurrencyDef.Format
 func (c Currency) Str() string {
-	return fmt.Sprintf("%d %s", c, CUR_SYMBOL)
+	return DefaultCurrency.Format(int(c))
 }
 
+// NewCurrencyFromString parse a denomination of DefaultCurrency,
+// see CurrencyDef.Parse
 func NewCurrencyFromString(s string) (Currency, error) {
-	switch s {
-	case "10":
-		return C10, nil
-	case "50":
-		return C50, nil
-	case "100":
-		return C100, nil
-	case "500":
-		return C500, nil
-	}
-
-	return Currency(-1), fmt.Errorf("%s is not a valid coin", s)
+	return DefaultCurrency.Parse(s)
+}
+
+func contains(denominations []Currency, c Currency) bool {
+	for _, v := range denominations {
+		if c == v {
+			return true
+		}
+	}
+
+	return false
 }
@@ -35,6 +35,18 @@ func TestNewCurrencyFromString(t *testing.T) {
 			expected:    C500,
 			expectedStr: "500 JPY",
 		},
+		{
+			name:        "1000 Note",
+			input:       "1000",
+			expected:    N1000,
+			expectedStr: "1000 JPY",
+		},
+		{
+			name:        "10000 Note",
+			input:       "10000",
+			expected:    N10000,
+			expectedStr: "10000 JPY",
+		},
 	}
 
 	for _, tc := range testCases {
@@ -63,3 +75,127 @@ func TestNewCurrencyFromStringInvalidInput(t *testing.T) {
 		t.Errorf("Expected error message '20 is not a valid coin' got '%s'", err.Error())
 	}
 }
+
+func TestCurrencyDefIsNote(t *testing.T) {
+	for _, c := range JPY.Coins {
+		if JPY.IsNote(c) {
+			t.Errorf("Expected %s is not a note", c.Str())
+		}
+	}
+	for _, c := range JPY.Notes {
+		if !JPY.IsNote(c) {
+			t.Errorf("Expected %s is a note", c.Str())
+		}
+	}
+
+	// 500 is a JPY coin but 5 EUR note
+	if JPY.IsNote(C500) || !EUR.IsNote(C500) {
+		t.Errorf("Expected note check driven by currency definition")
+	}
+}
+
+func TestCurrencyDefParseEUR(t *testing.T) {
+	testCases := []struct {
+		name        string
+		input       string
+		expected    Currency
+		expectedStr string
+	}{
+		{
+			name:        "5 cent coin",
+			input:       "0.05",
+			expected:    Currency(5),
+			expectedStr: "€0.05",
+		},
+		{
+			name:        "20 cent coin without trailing zero",
+			input:       "0.2",
+			expected:    Currency(20),
+			expectedStr: "€0.20",
+		},
+		{
+			name:        "2 euro coin",
+			input:       "2",
+			expected:    Currency(200),
+			expectedStr: "€2.00",
+		},
+		{
+			name:        "20 euro note",
+			input:       "20.00",
+			expected:    Currency(2000),
+			expectedStr: "€20.00",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			actual, err := EUR.Parse(tc.input)
+			if actual != tc.expected {
+				t.Errorf("Expected %d, got %d", tc.expected, actual)
+			}
+			if err != nil {
+				t.Errorf("Expected error nil but got %v", err)
+			}
+			if EUR.Format(int(actual)) != tc.expectedStr {
+				t.Errorf("Expected str %v, got %v", tc.expectedStr, EUR.Format(int(actual)))
+			}
+		})
+	}
+}
+
+func TestCurrencyDefParseInvalidInput(t *testing.T) {
+	testCases := []struct {
+		currency *CurrencyDef
+		input    string
+	}{
+		{JPY, "20"},
+		{JPY, "10.5"},
+		{JPY, "-10"},
+		{JPY, "ten"},
+		{EUR, "0.03"},
+		{EUR, "0.505"},
+		{EUR, "50"},
+		{EUR, ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.currency.Code+" "+tc.input, func(t *testing.T) {
+			_, err := tc.currency.Parse(tc.input)
+			if err == nil {
+				t.Errorf("Expected error not nil, got nil")
+				return
+			}
+			if err.Error() != tc.input+" is not a valid coin" {
+				t.Errorf("Expected error message '%s is not a valid coin' got '%s'", tc.input, err.Error())
+			}
+		})
+	}
+}
+
+func TestCurrencyDefFormat(t *testing.T) {
+	if JPY.Format(1200) != "1200 JPY" {
+		t.Errorf("Expected 1200 JPY, got %s", JPY.Format(1200))
+	}
+	if EUR.Format(1205) != "€12.05" {
+		t.Errorf("Expected €12.05, got %s", EUR.Format(1205))
+	}
+	if EUR.Format(0) != "€0.00" {
+		t.Errorf("Expected €0.00, got %s", EUR.Format(0))
+	}
+}
+
+func TestDefaultCurrency(t *testing.T) {
+	DefaultCurrency = EUR
+	defer func() { DefaultCurrency = JPY }()
+
+	c, err := NewCurrencyFromString("0.20")
+	if err != nil || c != 20 {
+		t.Errorf("Expected 20 cents, got %d %v", c, err)
+	}
+	if c.Str() != "€0.20" {
+		t.Errorf("Expected €0.20, got %s", c.Str())
+	}
+	if New(nil, nil).Currency() != EUR {
+		t.Errorf("Expected machines in EUR by default")
+	}
+}
@@ -0,0 +1,235 @@
+package machine
+
+import (
+	"errors"
+)
+
+// Failures of the machine are matched with errors.Is against these
+// values, errors.As gives the details of the typed errors below
+var (
+	// ErrSoldOut means the slot has not enough stock left
+	ErrSoldOut = errors.New("This item is sold out")
+	// ErrInsufficientFunds means the inserted money does not cover
+	// the price, see FundsError
+	ErrInsufficientFunds = errors.New("Inserted money not enough")
+	// ErrCannotMakeChange means the drawer cannot pay the change back,
+	// see ChangeError
+	ErrCannotMakeChange = errors.New("Unable to return change")
+	// ErrInvalidSlot means no slot matches the one picked, see SlotError
+	ErrInvalidSlot = errors.New("Invalid slot")
+	// ErrInvalidCoin means the money is not a coin or note the machine
+	// accepts, see CoinError and InsertError
+	ErrInvalidCoin = errors.New("Invalid coin")
+)
+
+// SlotError is returned when no slot matches what the customer picked
+type SlotError struct {
+	// Slot as given, or the position given to Buy
+	Slot string
+	// Slots are the valid codes in display order,
+	// Buy takes a position from 1 to len(Slots)
+	Slots []string
+
+	// byPosition and byName select the message
+	byPosition bool
+	byName     bool
+}
+
+func (e *SlotError) Error() string {
+	return e.Localize(English)
+}
+
+func (e *SlotError) Localize(l Locale) string {
+	switch {
+	case e.byPosition:
+		return l.Sprintf("Invalid inventory, please enter number from (1 to %d)", len(e.Slots))
+	case e.byName:
+		return l.Sprintf("No slot or item named %s", e.Slot)
+	}
+
+	return l.Sprintf("Invalid slot %s", e.Slot)
+}
+
+func (e *SlotError) Is(target error) bool {
+	return target == ErrInvalidSlot
+}
+
+// StockError is returned when the cart holds more items
+// of the slot than it has left
+type StockError struct {
+	Slot     string
+	Item     Item
+	Stock    int
+	Quantity int
+}
+
+func (e *StockError) Error() string {
+	return e.Localize(English)
+}
+
+func (e *StockError) Localize(l Locale) string {
+	return l.Sprintf("Only %d %s left", e.Stock, e.Item.LocalName(l))
+}
+
+func (e *StockError) Is(target error) bool {
+	return target == ErrSoldOut
+}
+
+// FundsError is returned when the inserted money does not cover the price
+type FundsError struct {
+	// Price of the item, or total of the cart
+	Price    int
+	Inserted int
+
+	cart     bool
+	currency *CurrencyDef
+}
+
+// Shortfall returns the money still to insert
+func (e *FundsError) Shortfall() int {
+	return e.Price - e.Inserted
+}
+
+func (e *FundsError) Error() string {
+	return e.Localize(English)
+}
+
+func (e *FundsError) Localize(l Locale) string {
+	if !e.cart {
+		return l.Text("Inserted money not enough to buy this item")
+	}
+
+	currency := e.currency
+	if currency == nil {
+		currency = DefaultCurrency
+	}
+	return l.Sprintf("Inserted money not enough, cart total is %s", currency.Format(e.Price))
+}
+
+func (e *FundsError) Is(target error) bool {
+	return target == ErrInsufficientFunds
+}
+
+// ChangeError is returned when the drawer cannot pay the change back,
+// Shortfall is what is missing from the closest amount it can pay
+type ChangeError struct {
+	Due       int
+	Shortfall int
+}
+
+func (e *ChangeError) Error() string {
+	return e.Localize(English)
+}
+
+func (e *ChangeError) Localize(l Locale) string {
+	return l.Text("Unable to return change")
+}
+
+func (e *ChangeError) Is(target error) bool {
+	return target == ErrCannotMakeChange
+}
+
+// CoinError is returned when a denomination
+// written by the customer is not a coin of the currency
+type CoinError struct {
+	Value string
+}
+
+func (e *CoinError) Error() string {
+	return e.Localize(English)
+}
+
+func (e *CoinError) Localize(l Locale) string {
+	return l.Sprintf("%s is not a valid coin", e.Value)
+}
+
+func (e *CoinError) Is(target error) bool {
+	return target == ErrInvalidCoin
+}
+
+// InsertRejectReason tells why Insert bounced a coin
+type InsertRejectReason int
+
+const (
+	// RejectCannotSettle means an item purchasable with the coin
+	// could not be paid out with the current drawer
+	RejectCannotSettle InsertRejectReason = iota + 1
+	// RejectUnknownDenomination means the coin does not belong
+	// to the machine currency
+	RejectUnknownDenomination
+	// RejectNoteNotAccepted means the bill validator
+	// is not configured for the note
+	RejectNoteNotAccepted
+	// RejectStackerFull means there is no room left in bill stacker
+	RejectStackerFull
+	// RejectCoinNotAccepted means the coin acceptor
+	// is not configured for the coin
+	RejectCoinNotAccepted
+)
+
+func (r InsertRejectReason) String() string {
+	switch r {
+	case RejectCannotSettle:
+		return "cannot settle"
+	case RejectUnknownDenomination:
+		return "unknown denomination"
+	case RejectNoteNotAccepted:
+		return "note not accepted"
+	case RejectStackerFull:
+		return "stacker full"
+	case RejectCoinNotAccepted:
+		return "coin not accepted"
+	}
+
+	return "unknown"
+}
+
+// InsertError is returned by Insert when the coin is moved to return gate,
+// it matches ErrInvalidCoin for a coin or note the machine does not take
+// and unwraps to the ChangeError of RejectCannotSettle
+type InsertError struct {
+	Coin   Currency
+	Reason InsertRejectReason
+	// Item which could not be settled, set for RejectCannotSettle
+	Item Item
+
+	currency *CurrencyDef
+	err      error
+}
+
+func (e *InsertError) Error() string {
+	return e.Localize(English)
+}
+
+func (e *InsertError) Localize(l Locale) string {
+	currency := e.currency
+	if currency == nil {
+		currency = DefaultCurrency
+	}
+
+	switch e.Reason {
+	case RejectUnknownDenomination:
+		return l.Sprintf("%s is not a valid coin", currency.Format(int(e.Coin)))
+	case RejectNoteNotAccepted:
+		return l.Sprintf("%s note is not accepted", currency.Format(int(e.Coin)))
+	case RejectStackerFull:
+		return l.Text("Bill stacker is full")
+	case RejectCoinNotAccepted:
+		return l.Sprintf("%s coin is not accepted", currency.Format(int(e.Coin)))
+	}
+
+	return l.Sprintf("Unable to return change for %s", e.Item.LocalName(l))
+}
+
+func (e *InsertError) Is(target error) bool {
+	switch e.Reason {
+	case RejectUnknownDenomination, RejectNoteNotAccepted, RejectCoinNotAccepted:
+		return target == ErrInvalidCoin
+	}
+
+	return false
+}
+
+func (e *InsertError) Unwrap() error {
+	return e.err
+}
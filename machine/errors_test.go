@@ -0,0 +1,79 @@
+package machine
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestErrors(t *testing.T) {
+	m := New(map[Currency]int{C100: 1, C10: 2}, []Inventory{
+		Inventory{Slot: "A1", Item: Item{Name: "Item 1", Price: 120}, Stock: 1},
+		Inventory{Slot: "A2", Item: Item{Name: "Item 2", Price: 100}, Stock: 0},
+	})
+
+	err := m.Buy(5)
+	slotErr := &SlotError{}
+	if !errors.Is(err, ErrInvalidSlot) || !errors.As(err, &slotErr) || !reflect.DeepEqual(slotErr.Slots, []string{"A1", "A2"}) {
+		t.Errorf("Expected invalid slot with slots A1 and A2, got %v", err)
+	}
+	if _, err := m.FindSlot("tea"); !errors.Is(err, ErrInvalidSlot) {
+		t.Errorf("Expected invalid slot, got %v", err)
+	}
+
+	if err := m.BuySlot("A2"); !errors.Is(err, ErrSoldOut) {
+		t.Errorf("Expected sold out, got %v", err)
+	}
+	if err := m.AddToCart("A1", 2); !errors.Is(err, ErrSoldOut) {
+		t.Errorf("Expected sold out, got %v", err)
+	}
+
+	m.Insert(C100)
+	err = m.BuySlot("A1")
+	fundsErr := &FundsError{}
+	if !errors.Is(err, ErrInsufficientFunds) || !errors.As(err, &fundsErr) || fundsErr.Shortfall() != 20 {
+		t.Errorf("Expected 20 missing, got %v", err)
+	}
+
+	if _, err := m.Currency().Parse("30"); !errors.Is(err, ErrInvalidCoin) {
+		t.Errorf("Expected invalid coin, got %v", err)
+	}
+	if err := m.Insert(Currency(30)); !errors.Is(err, ErrInvalidCoin) {
+		t.Errorf("Expected invalid coin, got %v", err)
+	}
+
+	// 100 and 500 pay 120 leaving 480 change, the drawer
+	// then holds two 100 and two 10 below it
+	err = m.Insert(C500)
+	changeErr := &ChangeError{}
+	if !errors.Is(err, ErrCannotMakeChange) || !errors.As(err, &changeErr) {
+		t.Errorf("Expected unable to return change, got %v", err)
+		return
+	}
+	if changeErr.Due != 480 || changeErr.Shortfall != 260 {
+		t.Errorf("Expected 260 of 480 change missing, got %d of %d", changeErr.Shortfall, changeErr.Due)
+	}
+}
+
+func TestPayable(t *testing.T) {
+	testCases := []struct {
+		name     string
+		drawer   map[Currency]int
+		limit    int
+		expected int
+	}{
+		{"Exact", map[Currency]int{C100: 1, C10: 3}, 130, 130},
+		{"Short of small coins", map[Currency]int{C100: 1, C10: 2}, 130, 120},
+		{"Coin larger than limit", map[Currency]int{C50: 1}, 40, 0},
+		{"Skip a large coin", map[Currency]int{C50: 1, C10: 4}, 80, 80},
+		{"Empty drawer", map[Currency]int{}, 30, 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := payable(tc.drawer, tc.limit); actual != tc.expected {
+				t.Errorf("Expected %d, got %d", tc.expected, actual)
+			}
+		})
+	}
+}
@@ -0,0 +1,244 @@
+package machine
+
+import "sync"
+
+// defaultLowStock is the stock level of LowStock for machines built with New
+const defaultLowStock = 2
+
+// Event is published to subscribers once a change of the machine is
+// committed, switch on its type to read it. Nothing is published for
+// a transaction rolled back since it could not be journaled or saved
+type Event interface {
+	event()
+}
+
+// CoinAccepted coin or note went to input register
+type CoinAccepted struct {
+	Coin Currency
+}
+
+// CoinRejected coin or note went straight to return gate,
+// Err tells why, see Insert
+type CoinRejected struct {
+	Coin Currency
+	Err  error
+}
+
+// ItemDispensed item fell in the outlet, once per item of a cart
+type ItemDispensed struct {
+	Slot string
+	Item Item
+}
+
+// ChangeIssued change of a sale went back to input register
+type ChangeIssued struct {
+	Coins []Currency
+}
+
+// SoldOut the last item of a slot was dispensed
+type SoldOut struct {
+	Slot string
+	Item Item
+}
+
+// LowStock the stock of a slot fell to the level given by WithLowStock
+// or below, SoldOut is published instead when nothing is left
+type LowStock struct {
+	Slot  string
+	Item  Item
+	Stock int
+}
+
+// LowChange the machine can no longer give change for every item
+// paid with Currency, the display shows it as Exact change only
+type LowChange struct {
+	Currency Currency
+}
+
+func (CoinAccepted) event()  {}
+func (CoinRejected) event()  {}
+func (ItemDispensed) event() {}
+func (ChangeIssued) event()  {}
+func (SoldOut) event()       {}
+func (LowStock) event()      {}
+func (LowChange) event()     {}
+
+// WithLowStock set the stock level publishing LowStock, 2 by default
+func WithLowStock(level int) Option {
+	return func(m *Machine) {
+		m.lowStock = level
+	}
+}
+
+// Subscribe calls fn with every event published from now on until
+// unsubscribe is called. fn runs on a separate goroutine, one event at a
+// time in the order they happened, so it may call the machine back
+func (m *Machine) Subscribe(fn func(Event)) (unsubscribe func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.bus == nil {
+		m.bus = &bus{}
+		m.bus.idle = sync.NewCond(&m.bus.mu)
+	}
+	return m.bus.subscribe(fn)
+}
+
+// WaitEvents blocks until subscribers handled every event published
+// so far, it must not be called from a subscriber
+func (m *Machine) WaitEvents() {
+	m.mu.Lock()
+	b := m.bus
+	m.mu.Unlock()
+
+	if b != nil {
+		b.wait()
+	}
+}
+
+// emit queue e until the transaction is committed
+func (m *Machine) emit(e Event) {
+	if m.bus == nil || !m.bus.active() {
+		return
+	}
+	m.events = append(m.events, e)
+}
+
+// levels is what the level events compare before
+// and after a transaction
+type levels struct {
+	stock map[string]int
+	exact map[Currency]bool
+}
+
+// levels returns nil without subscribers, the change status
+// is not worth computing when nobody listens
+func (m *Machine) levels() *levels {
+	if m.bus == nil || !m.bus.active() {
+		return nil
+	}
+
+	l := &levels{stock: map[string]int{}, exact: map[Currency]bool{}}
+	for _, v := range m.inventories {
+		l.stock[v.Slot] = v.Stock
+	}
+	for _, v := range m.changeStatus() {
+		l.exact[v.Currency] = v.ExactChangeOnly
+	}
+
+	return l
+}
+
+// publish sends the queued events followed by the level events
+// of the transaction started at before
+func (m *Machine) publish(before *levels) {
+	events := m.events
+	m.events = nil
+	if before == nil {
+		return
+	}
+
+	for _, v := range m.inventories {
+		stock, ok := before.stock[v.Slot]
+		if !ok || v.Stock >= stock {
+			continue
+		}
+		switch {
+		case v.Stock <= 0:
+			events = append(events, SoldOut{Slot: v.Slot, Item: v.Item})
+		case v.Stock <= m.lowStock && stock > m.lowStock:
+			events = append(events, LowStock{Slot: v.Slot, Item: v.Item, Stock: v.Stock})
+		}
+	}
+	for _, v := range m.changeStatus() {
+		if v.ExactChangeOnly && !before.exact[v.Currency] {
+			events = append(events, LowChange{Currency: v.Currency})
+		}
+	}
+
+	m.bus.publish(events)
+}
+
+// bus delivers events to subscribers from a single goroutine,
+// started when events are published and stopped once they are handled
+type bus struct {
+	mu          sync.Mutex
+	idle        *sync.Cond
+	queue       []Event
+	subscribers []*subscriber
+	running     bool
+}
+
+type subscriber struct {
+	fn func(Event)
+}
+
+func (b *bus) subscribe(fn func(Event)) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := &subscriber{fn: fn}
+	b.subscribers = append(b.subscribers, s)
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		for i, v := range b.subscribers {
+			if v == s {
+				b.subscribers = append(b.subscribers[:i:i], b.subscribers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+func (b *bus) active() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.subscribers) > 0
+}
+
+func (b *bus) publish(events []Event) {
+	if len(events) == 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.queue = append(b.queue, events...)
+	if !b.running {
+		b.running = true
+		go b.run()
+	}
+}
+
+func (b *bus) run() {
+	for {
+		b.mu.Lock()
+		if len(b.queue) == 0 {
+			b.running = false
+			b.idle.Broadcast()
+			b.mu.Unlock()
+			return
+		}
+		e := b.queue[0]
+		b.queue = b.queue[1:]
+		subscribers := append([]*subscriber{}, b.subscribers...)
+		b.mu.Unlock()
+
+		for _, s := range subscribers {
+			s.fn(e)
+		}
+	}
+}
+
+func (b *bus) wait() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for b.running {
+		b.idle.Wait()
+	}
+}
@@ -0,0 +1,241 @@
+package machine
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// eventRecorder subscribes to m and keeps every event
+type eventRecorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func recordEvents(m *Machine) *eventRecorder {
+	r := &eventRecorder{}
+	m.Subscribe(func(e Event) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		r.events = append(r.events, e)
+	})
+	return r
+}
+
+// take returns the events handled so far and forgets them
+func (r *eventRecorder) take(m *Machine) []Event {
+	m.WaitEvents()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	events := r.events
+	r.events = nil
+	return events
+}
+
+func createEventTestMachine(opts ...Option) *Machine {
+	return New(map[Currency]int{C10: 8, C100: 5}, []Inventory{
+		Inventory{Item: Item{Name: "Canned coffee", Price: 120}, Stock: 4},
+		Inventory{Item: Item{Name: "Water PET bottle", Price: 100}, Stock: 1},
+	}, opts...)
+}
+
+func TestEventsInsert(t *testing.T) {
+	m := createEventTestMachine()
+	r := recordEvents(m)
+
+	m.Insert(C100)
+	m.Insert(Currency(30))
+	events := r.take(m)
+	if len(events) != 2 {
+		t.Errorf("Expected 2 events, got %v", events)
+		return
+	}
+	if expected := (CoinAccepted{Coin: C100}); events[0] != expected {
+		t.Errorf("Expected %v, got %v", expected, events[0])
+	}
+	rejected, ok := events[1].(CoinRejected)
+	if !ok || rejected.Coin != Currency(30) || !errors.Is(rejected.Err, ErrInvalidCoin) {
+		t.Errorf("Expected 30 rejected as an invalid coin, got %v", events[1])
+	}
+}
+
+func TestEventsBuy(t *testing.T) {
+	m := createEventTestMachine()
+	r := recordEvents(m)
+
+	m.Insert(C100)
+	m.Insert(C100)
+	r.take(m)
+	m.Buy(0)
+
+	// the change takes every 10 coin
+	expected := []Event{
+		ItemDispensed{Slot: "1", Item: Item{Name: "Canned coffee", Price: 120}},
+		ChangeIssued{Coins: []Currency{C10, C10, C10, C10, C10, C10, C10, C10}},
+	}
+	actual := r.take(m)
+	if len(actual) < 2 || !reflect.DeepEqual(expected, actual[:2]) {
+		t.Errorf("Expected %v first, got %v", expected, actual)
+	}
+
+	m.Insert(C10)
+	m.Insert(C10)
+	r.take(m)
+	m.Buy(1)
+	expected = []Event{
+		ItemDispensed{Slot: "2", Item: Item{Name: "Water PET bottle", Price: 100}},
+		SoldOut{Slot: "2", Item: Item{Name: "Water PET bottle", Price: 100}},
+	}
+	if actual := r.take(m); !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected %v, got %v", expected, actual)
+	}
+
+	// failed buy publishes nothing
+	m.Buy(1)
+	if actual := r.take(m); len(actual) != 0 {
+		t.Errorf("Expected no events, got %v", actual)
+	}
+}
+
+func TestEventsLowStock(t *testing.T) {
+	testCases := []struct {
+		name     string
+		opts     []Option
+		expected []int
+	}{
+		{"Default level", nil, []int{2}},
+		{"Level 3", []Option{WithLowStock(3)}, []int{3}},
+		{"Disabled", []Option{WithLowStock(0)}, []int{}},
+	}
+
+	for _, v := range testCases {
+		m := New(map[Currency]int{C10: 100}, []Inventory{
+			Inventory{Item: Item{Name: "Gum", Price: 10}, Stock: 4},
+		}, v.opts...)
+		r := recordEvents(m)
+
+		actual := []int{}
+		soldOut := 0
+		for i := 0; i < 4; i++ {
+			m.Insert(C10)
+			m.Buy(0)
+		}
+		for _, e := range r.take(m) {
+			switch e := e.(type) {
+			case LowStock:
+				actual = append(actual, e.Stock)
+			case SoldOut:
+				soldOut++
+			}
+		}
+		if !reflect.DeepEqual(v.expected, actual) {
+			t.Errorf("%s: Expected low stock at %v, got %v", v.name, v.expected, actual)
+		}
+		if soldOut != 1 {
+			t.Errorf("%s: Expected sold out once, got %d", v.name, soldOut)
+		}
+	}
+}
+
+func TestEventsLowChange(t *testing.T) {
+	m := createEventTestMachine()
+	r := recordEvents(m)
+
+	m.Insert(C100)
+	m.Insert(C100)
+	m.Buy(0)
+
+	low := []Currency{}
+	for _, e := range r.take(m) {
+		if e, ok := e.(LowChange); ok {
+			low = append(low, e.Currency)
+		}
+	}
+	// largest first, like the display
+	if expected := []Currency{C500, C100, C50}; !reflect.DeepEqual(expected, low) {
+		t.Errorf("Expected low change for %v, got %v", expected, low)
+	}
+
+	// loading coins back is not low change
+	m.LoadCoins(map[Currency]int{C10: 20})
+	for _, e := range r.take(m) {
+		if _, ok := e.(LowChange); ok {
+			t.Errorf("Expected no low change after loading coins, got %v", e)
+		}
+	}
+}
+
+func TestEventsCheckout(t *testing.T) {
+	m := createEventTestMachine()
+	r := recordEvents(m)
+
+	m.AddToCart("1", 2)
+	m.Insert(C100)
+	m.Insert(C100)
+	m.Insert(C50)
+	r.take(m)
+	if err := m.Checkout(); err != nil {
+		t.Errorf("Expected error nil, got %v", err)
+	}
+
+	dispensed := 0
+	for _, e := range r.take(m) {
+		if _, ok := e.(ItemDispensed); ok {
+			dispensed++
+		}
+	}
+	if dispensed != 2 {
+		t.Errorf("Expected 2 items dispensed, got %d", dispensed)
+	}
+}
+
+func TestEventsRollback(t *testing.T) {
+	s := &failingStore{fail: true}
+	m := createEventTestMachine(WithStore(s))
+	r := recordEvents(m)
+
+	m.Insert(C100)
+	if actual := r.take(m); len(actual) != 0 {
+		t.Errorf("Expected no events for a rolled back insert, got %v", actual)
+	}
+
+	s.fail = false
+	m.Insert(C100)
+	if actual := r.take(m); len(actual) != 1 {
+		t.Errorf("Expected 1 event once saved, got %v", actual)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	m := createEventTestMachine()
+
+	// a subscriber may call the machine back
+	inputs := []int{}
+	unsubscribe := m.Subscribe(func(e Event) {
+		if _, ok := e.(CoinAccepted); ok {
+			inputs = append(inputs, m.TotalInputRegister())
+		}
+	})
+	r := recordEvents(m)
+
+	m.Insert(C10)
+	m.WaitEvents()
+	m.Insert(C100)
+	m.WaitEvents()
+	if expected := []int{10, 110}; !reflect.DeepEqual(expected, inputs) {
+		t.Errorf("Expected inputs %v, got %v", expected, inputs)
+	}
+
+	unsubscribe()
+	m.Insert(C10)
+	m.WaitEvents()
+	if len(inputs) != 2 {
+		t.Errorf("Expected no events after unsubscribe, got %v", inputs)
+	}
+	if actual := r.take(m); len(actual) != 3 {
+		t.Errorf("Expected other subscribers to get every event, got %v", actual)
+	}
+}
@@ -1,11 +1,20 @@
 package machine
 
 type Item struct {
-	Name  string
-	Price int
+	Name  string `json:"name"`
+	Price int    `json:"price"`
+	// Tax category of the item, TaxStandard when empty
+	Tax TaxCategory `json:"tax,omitempty"`
+	// Names translates Name, see LocalName
+	Names map[Locale]string `json:"names,omitempty"`
 }
 
 type Inventory struct {
+	// Slot is the code customers pick the item with, ex: "A3",
+	// it stays the same when other slots are added or removed
+	Slot string `json:"slot"`
 	Item
-	Stock int
+	Stock int `json:"stock"`
+	// Capacity is the most items the slot holds, zero for no limit
+	Capacity int `json:"capacity,omitempty"`
 }
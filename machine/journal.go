@@ -0,0 +1,408 @@
+package machine
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// EntryType names a money or stock movement in the journal
+type EntryType string
+
+const (
+	// EntryProvisioned carries the machine state before the first entry
+	EntryProvisioned EntryType = "provisioned"
+	// EntryCoinInserted coin went to input register
+	EntryCoinInserted EntryType = "coin_inserted"
+	// EntryCoinRejected coin went straight to return gate
+	EntryCoinRejected EntryType = "coin_rejected"
+	// EntrySale coins taken from input register for an item
+	EntrySale EntryType = "sale"
+	// EntryChangeIssued coins moved from main register to input register
+	EntryChangeIssued EntryType = "change_issued"
+	// EntryRefund input register moved to return gate
+	EntryRefund EntryType = "refund"
+	// EntryItemsCollected outlet emptied by customer
+	EntryItemsCollected EntryType = "items_collected"
+	// EntryChangeCollected return gate emptied by customer
+	EntryChangeCollected EntryType = "change_collected"
+	// EntrySlotRemoved slot taken out of the machine with its stock
+	EntrySlotRemoved EntryType = "slot_removed"
+	// EntryRestocked items added to a slot by the operator
+	EntryRestocked EntryType = "restocked"
+	// EntryItemAdded new slot put in the machine
+	EntryItemAdded EntryType = "item_added"
+	// EntryPriceChanged new price of the item in a slot
+	EntryPriceChanged EntryType = "price_changed"
+	// EntryCoinsLoaded coins put into main register by the operator
+	EntryCoinsLoaded EntryType = "coins_loaded"
+	// EntryCashWithdrawn coins and notes taken out by the operator
+	EntryCashWithdrawn EntryType = "cash_withdrawn"
+	// EntryCartSale coins taken from input register for every item of a cart
+	EntryCartSale EntryType = "cart_sale"
+	// EntryCashlessSale item paid by a PaymentMethod other than coins,
+	// with the coins of input register for a mixed tender
+	EntryCashlessSale EntryType = "cashless_sale"
+)
+
+// JournalEntry records one movement, only the fields relevant
+// to the entry type are set
+type JournalEntry struct {
+	Seq  uint64    `json:"seq"`
+	Time time.Time `json:"time"`
+	Type EntryType `json:"type"`
+
+	// coin inserted or rejected, coins taken for a sale,
+	// change issued, refunded or collected
+	Coins []Currency `json:"coins,omitempty"`
+
+	// sold item, its slot and the price paid.
+	// Amount is also the quantity restocked or the new price
+	Slot   string `json:"slot,omitempty"`
+	Item   *Item  `json:"item,omitempty"`
+	Amount int    `json:"amount,omitempty"`
+
+	// payment method, its reference and the amount
+	// it was charged for a cashless sale
+	Method    string `json:"method,omitempty"`
+	Reference string `json:"reference,omitempty"`
+	Charged   int    `json:"charged,omitempty"`
+
+	// coins of a sale that fell in the cash box
+	// since their tube was full
+	Overflow []Currency `json:"overflow,omitempty"`
+
+	// items of a cart sale
+	Lines []CartLine `json:"lines,omitempty"`
+
+	// slot added by the operator
+	Inventory *Inventory `json:"inventory,omitempty"`
+
+	// items collected from the outlet
+	Items []Item `json:"items,omitempty"`
+
+	// state before the first entry, for EntryProvisioned
+	State *State `json:"state,omitempty"`
+}
+
+// Journal is an append-only log of JournalEntry, entries of one
+// transaction are appended together and must be durable on return
+type Journal interface {
+	Append(entries ...JournalEntry) error
+}
+
+// WithJournal append every money and stock movement to j
+func WithJournal(j Journal) Option {
+	return func(m *Machine) {
+		m.journal = j
+	}
+}
+
+// record stamps e and keeps it until the transaction commits
+func (m *Machine) record(e JournalEntry) {
+	if m.journal == nil {
+		return
+	}
+
+	m.journalSeq++
+	e.Seq = m.journalSeq
+	e.Time = m.clock()
+	m.pending = append(m.pending, e)
+}
+
+// MemoryJournal keeps entries in memory
+type MemoryJournal struct {
+	mu      sync.Mutex
+	entries []JournalEntry
+}
+
+func (j *MemoryJournal) Append(entries ...JournalEntry) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.entries = append(j.entries, entries...)
+	return nil
+}
+
+// Entries returns a copy of every appended entry
+func (j *MemoryJournal) Entries() []JournalEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return append([]JournalEntry{}, j.entries...)
+}
+
+// FileJournal writes entries as JSON lines to a file opened for append
+type FileJournal struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+func OpenFileJournal(path string) (*FileJournal, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileJournal{f: f}, nil
+}
+
+// Append writes entries with a single write followed by fsync
+func (j *FileJournal) Append(entries ...JournalEntry) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	b := []byte{}
+	for _, e := range entries {
+		line, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		b = append(append(b, line...), '\n')
+	}
+
+	if _, err := j.f.Write(b); err != nil {
+		return err
+	}
+	return j.f.Sync()
+}
+
+func (j *FileJournal) Close() error {
+	return j.f.Close()
+}
+
+// ReadJournal parse JSON lines written by FileJournal
+func ReadJournal(r io.Reader) ([]JournalEntry, error) {
+	entries := []JournalEntry{}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		e := JournalEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("Journal line %d: %v", line, err)
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, scanner.Err()
+}
+
+// Replay reconstruct a machine from journal entries starting with
+// EntryProvisioned. Every entry is checked against the registers, so a
+// journal out of sequence or not matching the money in the machine is
+// reported instead of replayed. opts configure hardware the same way as New
+func Replay(entries []JournalEntry, opts ...Option) (*Machine, error) {
+	if len(entries) == 0 || entries[0].Type != EntryProvisioned || entries[0].State == nil {
+		return nil, fmt.Errorf("Journal must start with %s entry", EntryProvisioned)
+	}
+
+	m := New(map[Currency]int{}, []Inventory{}, opts...)
+	m.restore(entries[0].State)
+	if entries[0].State.Currency != m.Currency().Code {
+		return nil, fmt.Errorf("Journal currency %s does not match machine currency %s", entries[0].State.Currency, m.Currency().Code)
+	}
+
+	for _, e := range entries {
+		if e.Seq != m.journalSeq+1 {
+			return nil, fmt.Errorf("Journal entry %d: expected sequence %d", e.Seq, m.journalSeq+1)
+		}
+		if err := m.apply(e); err != nil {
+			return nil, fmt.Errorf("Journal entry %d: %v", e.Seq, err)
+		}
+		m.journalSeq = e.Seq
+	}
+
+	return m, nil
+}
+
+// apply replays the effect of e on the registers
+func (m *Machine) apply(e JournalEntry) error {
+	switch e.Type {
+	case EntryProvisioned:
+	case EntryCoinInserted:
+		m.inputRegister = append(m.inputRegister, e.Coins...)
+	case EntryCoinRejected:
+		m.returnRegister = append(m.returnRegister, e.Coins...)
+	case EntrySale, EntryCashlessSale:
+		i := m.slotIndex(e.Slot)
+		if e.Item == nil || i < 0 || m.inventories[i].Stock <= 0 {
+			return fmt.Errorf("no stock to sell in slot %s", e.Slot)
+		}
+		if err := m.takeInput(e.Coins); err != nil {
+			return err
+		}
+		m.deposit(e.Coins, e.Overflow)
+		m.inventories[i].Stock--
+		m.outlet = append(m.outlet, *e.Item)
+	case EntryCartSale:
+		indexes := make([]int, len(e.Lines))
+		for n, v := range e.Lines {
+			indexes[n] = m.slotIndex(v.Slot)
+			if indexes[n] < 0 || m.inventories[indexes[n]].Stock < v.Quantity {
+				return fmt.Errorf("no stock to sell %d in slot %s", v.Quantity, v.Slot)
+			}
+		}
+		if err := m.takeInput(e.Coins); err != nil {
+			return err
+		}
+		m.deposit(e.Coins, e.Overflow)
+		for n, v := range e.Lines {
+			m.inventories[indexes[n]].Stock -= v.Quantity
+			for q := 0; q < v.Quantity; q++ {
+				m.outlet = append(m.outlet, v.Item)
+			}
+		}
+	case EntryChangeIssued:
+		for _, c := range e.Coins {
+			if m.mainRegister[c] <= 0 {
+				return fmt.Errorf("no %s left in main register", m.Currency().Format(int(c)))
+			}
+			m.mainRegister[c]--
+		}
+		m.inputRegister = append(append([]Currency{}, e.Coins...), m.inputRegister...)
+	case EntryRefund:
+		if err := m.takeInput(e.Coins); err != nil {
+			return err
+		}
+		m.returnRegister = append(m.returnRegister, e.Coins...)
+	case EntryItemsCollected:
+		if len(e.Items) != len(m.outlet) {
+			return fmt.Errorf("%d items collected but outlet holds %d", len(e.Items), len(m.outlet))
+		}
+		m.outlet = []Item{}
+	case EntryChangeCollected:
+		if len(e.Coins) != len(m.returnRegister) {
+			return fmt.Errorf("%d coins collected but return gate holds %d", len(e.Coins), len(m.returnRegister))
+		}
+		m.returnRegister = []Currency{}
+	case EntrySlotRemoved:
+		i := m.slotIndex(e.Slot)
+		if i < 0 {
+			return fmt.Errorf("no slot %s to remove", e.Slot)
+		}
+		m.inventories = append(m.inventories[:i:i], m.inventories[i+1:]...)
+	case EntryRestocked:
+		i := m.slotIndex(e.Slot)
+		if i < 0 {
+			return fmt.Errorf("no slot %s to restock", e.Slot)
+		}
+		m.inventories[i].Stock += e.Amount
+	case EntryItemAdded:
+		if e.Inventory == nil || m.slotIndex(e.Inventory.Slot) >= 0 {
+			return fmt.Errorf("slot %s cannot be added", e.Slot)
+		}
+		m.inventories = append(m.inventories[:len(m.inventories):len(m.inventories)], *e.Inventory)
+	case EntryPriceChanged:
+		i := m.slotIndex(e.Slot)
+		if i < 0 {
+			return fmt.Errorf("no slot %s to change price", e.Slot)
+		}
+		m.inventories[i].Price = e.Amount
+	case EntryCoinsLoaded:
+		for _, c := range e.Coins {
+			m.mainRegister[c]++
+		}
+	case EntryCashWithdrawn:
+		for _, c := range e.Coins {
+			register := m.mainRegister
+			if m.Currency().IsNote(c) {
+				register = m.stacker
+			} else if m.cashBox[c] > 0 {
+				register = m.cashBox
+			}
+			if register[c] <= 0 {
+				return fmt.Errorf("no %s left to withdraw", m.Currency().Format(int(c)))
+			}
+			register[c]--
+			m.collected[c]++
+		}
+		// a withdrawal always empties the cash box and the stacker
+		if left := expandRegister(m.cashBox); len(left) > 0 {
+			return fmt.Errorf("%d coins left in the cash box", len(left))
+		}
+		if left := expandRegister(m.stacker); len(left) > 0 {
+			return fmt.Errorf("%d notes left in the stacker", len(left))
+		}
+		m.cashBox = make(map[Currency]int)
+		m.stacker = make(map[Currency]int)
+	default:
+		return fmt.Errorf("unknown entry type %s", e.Type)
+	}
+
+	switch e.Type {
+	case EntrySale, EntryCartSale, EntryCashlessSale:
+		m.transactions++
+	}
+
+	return nil
+}
+
+// deposit put coins taken for a sale back in their register,
+// overflow coins fell in the cash box
+func (m *Machine) deposit(coins, overflow []Currency) {
+	overflowed := make(map[Currency]int)
+	for _, c := range overflow {
+		overflowed[c]++
+	}
+	for _, c := range coins {
+		switch {
+		case m.Currency().IsNote(c):
+			m.stacker[c]++
+		case overflowed[c] > 0:
+			m.cashBox[c]++
+			overflowed[c]--
+		default:
+			m.mainRegister[c]++
+		}
+	}
+}
+
+// takeInput removes coins from the front of input register,
+// they must be exactly the coins found there
+func (m *Machine) takeInput(coins []Currency) error {
+	if len(coins) > len(m.inputRegister) {
+		return fmt.Errorf("input register holds only %d coins", len(m.inputRegister))
+	}
+	for i, c := range coins {
+		if m.inputRegister[i] != c {
+			return fmt.Errorf("input register holds %s instead of %s", m.Currency().Format(int(m.inputRegister[i])), m.Currency().Format(int(c)))
+		}
+	}
+	m.inputRegister = m.inputRegister[len(coins):]
+
+	return nil
+}
+
+// Recover restore the machine saved in s, entries written after the
+// state was saved, by a crash between journaling and saving,
+// are replayed on top of it
+func Recover(s Store, entries []JournalEntry, opts ...Option) (*Machine, error) {
+	m, err := Restore(s, opts...)
+	if err == ErrNoState && len(entries) > 0 {
+		return recoverFromJournal(s, entries, opts)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if len(entries) == 0 || entries[len(entries)-1].Seq <= m.journalSeq {
+		return m, nil
+	}
+	return recoverFromJournal(s, entries, opts)
+}
+
+func recoverFromJournal(s Store, entries []JournalEntry, opts []Option) (*Machine, error) {
+	m, err := Replay(entries, append(opts, WithStore(s))...)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.Save(m.state()); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
@@ -0,0 +1,217 @@
+package machine
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func createJournalTestMachine(opts ...Option) *Machine {
+	clock := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	opts = append([]Option{
+		WithNotes(10, N1000),
+		WithClock(func() time.Time {
+			clock = clock.Add(time.Second)
+			return clock
+		}),
+	}, opts...)
+
+	return New(map[Currency]int{C10: 10, C100: 4}, []Inventory{
+		Inventory{Item: Item{Name: "Item 1", Price: 120}, Stock: 5},
+	}, opts...)
+}
+
+func runJournalScenario(m *Machine) {
+	m.Insert(N1000) // rejected, cannot change 880
+	m.Insert(C500)
+	m.Insert(C10)
+	m.Buy(0)
+	m.Buy(0)
+	m.GetItems()
+	m.ReturnInput()
+	m.GetReturn()
+	m.Insert(C100)
+}
+
+func TestJournalEntries(t *testing.T) {
+	j := &MemoryJournal{}
+	m := createJournalTestMachine(WithJournal(j))
+	runJournalScenario(m)
+
+	expected := []EntryType{
+		EntryProvisioned,
+		EntryCoinRejected,
+		EntryCoinInserted,
+		EntryCoinInserted,
+		EntrySale,
+		EntryChangeIssued,
+		EntrySale,
+		EntryChangeIssued,
+		EntryItemsCollected,
+		EntryRefund,
+		EntryChangeCollected,
+		EntryCoinInserted,
+	}
+	entries := j.Entries()
+	actual := []EntryType{}
+	for i, e := range entries {
+		actual = append(actual, e.Type)
+		if e.Seq != uint64(i+1) {
+			t.Errorf("Expected entry %d seq %d, got %d", i, i+1, e.Seq)
+		}
+		if i > 0 && !e.Time.After(entries[i-1].Time) {
+			t.Errorf("Expected entry %d time after previous entry", i)
+		}
+	}
+	if !reflect.DeepEqual(expected, actual) {
+		t.Errorf("Expected entries %v, got %v", expected, actual)
+	}
+
+	sale := entries[4]
+	if sale.Item.Name != "Item 1" || sale.Amount != 120 || !reflect.DeepEqual(sale.Coins, []Currency{C500}) {
+		t.Errorf("Unexpected sale entry %+v", sale)
+	}
+	// 380 change, 3 x 100 + 8 x 10
+	if len(entries[5].Coins) != 11 {
+		t.Errorf("Expected 11 change coins, got %v", entries[5].Coins)
+	}
+}
+
+func TestJournalNothingRecordedOnFailedBuy(t *testing.T) {
+	j := &MemoryJournal{}
+	m := createJournalTestMachine(WithJournal(j))
+	m.Insert(C10)
+	m.Buy(0)
+
+	if len(j.Entries()) != 2 {
+		t.Errorf("Expected provisioned and coin inserted entries, got %+v", j.Entries())
+	}
+}
+
+func TestReplay(t *testing.T) {
+	j := &MemoryJournal{}
+	m := createJournalTestMachine(WithJournal(j))
+	runJournalScenario(m)
+
+	replayed, err := Replay(j.Entries(), WithNotes(10, N1000))
+	if err != nil {
+		t.Errorf("Expected error nil, got %v", err)
+		return
+	}
+	if !reflect.DeepEqual(m.state(), replayed.state()) {
+		t.Errorf("Expected replayed state %+v, got %+v", m.state(), replayed.state())
+	}
+}
+
+func TestReplayInvalidJournal(t *testing.T) {
+	j := &MemoryJournal{}
+	m := createJournalTestMachine(WithJournal(j))
+	runJournalScenario(m)
+	entries := j.Entries()
+
+	testCases := []struct {
+		name          string
+		entries       []JournalEntry
+		expectedError string
+	}{
+		{
+			name:          "Empty journal",
+			entries:       []JournalEntry{},
+			expectedError: "Journal must start with provisioned entry",
+		},
+		{
+			name:          "Missing entry",
+			entries:       append(append([]JournalEntry{}, entries[:3]...), entries[4:]...),
+			expectedError: "Journal entry 5: expected sequence 4",
+		},
+		{
+			name: "Sale with coins never inserted",
+			entries: func() []JournalEntry {
+				tampered := append([]JournalEntry{}, entries...)
+				tampered[4].Coins = []Currency{C100}
+				return tampered
+			}(),
+			expectedError: "Journal entry 5: input register holds 500 JPY instead of 100 JPY",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Replay(tc.entries, WithNotes(10, N1000))
+			if err == nil || err.Error() != tc.expectedError {
+				t.Errorf("Expected error '%s', got '%v'", tc.expectedError, err)
+			}
+		})
+	}
+}
+
+func TestFileJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	j, err := OpenFileJournal(path)
+	if err != nil {
+		t.Errorf("Expected error nil, got %v", err)
+		return
+	}
+	m := createJournalTestMachine(WithJournal(j))
+	runJournalScenario(m)
+	j.Close()
+
+	f, _ := os.Open(path)
+	defer f.Close()
+	entries, err := ReadJournal(f)
+	if err != nil {
+		t.Errorf("Expected error nil, got %v", err)
+		return
+	}
+	if len(entries) != 12 {
+		t.Errorf("Expected 12 entries, got %d", len(entries))
+	}
+
+	replayed, err := Replay(entries, WithNotes(10, N1000))
+	if err != nil {
+		t.Errorf("Expected error nil, got %v", err)
+		return
+	}
+	if !reflect.DeepEqual(m.state(), replayed.state()) {
+		t.Errorf("Expected replayed state %+v, got %+v", m.state(), replayed.state())
+	}
+}
+
+func TestRecoverEntriesAfterSavedState(t *testing.T) {
+	s := &failingStore{}
+	j := &MemoryJournal{}
+	m := createJournalTestMachine(WithJournal(j), WithStore(s))
+	m.Insert(C500)
+	m.Insert(C10)
+
+	// buy is journaled but the state could not be saved, like a crash
+	// between both writes
+	s.fail = true
+	if err := m.Buy(0); err != nil {
+		t.Errorf("Expected journaled buy to succeed, got %v", err)
+	}
+	s.fail = false
+	if s.saved.JournalSeq != 3 {
+		t.Errorf("Expected saved state behind the journal, got seq %d", s.saved.JournalSeq)
+	}
+
+	recovered, err := Recover(s, j.Entries(), WithNotes(10, N1000))
+	if err != nil {
+		t.Errorf("Expected error nil, got %v", err)
+		return
+	}
+	if !reflect.DeepEqual(m.state(), recovered.state()) {
+		t.Errorf("Expected journaled sale recovered %+v, got %+v", m.state(), recovered.state())
+	}
+	if s.saved.JournalSeq != 5 {
+		t.Errorf("Expected recovered state saved up to seq 5, got %d", s.saved.JournalSeq)
+	}
+
+	// state up to date with journal
+	again, err := Recover(s, j.Entries(), WithNotes(10, N1000))
+	if err != nil || !reflect.DeepEqual(again.state(), recovered.state()) {
+		t.Errorf("Expected restored state %+v, got %+v (%v)", recovered.state(), again.state(), err)
+	}
+}
@@ -0,0 +1,270 @@
+package machine
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Locale selects the language of the display and messages
+type Locale string
+
+const (
+	English  Locale = "en"
+	Japanese Locale = "ja"
+)
+
+// Locales lists the languages of the message catalog
+var Locales = []Locale{English, Japanese}
+
+// catalog translates English message formats, a format missing
+// in a locale is shown in English. Formats of the handlers are
+// kept here too so the CLI speaks one language
+var catalog = map[Locale]map[string]string{
+	Japanese: {
+		// display
+		"Change":                 "釣銭あり",
+		"Exact change only":      "釣銭切れ",
+		"Tube %d/%d":             "チューブ %d/%d",
+		"Empty":                  "なし",
+		"Sold out":               "売切",
+		"Available for purchase": "購入できます",
+		", now %s":               "、現在 %s",
+		", buy %d get %d":        "、%d個買うと%d個無料",
+		"[Cart]\t\t\t\t\t%s":     "[カート]\t\t\t\t%s",
+		"[Cart total]\t\t\t%s":   "[合計]\t\t\t\t\t%s",
+		"[Input amount]":         "[投入金額]",
+		"[Change]":               "[釣銭]",
+		"[Return gate]":          "[返却口]",
+		"[Items for sale]":       "[商品一覧]",
+		"[Cart]":                 "[カート]",
+		"[Cart total]":           "[合計]",
+		"[Outlet]":               "[取出口]",
+		"Input %s":               "投入 %s",
+		"Exact change only: %s":  "釣銭切れ: %s",
+		"Cart %d: %s":            "カート %d個: %s",
+		"Return %s":              "返却 %s",
+		"Outlet %s":              "取出口 %s",
+
+		// receipt
+		"[Receipt %s]\t\t%s":    "[レシート %s]\t\t%s",
+		"Total\t\t\t%s":         "合計\t\t\t%s",
+		"%s %d%%\t\t%s, tax %s": "%s %d%%\t\t%s、税 %s",
+		"Standard":              "標準税率",
+		"Reduced":               "軽減税率",
+		"Tax excluded\t\t%s":    "税抜\t\t\t\t%s",
+		"Paid by %s\t\t%s":      "%s払い\t\t%s",
+		", ref %s":              "、番号 %s",
+		"Change\t\t\t%s: %s":    "お釣り\t\t\t%s: %s",
+		"coins":                 "現金",
+
+		// errors
+		"Invalid inventory, please enter number from (1 to %d)": "商品番号が正しくありません、1から%dの番号を入力してください",
+		"No slot or item named %s":                              "%sという番号または商品はありません",
+		"Invalid slot %s":                                       "番号%sはありません",
+		"Only %d %s left":                                       "%[2]sは残り%[1]d個です",
+		"This item is sold out":                                 "この商品は売り切れです",
+		"Inserted money not enough to buy this item":            "投入金額が足りません",
+		"Inserted money not enough, cart total is %s":           "投入金額が足りません、カートの合計は%sです",
+		"Unable to return change":                               "お釣りを払えません",
+		"Unable to return change for %s":                        "%sのお釣りを払えません",
+		"%s is not a valid coin":                                "%sは使えないお金です",
+		"%s note is not accepted":                               "%s札は使えません",
+		"%s coin is not accepted":                               "%s硬貨は使えません",
+		"Bill stacker is full":                                  "紙幣がいっぱいです",
+		"Payment declined":                                      "決済が拒否されました",
+		"Payment timed out":                                     "決済がタイムアウトしました",
+		"Price or inserted money changed during the payment":    "決済中に価格または投入金額が変わりました",
+		"Cart is empty":                                         "カートは空です",
+		"Quantity must be positive":                             "数量は1以上にしてください",
+		"Slot %s is %w":                                         "番号%sは%w",
+		"not in the cart":                                       "カートに入っていません",
+
+		// service
+		"Restock quantity must be positive":                                      "補充数は1以上にしてください",
+		"Slot %s holds at most %d items, %d more fit":                            "番号%sには最大%d個入ります、あと%d個入ります",
+		"Slot %s is already used":                                                "番号%sはすでに使われています",
+		"Item name is required":                                                  "商品名を入力してください",
+		"Price must be positive":                                                 "価格は1以上にしてください",
+		"Stock and capacity must not be negative":                                "在庫と容量は0以上にしてください",
+		"Slot holds at most %d items":                                            "最大%d個入ります",
+		"%s is not a coin":                                                       "%sは硬貨ではありません",
+		"Number of %s coins must be positive":                                    "%s硬貨の枚数は1以上にしてください",
+		"%s tube holds at most %d coins, %d more fit":                            "%sのチューブには最大%d枚入ります、あと%d枚入ります",
+		"Wrong operator pin":                                                     "暗証番号が違います",
+		"Unable to write the audit trail: %w":                                    "監査記録を書き込めません: %w",
+		"all or the float per coin":                                              "all または硬貨ごとの釣銭準備数",
+		"Customer transaction in progress, withdraw after the money is returned": "お客様の取引中です、お金を返却してから回収してください",
+		"Invalid service command %s, type %s help for the list of commands":      "%sというサービスコマンドはありません、%s help でコマンド一覧を表示します",
+		"Maintenance mode is locked, enter %s login <pin>":                       "メンテナンスモードはロックされています、%s login <暗証番号> を入力してください",
+		"Maintenance mode, type service help for the list of commands":           "メンテナンスモードです、service help でコマンド一覧を表示します",
+		"Invalid quantity %s":                                                    "数量%sが正しくありません",
+		"Invalid number %s":                                                      "数値%sが正しくありません",
+		"Invalid price %s":                                                       "価格%sが正しくありません",
+		"Invalid coin count %s, example: 100=20":                                 "枚数%sが正しくありません、例: 100=20",
+		"a sub command":                                                          "サブコマンド",
+		"the operator pin":                                                       "暗証番号",
+		"slot and quantity":                                                      "番号と数量",
+		"slot, name, price and stock":                                            "番号、商品名、価格と在庫",
+		"slot and price":                                                         "番号と価格",
+		"at least one coin count":                                                "硬貨の枚数",
+		"Load %s":                                                                "補充 %s",
+		"nothing, the drawer is at float level":                                  "なし、釣銭は準備数に達しています",
+		"Withdrawn %d coins and notes, %s":                                       "硬貨と紙幣%d枚、%sを回収しました",
+		"[Slots]":                                                                "[商品棚]",
+		"%s. %s\t\t%s\t\tstock %s":                                               "%s. %s\t\t%s\t\t在庫 %s",
+		"[Cash]":                                                                 "[現金]",
+		"\t\tcash box %d":                                                        "\t\t金庫 %d",
+		"\t\tfloat %d":                                                           "\t\t準備数 %d",
+		", %d short":                                                             "、%d不足",
+		"Drawer\t\t%s":                                                           "釣銭\t\t%s",
+		"Cash box\t\t%s":                                                         "金庫\t\t%s",
+		"Stacker\t\t%d/%d notes, %s":                                             "紙幣\t\t%d/%d枚、%s",
+		"Collected\t\t%s":                                                        "回収済\t\t%s",
+
+		// handlers
+		"Nothing bought yet":                                "まだ何も購入していません",
+		"%s need %s, example: %s %s":                        "%sには%sが必要です、例: %s %s",
+		"at least one coin":                                 "お金",
+		"slot or item name":                                 "番号か商品名",
+		"1 to buy slot 1":                                   "1 (番号1を購入)",
+		"1 2 to add two of slot 1":                          "1 2 (番号1を2個追加)",
+		"Empty command, type help for the list of commands": "コマンドを入力してください、help でコマンド一覧を表示します",
+		"GOT Items: %s":                                     "商品: %s",
+		"GOT Changes: %s":                                   "お釣り: %s",
+		"Returned %s, %s":                                   "%sを返却しました、%s",
+		"Invalid command %s, type help for the list of commands": "%sというコマンドはありません、help でコマンド一覧を表示します",
+		"Missing closing quote %c":                               "閉じる引用符%cがありません",
+		"Unfinished escape at end of command":                    "コマンドの最後のエスケープが終わっていません",
+
+		// server
+		"Unknown payment method %s": "%sという決済方法はありません",
+
+		// terminal UI
+		"up":              "上",
+		"down":            "下",
+		"buy":             "購入",
+		"add to cart":     "カートに追加",
+		"checkout":        "会計",
+		"cancel":          "取消",
+		"take":            "取り出す",
+		"quit":            "終了",
+		"Nothing to take": "取り出すものはありません",
+	},
+}
+
+// ParseLocale returns the locale of a language tag, ex: "ja" or "ja_JP.UTF-8"
+func ParseLocale(s string) (Locale, error) {
+	tag := strings.ToLower(s)
+	if i := strings.IndexAny(tag, "_-."); i >= 0 {
+		tag = tag[:i]
+	}
+	for _, v := range Locales {
+		if string(v) == tag {
+			return v, nil
+		}
+	}
+
+	return English, fmt.Errorf("%s is not a supported locale", s)
+}
+
+// Sprintf formats the translation of format, format is
+// used as is when l has no translation
+func (l Locale) Sprintf(format string, a ...interface{}) string {
+	return fmt.Sprintf(l.Text(format), a...)
+}
+
+// Text returns the translation of s, s when l has none
+func (l Locale) Text(s string) string {
+	if v, ok := catalog[l][s]; ok {
+		return v
+	}
+	return s
+}
+
+// Localizer is implemented by errors able to tell their message
+// in another language, Error returns the English one
+type Localizer interface {
+	Localize(l Locale) string
+}
+
+// Errorf returns an error formatted like fmt.Errorf, its format is
+// translated by Localize. Error arguments are wrapped and shown in the
+// locale too, ex: Errorf("Slot %s is %w", slot, ErrNotInCart)
+func Errorf(format string, a ...interface{}) error {
+	return &catalogError{format: format, args: a}
+}
+
+type catalogError struct {
+	format string
+	args   []interface{}
+}
+
+func (e *catalogError) Error() string {
+	return e.Localize(English)
+}
+
+func (e *catalogError) Localize(l Locale) string {
+	args := make([]interface{}, len(e.args))
+	for i, v := range e.args {
+		if err, ok := v.(error); ok {
+			v = l.Message(err)
+		}
+		args[i] = v
+	}
+	return fmt.Sprintf(strings.ReplaceAll(l.Text(e.format), "%w", "%s"), args...)
+}
+
+func (e *catalogError) Unwrap() []error {
+	errs := []error{}
+	for _, v := range e.args {
+		if err, ok := v.(error); ok {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// Message returns err in l. The first Localizer in the chain of err
+// gives the message, otherwise the English message is translated
+// as a whole, ex: ErrSoldOut
+func (l Locale) Message(err error) string {
+	var v Localizer
+	if errors.As(err, &v) {
+		return v.Localize(l)
+	}
+	return l.Text(err.Error())
+}
+
+// WithLocale set the language of Display and receipts, English by default
+func WithLocale(l Locale) Option {
+	return func(m *Machine) {
+		m.locale = l
+	}
+}
+
+// Locale returns the language given by WithLocale
+func (m *Machine) Locale() Locale {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.lang()
+}
+
+// lang returns the machine locale,
+// machines built without New speak English
+func (m *Machine) lang() Locale {
+	if m.locale == "" {
+		return English
+	}
+	return m.locale
+}
+
+// LocalName returns the name of the item in l, Name when
+// the item has no translation
+func (i Item) LocalName(l Locale) string {
+	if v, ok := i.Names[l]; ok && v != "" {
+		return v
+	}
+	return i.Name
+}
@@ -0,0 +1,115 @@
+package machine
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestJapaneseDisplay(t *testing.T) {
+	m := New(map[Currency]int{C10: 9}, []Inventory{
+		Inventory{Item: Item{Name: "Canned coffee", Names: map[Locale]string{Japanese: "缶コーヒー"}, Price: 120}, Stock: 99},
+		Inventory{Item: Item{Name: "Water PET bottle", Price: 100}, Stock: 0},
+	}, WithLocale(Japanese))
+	m.AddToCart("1", 1)
+
+	expected := `
+[投入金額]				0 JPY
+[釣銭]					500 JPY			釣銭切れ
+						100 JPY			釣銭あり
+						50 JPY			釣銭あり
+						10 JPY			釣銭あり
+[返却口]				なし
+[商品一覧]
+1. 缶コーヒー		120 JPY
+2. Water PET bottle		100 JPY			売切
+[カート]				1 x 缶コーヒー		120 JPY
+[合計]					120 JPY
+[取出口]				なし
+`
+	expected = strings.TrimSpace(expected)
+
+	if expected != m.Display() {
+		t.Errorf("Expected \n%s\ngot \n%s", expected, m.Display())
+	}
+}
+
+func TestLocaleMessage(t *testing.T) {
+	m := New(map[Currency]int{}, []Inventory{
+		Inventory{Slot: "A1", Item: Item{Name: "Canned coffee", Names: map[Locale]string{Japanese: "缶コーヒー"}, Price: 120}, Stock: 1},
+	})
+	_, slotErr := m.FindSlot("tea")
+	stockErr := m.AddToCart("A1", 2)
+	cartErr := m.RemoveFromCart("A1")
+
+	testCases := []struct {
+		name     string
+		err      error
+		expected string
+	}{
+		{"Localizer", slotErr, "teaという番号または商品はありません"},
+		{"Item name", stockErr, "缶コーヒーは残り1個です"},
+		{"Wrapped", fmt.Errorf("Checkout: %w", stockErr), "缶コーヒーは残り1個です"},
+		{"Sentinel", ErrSoldOut, "この商品は売り切れです"},
+		{"Format", m.Restock("A1", 0), "補充数は1以上にしてください"},
+		{"Format error argument", cartErr, "番号A1はカートに入っていません"},
+		{"No translation", errors.New("Journal line 3"), "Journal line 3"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if actual := Japanese.Message(tc.err); actual != tc.expected {
+				t.Errorf("Expected %s, got %s", tc.expected, actual)
+			}
+		})
+	}
+
+	if !errors.Is(cartErr, ErrNotInCart) || cartErr.Error() != "Slot A1 is not in the cart" {
+		t.Errorf("Expected Slot A1 is not in the cart, got %v", cartErr)
+	}
+	if English.Message(stockErr) != stockErr.Error() || stockErr.Error() != "Only 1 Canned coffee left" {
+		t.Errorf("Expected English message, got %s", English.Message(stockErr))
+	}
+}
+
+func TestParseLocale(t *testing.T) {
+	testCases := []struct {
+		tag      string
+		expected Locale
+		valid    bool
+	}{
+		{"en", English, true},
+		{"ja", Japanese, true},
+		{"ja_JP.UTF-8", Japanese, true},
+		{"JA-jp", Japanese, true},
+		{"fr", English, false},
+	}
+
+	for _, tc := range testCases {
+		actual, err := ParseLocale(tc.tag)
+		if actual != tc.expected || (err == nil) != tc.valid {
+			t.Errorf("%s: expected %s valid %v, got %s %v", tc.tag, tc.expected, tc.valid, actual, err)
+		}
+	}
+}
+
+func TestJapaneseReceipt(t *testing.T) {
+	m := createReceiptTestMachine(WithLocale(Japanese))
+	m.Insert(C100)
+	m.Insert(C50)
+	m.BuySlot("A1")
+
+	printed := strings.Join([]string{
+		"[レシート 000001]\t\t2026-10-14 15:30:00",
+		"1 x Canned coffee\t\t120 JPY",
+		"合計\t\t\t120 JPY",
+		"軽減税率 8%\t\t120 JPY、税 8 JPY",
+		"税抜\t\t\t\t112 JPY",
+		"現金払い\t\t150 JPY",
+		"お釣り\t\t\t30 JPY: 10 JPY, 10 JPY, 10 JPY",
+	}, "\n")
+	if receipt := m.LastReceipt().String(); printed != receipt {
+		t.Errorf("Expected \n%s\ngot \n%s", printed, receipt)
+	}
+}
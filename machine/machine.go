@@ -1,23 +1,110 @@
 package machine
 
 import (
-	"fmt"
+	"strconv"
+	"sync"
+	"time"
 )
 
-func New(provision map[Currency]int, inventories []Inventory) *Machine {
-	return &Machine{
+func New(provision map[Currency]int, inventories []Inventory, opts ...Option) *Machine {
+	m := &Machine{
 		mainRegister:   provision,
 		inputRegister:  make([]Currency, 0),
 		returnRegister: make([]Currency, 0),
-		inventories:    inventories,
+		inventories:    assignSlots(inventories),
 		outlet:         make([]Item, 0),
+		currency:       DefaultCurrency,
+		now:            time.Now,
+		acceptedNotes:  make(map[Currency]bool),
+		stacker:        make(map[Currency]int),
+		cashBox:        make(map[Currency]int),
+		collected:      make(map[Currency]int),
+		lowStock:       defaultLowStock,
 	}
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+
+// Option configures optional machine hardware on New
+type Option func(*Machine)
+
+// WithCurrency set the money the machine works with, DefaultCurrency by default.
+// Provision, prices and notes are given in minor units of the currency
+func WithCurrency(currency *CurrencyDef) Option {
+	return func(m *Machine) {
+		m.currency = currency
+	}
+}
+
+// WithClock replace time.Now as the machine clock
+func WithClock(now func() time.Time) Option {
+	return func(m *Machine) {
+		m.now = now
+	}
+}
+
+// clock returns the machine time, machines built without New use
+// time.Now. Read the time only through clock
+func (m *Machine) clock() time.Time {
+	if m.now == nil {
+		return time.Now()
+	}
+	return m.now()
+}
+
+// WithCoins restrict the coin acceptor to the given coins,
+// every coin of the currency is accepted by default
+func WithCoins(coins ...Currency) Option {
+	return func(m *Machine) {
+		m.acceptedCoins = make(map[Currency]bool)
+		for _, v := range coins {
+			m.acceptedCoins[v] = true
+		}
+	}
+}
+
+// WithTubes set the number of coins each tube of main register holds,
+// a denomination missing in capacity has an unlimited tube
+func WithTubes(capacity map[Currency]int) Option {
+	return func(m *Machine) {
+		m.tubeCapacity = copyRegister(capacity)
+	}
+}
+
+// Tubes returns a copy of the tube capacities given by WithTubes
+func (m *Machine) Tubes() map[Currency]int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return copyRegister(m.tubeCapacity)
 }
 
+// WithNotes install a bill validator taking the given notes,
+// stacking up to capacity notes
+func WithNotes(capacity int, notes ...Currency) Option {
+	return func(m *Machine) {
+		m.stackerCapacity = capacity
+		for _, v := range notes {
+			m.acceptedNotes[v] = true
+		}
+	}
+}
+
+// Machine is safe for concurrent use, every exported method
+// holds mu for the whole operation
 type Machine struct {
-	// the machine drawer
+	mu sync.Mutex
+
+	// the machine drawer, one coin tube per denomination
 	// key is Currency, the value is the total. Ex:
 	mainRegister map[Currency]int
+	// coins a tube holds, unlimited when missing. Coins taken
+	// while their tube is full fall in the cash box
+	tubeCapacity map[Currency]int
+	cashBox      map[Currency]int
 
 	// money inserted to machine entered this register 1st
 	inputRegister []Currency
@@ -25,24 +112,99 @@ type Machine struct {
 	returnRegister []Currency
 	inventories    []Inventory
 	outlet         []Item
+
+	// items selected for Checkout, Item is resolved from inventories
+	cart []CartLine
+	// rules deciding the price paid at m.clock()
+	pricing Pricing
+	// tax rate in percent per category, included in prices
+	taxRates map[TaxCategory]int
+	// number of sales so far, numbering the receipts,
+	// receipt is the one of the last sale
+	transactions uint64
+	receipt      *Receipt
+
+	currency *CurrencyDef
+	// language of the display and receipts
+	locale Locale
+	// nil when every coin of the currency is accepted
+	acceptedCoins map[Currency]bool
+
+	// bill validator configuration, notes taken in Buy are kept
+	// in the stacker and never paid out as change
+	acceptedNotes   map[Currency]bool
+	stacker         map[Currency]int
+	stackerCapacity int
+
+	// coins kept in main register on collection, and the count
+	// of coins and notes collected so far
+	float     map[Currency]int
+	collected map[Currency]int
+
+	store Store
+
+	// journal receive entries recorded during a transaction,
+	// journalSeq is the sequence number of the last entry
+	journal    Journal
+	journalSeq uint64
+	pending    []JournalEntry
+	now        func() time.Time
+
+	// subscribers of the events, events are queued during a
+	// transaction and published once it is committed
+	bus      *bus
+	events   []Event
+	lowStock int
 }
 
+// Insert put c into input register when the machine is able to settle
+// every purchasable item afterwards, otherwise c is bounced to return gate
+// with *InsertError. When no item is purchasable yet the coin is always
+// accepted since a full refund hands back the very same coins
 func (m *Machine) Insert(c Currency) error {
-	// check if machine able to return
-	if (c != C10 && m.mainRegister[C10] < 9) ||
-		(c == C500 && m.mainRegister[C100] < 4) {
-		m.returnRegister = append(m.returnRegister, c)
-		return fmt.Errorf("Unable to return change")
-	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	m.inputRegister = append(m.inputRegister, c)
-	return nil
+	return m.transact(func() error {
+		err := m.checkDenomination(c)
+		if err == nil {
+			err = m.checkSettlement(c)
+		}
+		if err != nil {
+			m.returnRegister = append(m.returnRegister, c)
+			m.record(JournalEntry{Type: EntryCoinRejected, Coins: []Currency{c}})
+			m.emit(CoinRejected{Coin: c, Err: err})
+			return err
+		}
+
+		m.inputRegister = append(m.inputRegister, c)
+		m.record(JournalEntry{Type: EntryCoinInserted, Coins: []Currency{c}})
+		m.emit(CoinAccepted{Coin: c})
+		return nil
+	})
 }
 
-// index start from zero
+// index start from zero, position in the inventories given to New,
+// use BuySlot to address an item independently of its position
 // return error to check if the buy successful / not
 // (nil error for successful buy)
 func (m *Machine) Buy(i int) error {
+	_, err := m.BuyReceipt(i)
+	return err
+}
+
+// BuyReceipt is Buy returning the receipt of the sale, it is taken
+// with the sale so a concurrent buyer never gets another one
+func (m *Machine) BuyReceipt(i int) (*Receipt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.sold(m.transact(func() error {
+		return m.buy(i)
+	}))
+}
+
+func (m *Machine) buy(i int) error {
 	err := m.isAllowToBuy(i)
 	if err != nil {
 		return err
@@ -50,22 +212,9 @@ func (m *Machine) Buy(i int) error {
 
 	// for rollback purpose,
 	// transaction operation is not done on real register
-	mR, iR := m.createRegisterCopy()
-
-	// begin transaction
-	taken := 0
-	takenIdx := 0
-	for _, v := range iR {
-		taken += int(v)
-		takenIdx++
-		mR[v]++
-		if taken >= m.inventories[i].Price {
-			break
-		}
-	}
-	// deduct input, calculate change
-	iR = iR[takenIdx:]
-	mR, iR, err = calculateChange(mR, iR, taken, m.inventories[i].Price)
+	price := m.price(i)
+	r := m.createRegisterCopy()
+	err = settle(&r, price)
 	if err != nil {
 		return err
 	}
@@ -73,96 +222,238 @@ func (m *Machine) Buy(i int) error {
 	// commiting transaction and
 	// return the changes to input register to allow multiple buy
 	// stock deduction & disperse
-	m.mainRegister, m.inputRegister = mR, iR
+	m.mainRegister, m.cashBox, m.stacker, m.inputRegister = r.main, r.cashBox, r.stacker, r.input
 	m.inventories[i].Stock--
 	m.outlet = append(m.outlet, m.inventories[i].Item)
 
+	item := m.inventories[i].Item
+	m.record(JournalEntry{Type: EntrySale, Slot: m.inventories[i].Slot, Item: &item, Amount: price, Coins: r.taken, Overflow: r.overflow})
+	m.emit(ItemDispensed{Slot: m.inventories[i].Slot, Item: item})
+	if len(r.change) > 0 {
+		m.record(JournalEntry{Type: EntryChangeIssued, Coins: r.change})
+		m.emit(ChangeIssued{Coins: r.change})
+	}
+	m.issueReceipt([]ReceiptLine{m.receiptLine(i, 1)}, []Tender{Tender{Method: Coins.Name(), Amount: sumCoins(r.taken)}}, r.change)
+
 	return nil
 }
 
+// ReturnInput moves input register to return gate,
+// input register is kept when the state could not be saved
 func (m *Machine) ReturnInput() {
-	m.returnRegister = append(m.returnRegister, m.inputRegister...)
-	m.inputRegister = []Currency{}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.transact(func() error {
+		if len(m.inputRegister) > 0 {
+			m.record(JournalEntry{Type: EntryRefund, Coins: m.inputRegister})
+		}
+		m.returnRegister = append(m.returnRegister, m.inputRegister...)
+		m.inputRegister = []Currency{}
+		return nil
+	})
 }
 
+// GetItems empty the outlet, nothing is handed out
+// when the state could not be saved
 func (m *Machine) GetItems() []Item {
-	defer func() {
-		m.outlet = []Item{}
-	}()
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	return m.outlet
+	items := m.outlet
+	err := m.transact(func() error {
+		if len(items) > 0 {
+			m.record(JournalEntry{Type: EntryItemsCollected, Items: items})
+		}
+		m.outlet = []Item{}
+		return nil
+	})
+	if err != nil {
+		return []Item{}
+	}
+	return items
 }
 
+// GetReturn empty the return gate, nothing is handed out
+// when the state could not be saved
 func (m *Machine) GetReturn() []Currency {
-	defer func() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	coins := m.returnRegister
+	err := m.transact(func() error {
+		if len(coins) > 0 {
+			m.record(JournalEntry{Type: EntryChangeCollected, Coins: coins})
+		}
 		m.returnRegister = []Currency{}
-	}()
-	return m.returnRegister
+		return nil
+	})
+	if err != nil {
+		return []Currency{}
+	}
+	return coins
 }
 
 func (m *Machine) TotalInputRegister() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.totalInput()
+}
+
+func (m *Machine) totalInput() int {
+	return sumCoins(m.inputRegister)
+}
+
+func sumCoins(coins []Currency) int {
 	ttl := 0
-	for _, v := range m.inputRegister {
+	for _, v := range coins {
 		ttl += int(v)
 	}
 	return ttl
 }
 
-func (m *Machine) createRegisterCopy() (map[Currency]int, []Currency) {
-	mainRegister := make(map[Currency]int, 0)
-	inputRegister := make([]Currency, len(m.inputRegister))
+// Currency returns the money definition the machine works with
+func (m *Machine) Currency() *CurrencyDef {
+	if m.currency == nil {
+		return DefaultCurrency
+	}
+	return m.currency
+}
+
+// StackerLevel returns number of notes in bill stacker and its capacity
+func (m *Machine) StackerLevel() (int, int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.stackerLevel()
+}
 
+func (m *Machine) stackerLevel() (int, int) {
+	ttl := 0
+	for _, v := range m.stacker {
+		ttl += v
+	}
+	return ttl, m.stackerCapacity
+}
+
+func (m *Machine) createRegisterCopy() registers {
+	inputRegister := make([]Currency, len(m.inputRegister))
 	copy(inputRegister, m.inputRegister)
-	for k, v := range m.mainRegister {
-		mainRegister[k] = v
+
+	return registers{
+		main:     copyRegister(m.mainRegister),
+		cashBox:  copyRegister(m.cashBox),
+		stacker:  copyRegister(m.stacker),
+		input:    inputRegister,
+		isNote:   m.Currency().IsNote,
+		capacity: m.tubeCapacity,
 	}
+}
+
+// Accepted returns coins and notes the machine takes, smallest first
+func (m *Machine) Accepted() []Currency {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-	return mainRegister, inputRegister
+	return m.denominations()
 }
 
-func (m *Machine) isAllowToBuy(i int) error {
-	if i < 0 || i >= len(m.inventories) {
-		return fmt.Errorf("Invalid inventory, please enter number from (1 to %d)", len(m.inventories))
+// State returns a copy of every register and inventory
+func (m *Machine) State() *State {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.state()
+}
+
+// denominations returns accepted coins and notes, smallest first
+func (m *Machine) denominations() []Currency {
+	denominations := []Currency{}
+	for _, v := range m.Currency().Coins {
+		if m.acceptedCoins == nil || m.acceptedCoins[v] {
+			denominations = append(denominations, v)
+		}
+	}
+	for _, v := range m.Currency().Notes {
+		if m.acceptedNotes[v] {
+			denominations = append(denominations, v)
+		}
 	}
 
-	if m.inventories[i].Stock <= 0 {
-		return fmt.Errorf("This item is sold out")
+	return denominations
+}
+
+// checkDenomination make sure c belongs to the machine currency
+// and is accepted by the coin acceptor, a note must be accepted by the bill validator
+// and there is still room in the stacker for it
+func (m *Machine) checkDenomination(c Currency) error {
+	currency := m.Currency()
+	if currency.IsCoin(c) {
+		if m.acceptedCoins != nil && !m.acceptedCoins[c] {
+			return &InsertError{Coin: c, Reason: RejectCoinNotAccepted, currency: currency}
+		}
+		return nil
+	}
+	if !currency.IsNote(c) {
+		return &InsertError{Coin: c, Reason: RejectUnknownDenomination, currency: currency}
+	}
+	if !m.acceptedNotes[c] {
+		return &InsertError{Coin: c, Reason: RejectNoteNotAccepted, currency: currency}
 	}
 
-	ttlInput := m.TotalInputRegister()
-	if ttlInput < m.inventories[i].Price {
-		return fmt.Errorf("Inserted money not enough to buy this item")
+	stacked, capacity := m.stackerLevel()
+	for _, v := range m.inputRegister {
+		if currency.IsNote(v) {
+			stacked++
+		}
+	}
+	if stacked >= capacity {
+		return &InsertError{Coin: c, Reason: RejectStackerFull, currency: currency}
 	}
 
 	return nil
 }
 
-func calculateChange(mR map[Currency]int, iR []Currency, taken, itemPrice int) (map[Currency]int, []Currency, error) {
-	change := taken - itemPrice
-	for {
-		if change == 0 {
-			break
-		}
-
-		//prioritize C100 before C10
-		if change >= 100 && mR[C100] > 0 {
-			change -= int(C100)
-			mR[C100]--
-			iR = append([]Currency{C100}, iR...)
+// checkSettlement simulates every in stock item affordable with c added
+// to input register, on copies of the registers
+func (m *Machine) checkSettlement(c Currency) error {
+	ttlInput := m.totalInput() + int(c)
+	for i, v := range m.inventories {
+		price := m.price(i)
+		if v.Stock <= 0 || price > ttlInput {
 			continue
 		}
 
-		if mR[C10] > 0 {
-			change -= int(C10)
-			mR[C10]--
-			iR = append([]Currency{C10}, iR...)
-		} else {
-			// TODO: create unit test to prove if this condition might happen
-			// there is still remaining change
-			// but coin to return are empty
-			return mR, iR, fmt.Errorf("Unable to return change")
+		r := m.createRegisterCopy()
+		r.input = append(r.input, c)
+		if err := settle(&r, price); err != nil {
+			return &InsertError{
+				Coin:     c,
+				Reason:   RejectCannotSettle,
+				Item:     v.Item,
+				currency: m.Currency(),
+				err:      err,
+			}
 		}
 	}
 
-	return mR, iR, nil
+	return nil
+}
+
+func (m *Machine) isAllowToBuy(i int) error {
+	if i < 0 || i >= len(m.inventories) {
+		return &SlotError{Slot: strconv.Itoa(i + 1), Slots: m.slotCodes(), byPosition: true}
+	}
+
+	if m.inventories[i].Stock <= 0 {
+		return ErrSoldOut
+	}
+
+	ttlInput := m.totalInput()
+	if ttlInput < m.price(i) {
+		return &FundsError{Price: m.price(i), Inserted: ttlInput}
+	}
+
+	return nil
 }
@@ -7,97 +7,149 @@ import (
 
 const MACHINE_DISPLAY_TMPL = `
 [Input amount]			{INPUT}
-[Change]				100 JPY			{CH_100}
-						10 JPY			{CH_10}
+[Change]				{CHANGE}
 [Return gate]			{RETURN}
 [Items for sale]
-{INVENTORIES}
+{INVENTORIES}{CART}
 [Outlet]				{OUTLET}
 `
 
+// displayTemplates holds MACHINE_DISPLAY_TMPL of every locale,
+// tabs align the values at column 24 with tab stops of 4
+var displayTemplates = map[Locale]string{
+	English: MACHINE_DISPLAY_TMPL,
+	Japanese: `
+[投入金額]				{INPUT}
+[釣銭]					{CHANGE}
+[返却口]				{RETURN}
+[商品一覧]
+{INVENTORIES}{CART}
+[取出口]				{OUTLET}
+`,
+}
+
+// Display renders the machine with TabRenderer
 func (m *Machine) Display() string {
-	totalInput := m.TotalInputRegister()
-	input := fmt.Sprintf("%d %s", totalInput, CUR_SYMBOL)
+	return TabRenderer{}.Render(m.Snapshot())
+}
 
-	ch100, ch10 := m.displayChangeStatus()
-	returnStr, outletStr := m.displayReturnAndOutlet()
-	inventories := m.displayInventories(totalInput)
+// TabRenderer is the original layout of the CLI,
+// it lines up with tab stops of 4
+type TabRenderer struct{}
 
+func (TabRenderer) Render(s *Snapshot) string {
 	r := strings.NewReplacer(
-		"{INPUT}", input,
-		"{CH_100}", ch100,
-		"{CH_10}", ch10,
-		"{RETURN}", returnStr,
-		"{INVENTORIES}", inventories,
-		"{OUTLET}", outletStr,
+		"{INPUT}", s.format(s.Input),
+		"{CHANGE}", s.tabChangeStatus(),
+		"{RETURN}", s.returnGate(),
+		"{INVENTORIES}", s.tabInventories(),
+		"{CART}", s.tabCart(),
+		"{OUTLET}", s.outlet(),
 	)
 
-	return strings.TrimSpace(r.Replace(MACHINE_DISPLAY_TMPL))
-}
-
-func (m *Machine) displayChangeStatus() (string, string) {
-	ch100 := "No Change"
-	if m.mainRegister[C100] >= 4 {
-		ch100 = "Change"
+	tmpl, ok := displayTemplates[s.Locale]
+	if !ok {
+		tmpl = MACHINE_DISPLAY_TMPL
 	}
-	ch10 := "No Change"
-	if m.mainRegister[C10] >= 9 {
-		ch10 = "Change"
-	}
-
-	return ch100, ch10
+	return strings.TrimSpace(r.Replace(tmpl))
 }
 
-func (m *Machine) displayReturnAndOutlet() (string, string) {
-	returnStr := "Empty"
-	for i, v := range m.returnRegister {
+func (s *Snapshot) tabChangeStatus() string {
+	change := ""
+	for i, v := range s.Change {
 		if i != 0 {
-			returnStr += ", "
-		} else {
-			returnStr = ""
+			change += "\n\t\t\t\t\t\t"
 		}
-		returnStr += v.Str()
-	}
-	outletStr := "Empty"
-	for i, v := range m.outlet {
-		if i != 0 {
-			outletStr += ", "
-		} else {
-			outletStr = ""
+		change += fmt.Sprintf("%s\t\t\t%s", s.format(int(v.Currency)), s.changeStatus(v))
+		if v.Capacity > 0 {
+			change += "\t\t" + s.Locale.Sprintf("Tube %d/%d", v.Count, v.Capacity)
 		}
-		outletStr += v.Name
 	}
 
-	return returnStr, outletStr
+	return change
 }
 
-func (m *Machine) displayInventories(totalInput int) string {
+func (s *Snapshot) tabInventories() string {
 	inventories := ""
-	for i, v := range m.inventories {
-		status := ""
-		if v.Stock == 0 {
-			status = "Sold out"
-		} else {
-			if totalInput >= v.Price {
-				status = "Available for purchase"
-			}
-		}
-		inventories += fmt.Sprintf(
-			"%d. %s\t\t%d %s",
-			(i + 1),
-			v.Name,
-			v.Price,
-			CUR_SYMBOL,
-		)
-
-		if status != "" {
+	for i, v := range s.Items {
+		inventories += fmt.Sprintf("%s. %s\t\t%s", v.Slot, v.Name, s.price(v))
+		if status := s.itemStatus(v); status != "" {
 			inventories += fmt.Sprintf("\t\t\t%s", status)
 		}
 
-		if i != len(m.inventories)-1 {
+		if i != len(s.Items)-1 {
 			inventories += "\n"
 		}
 	}
 
 	return inventories
 }
+
+// tabCart list the cart with its running total,
+// nothing is shown while the cart is empty
+func (s *Snapshot) tabCart() string {
+	if len(s.Cart) == 0 {
+		return ""
+	}
+
+	cart := ""
+	for i, v := range s.Cart {
+		if i != 0 {
+			cart += "\n\t\t\t\t\t\t"
+		}
+		cart += fmt.Sprintf("%d x %s\t\t%s", v.Quantity, v.Name, s.format(v.Amount))
+	}
+
+	return "\n" + s.Locale.Sprintf("[Cart]\t\t\t\t\t%s", cart) + "\n" + s.Locale.Sprintf("[Cart total]\t\t\t%s", s.format(s.CartTotal))
+}
+
+func (s *Snapshot) changeStatus(v SnapshotChange) string {
+	if v.ExactChangeOnly {
+		return s.Locale.Text("Exact change only")
+	}
+	return s.Locale.Text("Change")
+}
+
+// price returns the list price first, then the price paid now and the bundle
+func (s *Snapshot) price(v SnapshotItem) string {
+	price := s.format(v.ListPrice)
+	if v.Price != v.ListPrice {
+		price += s.Locale.Sprintf(", now %s", s.format(v.Price))
+	}
+	if v.BundleBuy > 0 {
+		price += s.Locale.Sprintf(", buy %d get %d", v.BundleBuy, v.BundleFree)
+	}
+
+	return price
+}
+
+// itemStatus returns the status shown next to the item, empty when
+// the item is in stock but the inserted money does not buy it yet
+func (s *Snapshot) itemStatus(v SnapshotItem) string {
+	switch {
+	case v.Stock == 0:
+		return s.Locale.Text("Sold out")
+	case v.Available:
+		return s.Locale.Text("Available for purchase")
+	}
+	return ""
+}
+
+func (s *Snapshot) returnGate() string {
+	if len(s.ReturnGate) == 0 {
+		return s.Locale.Text("Empty")
+	}
+
+	coins := make([]string, len(s.ReturnGate))
+	for i, v := range s.ReturnGate {
+		coins[i] = s.format(int(v))
+	}
+	return strings.Join(coins, ", ")
+}
+
+func (s *Snapshot) outlet() string {
+	if len(s.Outlet) == 0 {
+		return s.Locale.Text("Empty")
+	}
+	return strings.Join(s.Outlet, ", ")
+}
@@ -1,6 +1,7 @@
 package machine
 
 import (
+	"reflect"
 	"strings"
 	"testing"
 )
@@ -8,25 +9,25 @@ import (
 func createTestDisplayMachine() *Machine {
 	return New(map[Currency]int{C10: 9}, []Inventory{
 		Inventory{
-			Item{
+			Item: Item{
 				Name:  "Canned coffee",
 				Price: 120,
 			},
-			99,
+			Stock: 99,
 		},
 		Inventory{
-			Item{
+			Item: Item{
 				Name:  "Water PET bottle",
 				Price: 100,
 			},
-			0,
+			Stock: 0,
 		},
 		Inventory{
-			Item{
+			Item: Item{
 				Name:  "Sport drinks XT",
 				Price: 150,
 			},
-			2,
+			Stock: 2,
 		},
 	})
 }
@@ -37,7 +38,9 @@ func TestInitialDisplay(t *testing.T) {
 	// initial
 	expected1 := `
 [Input amount]			0 JPY
-[Change]				100 JPY			No Change
+[Change]				500 JPY			Exact change only
+						100 JPY			Change
+						50 JPY			Change
 						10 JPY			Change
 [Return gate]			Empty
 [Items for sale]
@@ -65,7 +68,9 @@ func TestDisplayAfterInsert(t *testing.T) {
 
 	expected := `
 [Input amount]			130 JPY
-[Change]				100 JPY			Change
+[Change]				500 JPY			Change
+						100 JPY			Change
+						50 JPY			Change
 						10 JPY			Change
 [Return gate]			Empty
 [Items for sale]
@@ -81,6 +86,82 @@ func TestDisplayAfterInsert(t *testing.T) {
 	}
 }
 
+func TestChangeStatus(t *testing.T) {
+	m := createTestDisplayMachine()
+	expected := []ChangeStatus{
+		ChangeStatus{C500, true},
+		ChangeStatus{C100, false},
+		ChangeStatus{C50, false},
+		ChangeStatus{C10, false},
+	}
+	if !reflect.DeepEqual(expected, m.ChangeStatus()) {
+		t.Errorf("Expected %v, got %v", expected, m.ChangeStatus())
+	}
+
+	// 500 coin for 120 item needs 380 change
+	m.mainRegister[C100] = 3
+	if m.ChangeStatus()[0].ExactChangeOnly {
+		t.Errorf("Expected 500 JPY able to change with 3 x 100 coins")
+	}
+
+	// 50 coin for 120 item needs 30 change
+	m.mainRegister[C10] = 2
+	if !m.ChangeStatus()[2].ExactChangeOnly {
+		t.Errorf("Expected 50 JPY exact change only with 2 x 10 coins")
+	}
+	if m.ChangeStatus()[3].ExactChangeOnly {
+		t.Errorf("Expected 10 JPY never need change")
+	}
+}
+
+func TestChangeStatusWithNotes(t *testing.T) {
+	m := New(map[Currency]int{C10: 10, C50: 1, C100: 8, C500: 1}, []Inventory{
+		Inventory{Item: Item{Name: "Item 1", Price: 120}, Stock: 99},
+	}, WithNotes(10, N1000))
+
+	status := m.ChangeStatus()
+	if len(status) != 5 {
+		t.Errorf("Expected 5 denominations, got %d", len(status))
+		return
+	}
+	if status[0].Currency != N1000 || status[0].ExactChangeOnly {
+		t.Errorf("Expected 1000 JPY able to change, got %v", status[0])
+	}
+
+	m.mainRegister[C500] = 0
+	m.mainRegister[C100] = 4
+	if !m.ChangeStatus()[0].ExactChangeOnly {
+		t.Errorf("Expected 1000 JPY exact change only with 550 JPY in drawer")
+	}
+}
+
+func TestDisplayEUR(t *testing.T) {
+	m := New(map[Currency]int{5: 10, 10: 10, 20: 10, 50: 10}, []Inventory{
+		Inventory{Item: Item{Name: "Espresso", Price: 120}, Stock: 9},
+	}, WithCurrency(EUR))
+	m.Insert(Currency(100))
+	m.Insert(Currency(50))
+
+	expected := `
+[Input amount]			€1.50
+[Change]				€2.00			Change
+						€1.00			Change
+						€0.50			Change
+						€0.20			Change
+						€0.10			Change
+						€0.05			Change
+[Return gate]			Empty
+[Items for sale]
+1. Espresso		€1.20			Available for purchase
+[Outlet]				Empty
+`
+	expected = strings.TrimSpace(expected)
+
+	if expected != m.Display() {
+		t.Errorf("Expected \n%s\ngot \n%s", expected, m.Display())
+	}
+}
+
 func TestDisplayAfterBuy(t *testing.T) {
 	m := createTestDisplayMachine()
 	m.Insert(C50)
@@ -92,8 +173,10 @@ func TestDisplayAfterBuy(t *testing.T) {
 
 	expected := `
 [Input amount]			30 JPY
-[Change]				100 JPY			No Change
-						10 JPY			No Change
+[Change]				500 JPY			Exact change only
+						100 JPY			Change
+						50 JPY			Change
+						10 JPY			Change
 [Return gate]			Empty
 [Items for sale]
 1. Canned coffee		120 JPY
@@ -121,8 +204,10 @@ func TestDisplayAfterReturnAndGetItems(t *testing.T) {
 
 	expected := `
 [Input amount]			0 JPY
-[Change]				100 JPY			No Change
-						10 JPY			No Change
+[Change]				500 JPY			Exact change only
+						100 JPY			Change
+						50 JPY			Change
+						10 JPY			Change
 [Return gate]			10 JPY, 10 JPY, 10 JPY
 [Items for sale]
 1. Canned coffee		120 JPY
@@ -151,8 +236,10 @@ func TestDisplayAfterGetReturn(t *testing.T) {
 
 	expected := `
 [Input amount]			0 JPY
-[Change]				100 JPY			No Change
-						10 JPY			No Change
+[Change]				500 JPY			Exact change only
+						100 JPY			Change
+						50 JPY			Change
+						10 JPY			Change
 [Return gate]			Empty
 [Items for sale]
 1. Canned coffee		120 JPY
@@ -1,6 +1,7 @@
 package machine
 
 import (
+	"sync"
 	"testing"
 )
 
@@ -18,38 +19,44 @@ func TestMachineInsert(t *testing.T) {
 			expectedError: "",
 		},
 		{
-			name:          "Inserting 50 coin on empty machine",
+			name:          "Inserting 50 coin on machine without items",
 			m:             createEmptyMachine(),
 			input:         C50,
-			expectedError: "Unable to return change",
+			expectedError: "",
 		},
 		{
-			name:          "Inserting 50 coin on machine running out of 10 coins",
-			m:             New(map[Currency]int{C10: 5}, []Inventory{}),
+			name:          "Inserting 50 coin on empty drawer, item costs 30",
+			m:             createInsertTestMachine(map[Currency]int{}, 30),
 			input:         C50,
-			expectedError: "Unable to return change",
+			expectedError: "Unable to return change for Item 1",
+		},
+		{
+			name:          "Inserting 100 coin on empty drawer, item not yet affordable",
+			m:             createInsertTestMachine(map[Currency]int{}, 120),
+			input:         C100,
+			expectedError: "",
 		},
 		{
 			name:          "Inserting 100 coin on machine running out of 10 coins",
-			m:             New(map[Currency]int{C10: 5}, []Inventory{}),
+			m:             createInsertTestMachine(map[Currency]int{C10: 5}, 30),
 			input:         C100,
-			expectedError: "Unable to return change",
+			expectedError: "Unable to return change for Item 1",
 		},
 		{
 			name:          "Successfully Inserting 100 coin on machine",
-			m:             New(map[Currency]int{C10: 10}, []Inventory{}),
+			m:             createInsertTestMachine(map[Currency]int{C10: 7}, 30),
 			input:         C100,
 			expectedError: "",
 		},
 		{
-			name:          "Inserting 500 coin on machine running out of 100 coins",
-			m:             New(map[Currency]int{C10: 20, C100: 3}, []Inventory{}),
+			name:          "Inserting 500 coin on machine running out of 10 coins",
+			m:             createInsertTestMachine(map[Currency]int{C100: 3}, 120),
 			input:         C500,
-			expectedError: "Unable to return change",
+			expectedError: "Unable to return change for Item 1",
 		},
 		{
-			name:          "Successfully Inserting 500 coin on machine",
-			m:             New(map[Currency]int{C10: 20, C100: 5}, []Inventory{}),
+			name:          "Successfully Inserting 500 coin using every denomination for change",
+			m:             createInsertTestMachine(map[Currency]int{C10: 3, C50: 1, C100: 3}, 120),
 			input:         C500,
 			expectedError: "",
 		},
@@ -63,31 +70,226 @@ func TestMachineInsert(t *testing.T) {
 					t.Errorf("Expected no error occured, got %s", err)
 				}
 			} else {
-				if err.Error() != tc.expectedError {
-					t.Errorf("Expected error '%s', got '%s'", tc.expectedError, err.Error())
+				if err == nil || err.Error() != tc.expectedError {
+					t.Errorf("Expected error '%s', got '%v'", tc.expectedError, err)
+				}
+			}
+		})
+	}
+}
+
+func TestMachineInsertCountsInputRegister(t *testing.T) {
+	m := createInsertTestMachine(map[Currency]int{}, 120)
+	m.inputRegister = []Currency{C100}
+
+	err := m.Insert(C50)
+	if err == nil {
+		t.Errorf("Expected error not nil, got nil")
+		return
+	}
+
+	insertErr, ok := err.(*InsertError)
+	if !ok {
+		t.Errorf("Expected *InsertError, got %T", err)
+		return
+	}
+	if insertErr.Coin != C50 || insertErr.Reason != RejectCannotSettle || insertErr.Item.Name != "Item 1" {
+		t.Errorf("Unexpected reject reason %+v", insertErr)
+	}
+	if len(m.returnRegister) != 1 || m.returnRegister[0] != C50 {
+		t.Errorf("Expected rejected coin in return register, got %v", m.returnRegister)
+	}
+	if m.TotalInputRegister() != 100 {
+		t.Errorf("Expected input register total 100 got %d", m.TotalInputRegister())
+	}
+
+	m.mainRegister[C10] = 3
+	if err := m.Insert(C50); err != nil {
+		t.Errorf("Expected no error occured, got %s", err)
+	}
+}
+
+func TestMachineInsertIgnoresSoldOutItem(t *testing.T) {
+	m := createInsertTestMachine(map[Currency]int{}, 30)
+	m.inventories[0].Stock = 0
+
+	if err := m.Insert(C50); err != nil {
+		t.Errorf("Expected no error occured, got %s", err)
+	}
+}
+
+func TestMachineInsertNote(t *testing.T) {
+	testCases := []struct {
+		name          string
+		m             *Machine
+		input         Currency
+		expectedError string
+	}{
+		{
+			name:          "Inserting note without bill validator",
+			m:             createInsertTestMachine(map[Currency]int{C10: 10, C50: 1, C100: 8, C500: 1}, 120),
+			input:         N1000,
+			expectedError: "1000 JPY note is not accepted",
+		},
+		{
+			name: "Inserting note not configured on bill validator",
+			m: New(map[Currency]int{C10: 10, C50: 1, C100: 8, C500: 1}, []Inventory{},
+				WithNotes(10, N1000)),
+			input:         N5000,
+			expectedError: "5000 JPY note is not accepted",
+		},
+		{
+			name: "Inserting note when drawer cannot cover the change",
+			m: New(map[Currency]int{C10: 10, C100: 4}, []Inventory{
+				Inventory{Item: Item{Name: "Item 1", Price: 120}, Stock: 99},
+			}, WithNotes(10, N1000)),
+			input:         N1000,
+			expectedError: "Unable to return change for Item 1",
+		},
+		{
+			name: "Successfully inserting note",
+			m: New(map[Currency]int{C10: 10, C50: 1, C100: 8, C500: 1}, []Inventory{
+				Inventory{Item: Item{Name: "Item 1", Price: 120}, Stock: 99},
+			}, WithNotes(10, N1000)),
+			input:         N1000,
+			expectedError: "",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.m.Insert(tc.input)
+			if tc.expectedError == "" {
+				if err != nil {
+					t.Errorf("Expected no error occured, got %s", err)
+				}
+			} else {
+				if err == nil || err.Error() != tc.expectedError {
+					t.Errorf("Expected error '%s', got '%v'", tc.expectedError, err)
 				}
 			}
 		})
 	}
 }
 
+func TestMachineInsertNoteStackerFull(t *testing.T) {
+	m := New(map[Currency]int{}, []Inventory{}, WithNotes(2, N1000))
+	m.stacker[N1000] = 1
+
+	if err := m.Insert(N1000); err != nil {
+		t.Errorf("Expected no error occured, got %s", err)
+	}
+
+	// note waiting in input register takes the last room
+	err := m.Insert(N1000)
+	if err == nil || err.Error() != "Bill stacker is full" {
+		t.Errorf("Expected error 'Bill stacker is full', got '%v'", err)
+	}
+	if len(m.returnRegister) != 1 || m.returnRegister[0] != N1000 {
+		t.Errorf("Expected rejected note in return register, got %v", m.returnRegister)
+	}
+}
+
+func TestMachineBuyWithNote(t *testing.T) {
+	m := New(map[Currency]int{C100: 8, C500: 9}, []Inventory{
+		Inventory{Item: Item{Name: "Item 1", Price: 1200}, Stock: 99},
+	}, WithNotes(10, N1000, N5000))
+	m.inputRegister = []Currency{N1000, N5000}
+
+	if err := m.Buy(0); err != nil {
+		t.Errorf("Expected error nil, got %v", err.Error())
+	}
+	// 9 x 500 + 3 x 100
+	if m.TotalInputRegister() != 4800 {
+		t.Errorf("Expected input register total 4800 got %d", m.TotalInputRegister())
+	}
+	if m.stacker[N1000] != 1 || m.stacker[N5000] != 1 {
+		t.Errorf("Expected both notes in stacker, got %v", m.stacker)
+	}
+	if m.mainRegister[N1000] != 0 || m.mainRegister[N5000] != 0 {
+		t.Errorf("Expected no note in main register, got %v", m.mainRegister)
+	}
+	if stacked, capacity := m.StackerLevel(); stacked != 2 || capacity != 10 {
+		t.Errorf("Expected stacker level 2/10, got %d/%d", stacked, capacity)
+	}
+}
+
+func TestMachineBuyNeverChangeWithNote(t *testing.T) {
+	m := New(map[Currency]int{C100: 8, C500: 7}, []Inventory{
+		Inventory{Item: Item{Name: "Item 1", Price: 1200}, Stock: 99},
+	}, WithNotes(10, N1000, N5000))
+	m.inputRegister = []Currency{N1000, N5000}
+
+	// 4800 change would be possible using the 1000 note just taken
+	err := m.Buy(0)
+	if err == nil || err.Error() != "Unable to return change" {
+		t.Errorf("Expected error 'Unable to return change', got '%v'", err)
+	}
+	if len(m.stacker) != 0 {
+		t.Errorf("Expected failed buy not stacking notes, got %v", m.stacker)
+	}
+	if m.TotalInputRegister() != 6000 {
+		t.Errorf("Expected input register total 6000 got %d", m.TotalInputRegister())
+	}
+}
+
+func TestMachineInsertUnknownDenomination(t *testing.T) {
+	m := New(map[Currency]int{}, []Inventory{}, WithCurrency(EUR))
+
+	err := m.Insert(C500)
+	if err == nil || err.Error() != "€5.00 note is not accepted" {
+		t.Errorf("Expected error '€5.00 note is not accepted', got '%v'", err)
+	}
+
+	err = m.Insert(Currency(30))
+	if err == nil || err.Error() != "€0.30 is not a valid coin" {
+		t.Errorf("Expected error '€0.30 is not a valid coin', got '%v'", err)
+	}
+}
+
+func TestMachineBuyEUR(t *testing.T) {
+	m := New(map[Currency]int{20: 3, 50: 1}, []Inventory{
+		Inventory{Item: Item{Name: "Item 1", Price: 140}, Stock: 99},
+	}, WithCurrency(EUR), WithNotes(10, 500))
+
+	// 2 euro coin for 1.40 item, 60 cent change only possible with 3 x 20 cent
+	if err := m.Insert(Currency(200)); err != nil {
+		t.Errorf("Expected no error occured, got %s", err)
+	}
+	if err := m.Buy(0); err != nil {
+		t.Errorf("Expected error nil, got %v", err.Error())
+	}
+	if m.TotalInputRegister() != 60 || len(m.inputRegister) != 3 {
+		t.Errorf("Expected input register 3 x 20 cent coins, got %v", m.inputRegister)
+	}
+	if m.mainRegister[50] != 1 || m.mainRegister[200] != 1 {
+		t.Errorf("Unexpected main register %v", m.mainRegister)
+	}
+
+	// 5 euro note goes to stacker, 3.60 change impossible
+	err := m.Insert(Currency(500))
+	if err == nil || err.Error() != "Unable to return change for Item 1" {
+		t.Errorf("Expected error 'Unable to return change for Item 1', got '%v'", err)
+	}
+}
+
 func TestMachineBuyShouldReturnErrorOnInvalidIdx(t *testing.T) {
 	m := &Machine{
 		inputRegister: []Currency{500},
 		inventories: []Inventory{
 			Inventory{
-				Item{
+				Item: Item{
 					Name:  "Item 1",
 					Price: 100,
 				},
-				99,
+				Stock: 99,
 			},
 			Inventory{
-				Item{
+				Item: Item{
 					Name:  "Item 2",
 					Price: 110,
 				},
-				99,
+				Stock: 99,
 			},
 		},
 	}
@@ -109,18 +311,18 @@ func TestMachineBuyInsertedMoneyNotEnough(t *testing.T) {
 		inputRegister: []Currency{C100},
 		inventories: []Inventory{
 			Inventory{
-				Item{
+				Item: Item{
 					Name:  "Item 1",
 					Price: 100,
 				},
-				99,
+				Stock: 99,
 			},
 			Inventory{
-				Item{
+				Item: Item{
 					Name:  "Item 2",
 					Price: 110,
 				},
-				99,
+				Stock: 99,
 			},
 		},
 	}
@@ -137,18 +339,18 @@ func TestMachineBuyInsertedEmptyInventory(t *testing.T) {
 		inputRegister: []Currency{C100},
 		inventories: []Inventory{
 			Inventory{
-				Item{
+				Item: Item{
 					Name:  "Item 1",
 					Price: 100,
 				},
-				99,
+				Stock: 99,
 			},
 			Inventory{
-				Item{
+				Item: Item{
 					Name:  "Item 2",
 					Price: 90,
 				},
-				0,
+				Stock: 0,
 			},
 		},
 	}
@@ -165,18 +367,18 @@ func TestMachineBuySuccessful(t *testing.T) {
 		inputRegister: []Currency{C100, C100},
 		inventories: []Inventory{
 			Inventory{
-				Item{
+				Item: Item{
 					Name:  "Item 1",
 					Price: 100,
 				},
-				99,
+				Stock: 99,
 			},
 			Inventory{
-				Item{
+				Item: Item{
 					Name:  "Item 2",
 					Price: 110,
 				},
-				99,
+				Stock: 99,
 			},
 		},
 	}
@@ -212,18 +414,18 @@ func TestMachineBuySuccessfulOverpay(t *testing.T) {
 		inputRegister: []Currency{C100, C100, C100},
 		inventories: []Inventory{
 			Inventory{
-				Item{
+				Item: Item{
 					Name:  "Item 1",
 					Price: 100,
 				},
-				99,
+				Stock: 99,
 			},
 			Inventory{
-				Item{
+				Item: Item{
 					Name:  "Item 2",
 					Price: 110,
 				},
-				99,
+				Stock: 99,
 			},
 		},
 	}
@@ -259,18 +461,18 @@ func TestMachineBuySuccessfulOverpayWith500Coin(t *testing.T) {
 		inputRegister: []Currency{C100, C500},
 		inventories: []Inventory{
 			Inventory{
-				Item{
+				Item: Item{
 					Name:  "Item 1",
 					Price: 100,
 				},
-				99,
+				Stock: 99,
 			},
 			Inventory{
-				Item{
+				Item: Item{
 					Name:  "Item 2",
 					Price: 110,
 				},
-				99,
+				Stock: 99,
 			},
 		},
 	}
@@ -310,18 +512,18 @@ func TestMachineDoubleBuyOverpayWithDouble500Coins(t *testing.T) {
 		inputRegister: []Currency{C500, C500},
 		inventories: []Inventory{
 			Inventory{
-				Item{
+				Item: Item{
 					Name:  "Item 1",
 					Price: 100,
 				},
-				99,
+				Stock: 99,
 			},
 			Inventory{
-				Item{
+				Item: Item{
 					Name:  "Item 2",
 					Price: 110,
 				},
-				99,
+				Stock: 99,
 			},
 		},
 	}
@@ -391,18 +593,18 @@ func TestMachineDoubleBuyOverpayNotEnoughChangeWith500Coin(t *testing.T) {
 		inputRegister: []Currency{C500},
 		inventories: []Inventory{
 			Inventory{
-				Item{
+				Item: Item{
 					Name:  "Item 1",
 					Price: 50,
 				},
-				99,
+				Stock: 99,
 			},
 			Inventory{
-				Item{
+				Item: Item{
 					Name:  "Item 2",
 					Price: 110,
 				},
-				99,
+				Stock: 99,
 			},
 		},
 	}
@@ -466,6 +668,36 @@ func TestMachineDoubleBuyOverpayNotEnoughChangeWith500Coin(t *testing.T) {
 	}
 }
 
+func TestMachineBuyChangeWithCollected50Coin(t *testing.T) {
+	m := &Machine{
+		mainRegister:  map[Currency]int{C50: 1},
+		inputRegister: []Currency{C100},
+		inventories: []Inventory{
+			Inventory{
+				Item: Item{
+					Name:  "Item 1",
+					Price: 50,
+				},
+				Stock: 99,
+			},
+		},
+	}
+
+	err := m.Buy(0)
+	if err != nil {
+		t.Errorf("Expected error nil, got %v", err.Error())
+	}
+	if m.TotalInputRegister() != 50 {
+		t.Errorf("Expected input register total 50 got %d", m.TotalInputRegister())
+	}
+	if m.mainRegister[C50] != 0 {
+		t.Errorf("Expected main register coin 50 count 0, got %d", m.mainRegister[C50])
+	}
+	if m.mainRegister[C100] != 1 {
+		t.Errorf("Expected main register coin 100 count 1, got %d", m.mainRegister[C100])
+	}
+}
+
 func TestGetItems(t *testing.T) {
 	m := &Machine{
 		outlet: []Item{
@@ -548,6 +780,112 @@ func TestMachineTotalInputRegister(t *testing.T) {
 	}
 }
 
+// run with -race, every public method is called at once
+// and no money or item may appear or vanish
+func TestMachineConcurrentUse(t *testing.T) {
+	m := New(map[Currency]int{C10: 200, C50: 20, C100: 50}, []Inventory{
+		Inventory{Item: Item{Name: "Item 1", Price: 120}, Stock: 1000},
+	}, WithNotes(1000, N1000))
+
+	const workers = 8
+	const rounds = 200
+	coins := []Currency{C10, C50, C100, C500, N1000}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	inserted, returned, collected := 0, 0, 0
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < rounds; i++ {
+				c := coins[(w+i)%len(coins)]
+				m.Insert(c)
+				m.Buy(0)
+				m.Display()
+				m.ChangeStatus()
+				m.TotalInputRegister()
+				m.StackerLevel()
+				if i%7 == 0 {
+					m.ReturnInput()
+				}
+
+				n := 0
+				for _, v := range m.GetReturn() {
+					n += int(v)
+				}
+				items := len(m.GetItems())
+
+				mu.Lock()
+				inserted += int(c)
+				returned += n
+				collected += items
+				mu.Unlock()
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	m.ReturnInput()
+	for _, v := range m.GetReturn() {
+		returned += int(v)
+	}
+	collected += len(m.GetItems())
+
+	if collected == 0 {
+		t.Errorf("Expected some items sold")
+	}
+	if collected != 1000-m.inventories[0].Stock {
+		t.Errorf("Expected %d items collected, got %d", 1000-m.inventories[0].Stock, collected)
+	}
+
+	drawer := 0
+	for c, n := range m.mainRegister {
+		drawer += int(c) * n
+	}
+	for c, n := range m.stacker {
+		drawer += int(c) * n
+	}
+	initial := 200*10 + 20*50 + 50*100
+	if drawer-initial != collected*120 {
+		t.Errorf("Expected sales %d in drawer, got %d", collected*120, drawer-initial)
+	}
+	if inserted != returned+collected*120 {
+		t.Errorf("Expected inserted %d equal to returned %d plus sales %d", inserted, returned, collected*120)
+	}
+}
+
 func createEmptyMachine() *Machine {
 	return New(map[Currency]int{}, []Inventory{})
 }
+
+func createInsertTestMachine(drawer map[Currency]int, price int) *Machine {
+	return New(drawer, []Inventory{
+		Inventory{
+			Item: Item{
+				Name:  "Item 1",
+				Price: price,
+			},
+			Stock: 99,
+		},
+	})
+}
+
+func TestMachineWithoutClock(t *testing.T) {
+	j := &MemoryJournal{}
+	m := &Machine{
+		inputRegister: []Currency{50},
+		inventories: []Inventory{
+			Inventory{Item: Item{Name: "Item 1", Price: 100}, Stock: 1},
+		},
+		pricing: Pricing{Rules: []PriceRule{PriceRule{Percent: 50}}},
+		journal: j,
+	}
+
+	if err := m.Buy(0); err != nil {
+		t.Errorf("Expected error nil, got %v", err)
+	}
+	if entries := j.Entries(); len(entries) == 0 || entries[0].Time.IsZero() {
+		t.Errorf("Expected entries stamped with the current time, got %+v", entries)
+	}
+}
@@ -0,0 +1,303 @@
+package machine
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// ErrPaymentDeclined is returned by a PaymentMethod refusing the charge
+var ErrPaymentDeclined = errors.New("Payment declined")
+
+// ErrPaymentTimeout is returned by a PaymentMethod when the customer
+// did not complete the payment in time, nothing is charged
+var ErrPaymentTimeout = errors.New("Payment timed out")
+
+// ErrSaleChanged is returned when the price or the inserted money changed
+// while a PaymentMethod was charging, the charge is refunded
+var ErrSaleChanged = errors.New("Price or inserted money changed during the payment")
+
+// PaymentMethod takes money for a purchase outside of the coin
+// registers, like an IC card or a QR wallet
+type PaymentMethod interface {
+	// Name is journaled with the sale, ex: "ic_card"
+	Name() string
+	// Charge takes amount in minor units and returns the reference
+	// of the payment. Nothing is taken when an error is returned,
+	// a reader timing out cancels the payment before returning
+	Charge(amount int) (string, error)
+	// Refund gives back a payment made by Charge
+	Refund(reference string) error
+}
+
+// Coins settles a purchase with the money of input register,
+// BuyWith(slot, Coins) is the same as BuySlot(slot)
+var Coins PaymentMethod = coinPayment{}
+
+type coinPayment struct{}
+
+func (p coinPayment) Name() string {
+	return "coins"
+}
+
+func (p coinPayment) Charge(amount int) (string, error) {
+	return "", fmt.Errorf("Coins are paid from the input register")
+}
+
+func (p coinPayment) Refund(reference string) error {
+	return fmt.Errorf("Coins are refunded to the return gate")
+}
+
+// BuyWith buy the item in slot paid by p, inserted coins stay in
+// input register unless p is Coins. The payment is refunded when the
+// sale could not be journaled or saved, so a customer is never charged
+// for an item that was not dispensed
+func (m *Machine) BuyWith(slot string, p PaymentMethod) error {
+	if _, ok := p.(coinPayment); ok {
+		return m.BuySlot(slot)
+	}
+
+	_, err := m.cashless(slot, p, false)
+	return err
+}
+
+// BuyMixed buy the item in slot with the inserted coins, p pays the
+// shortfall when they are not enough. Coins are only taken once p approved
+// the charge, a declined or timed out payment leaves them in input register
+// to try again or return them. When the sale could not be journaled or saved
+// the coins are put back in input register and the charge is refunded
+func (m *Machine) BuyMixed(slot string, p PaymentMethod) error {
+	_, err := m.BuyMixedReceipt(slot, p)
+	return err
+}
+
+// BuyMixedReceipt is BuyMixed returning the receipt of the sale, see BuyReceipt
+func (m *Machine) BuyMixedReceipt(slot string, p PaymentMethod) (*Receipt, error) {
+	if _, ok := p.(coinPayment); ok {
+		return m.BuySlotReceipt(slot)
+	}
+
+	return m.cashless(slot, p, true)
+}
+
+// quote is what a cashless sale charges, taken before the charge
+// and compared again before the sale is committed
+type quote struct {
+	slot  string
+	coins bool
+	price int
+	// inserted money taken, and the amount due from the payment method
+	input int
+	due   int
+}
+
+// quote returns the sale of the item in slot, the inserted coins
+// pay first when coins is true
+func (m *Machine) quote(slot string, coins bool) (quote, error) {
+	i := m.slotIndex(slot)
+	if i < 0 {
+		return quote{}, m.slotError(slot)
+	}
+	if m.inventories[i].Stock <= 0 {
+		return quote{}, ErrSoldOut
+	}
+
+	q := quote{slot: slot, coins: coins, price: m.price(i)}
+	if coins {
+		q.input = m.totalInput()
+	}
+	if q.input >= q.price {
+		return q, nil
+	}
+	q.due = q.price - q.input
+
+	// every inserted coin is taken, no change is due
+	if q.input > 0 {
+		r := m.createRegisterCopy()
+		if err := settle(&r, q.input); err != nil {
+			return quote{}, err
+		}
+	}
+
+	return q, nil
+}
+
+// cashless sells the item in slot charging p. The machine is unlocked
+// while p charges so a slow or timing out reader does not block the
+// other front ends, the sale is quoted again before it is committed
+// and the charge is refunded when anything changed meanwhile
+func (m *Machine) cashless(slot string, p PaymentMethod, coins bool) (*Receipt, error) {
+	m.mu.Lock()
+	q, err := m.quote(slot, coins)
+	if err == nil && q.due == 0 {
+		// the inserted coins pay the whole price
+		defer m.mu.Unlock()
+		return m.sold(m.transact(func() error {
+			return m.buy(m.slotIndex(slot))
+		}))
+	}
+	m.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	pay := &payment{method: p}
+	if err := pay.charge(q.due); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	receipt, err := m.sold(m.transact(func() error {
+		return m.sellCashless(q, pay)
+	}))
+	m.mu.Unlock()
+
+	return receipt, pay.settle(err)
+}
+
+// sellCashless commits the sale quoted by q once pay was charged
+func (m *Machine) sellCashless(q quote, pay *payment) error {
+	now, err := m.quote(q.slot, q.coins)
+	if err != nil {
+		return err
+	}
+	if now != q {
+		return ErrSaleChanged
+	}
+
+	i := m.slotIndex(q.slot)
+	item := m.inventories[i].Item
+	tender := []Tender{}
+	entry := JournalEntry{Type: EntryCashlessSale, Slot: q.slot, Item: &item, Amount: q.price, Method: pay.method.Name(), Reference: pay.reference, Charged: q.due}
+	if q.input > 0 {
+		r := m.createRegisterCopy()
+		if err := settle(&r, q.input); err != nil {
+			return err
+		}
+		m.mainRegister, m.cashBox, m.stacker, m.inputRegister = r.main, r.cashBox, r.stacker, r.input
+		tender = append(tender, Tender{Method: Coins.Name(), Amount: q.input})
+		entry.Coins, entry.Overflow = r.taken, r.overflow
+	}
+
+	m.issueReceipt([]ReceiptLine{m.receiptLine(i, 1)}, append(tender, pay.tender(q.due)), nil)
+	m.inventories[i].Stock--
+	m.outlet = append(m.outlet, item)
+	m.record(entry)
+	m.emit(ItemDispensed{Slot: q.slot, Item: item})
+
+	return nil
+}
+
+// payment tracks a charge made during a transaction
+type payment struct {
+	method    PaymentMethod
+	reference string
+	charged   bool
+}
+
+func (p *payment) charge(amount int) error {
+	reference, err := p.method.Charge(amount)
+	if err != nil {
+		return err
+	}
+	p.reference, p.charged = reference, true
+
+	return nil
+}
+
+func (p *payment) tender(amount int) Tender {
+	return Tender{Method: p.method.Name(), Amount: amount, Reference: p.reference}
+}
+
+// settle refunds the charge when the transaction failed with err
+func (p *payment) settle(err error) error {
+	if err == nil || !p.charged {
+		return err
+	}
+	if refundErr := p.method.Refund(p.reference); refundErr != nil {
+		return fmt.Errorf("%w, refund of payment %s failed: %w", err, p.reference, refundErr)
+	}
+
+	return err
+}
+
+// CardOutcome is the answer of SimulatedReader to a charge
+type CardOutcome int
+
+const (
+	CardApprove CardOutcome = iota
+	CardDecline
+	CardTimeout
+)
+
+// SimulatedReader is a PaymentMethod answering charges with
+// the given outcomes in order, the last outcome repeats.
+// It approves everything when no outcome is given
+type SimulatedReader struct {
+	mu       sync.Mutex
+	name     string
+	outcomes []CardOutcome
+	seq      int
+	// amount charged per reference, refunded payments are removed
+	charges map[string]int
+}
+
+func NewSimulatedReader(name string, outcomes ...CardOutcome) *SimulatedReader {
+	return &SimulatedReader{
+		name:     name,
+		outcomes: outcomes,
+		charges:  make(map[string]int),
+	}
+}
+
+func (r *SimulatedReader) Name() string {
+	return r.name
+}
+
+func (r *SimulatedReader) Charge(amount int) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	outcome := CardApprove
+	if len(r.outcomes) > 0 {
+		outcome = r.outcomes[0]
+		if len(r.outcomes) > 1 {
+			r.outcomes = r.outcomes[1:]
+		}
+	}
+	switch outcome {
+	case CardDecline:
+		return "", ErrPaymentDeclined
+	case CardTimeout:
+		return "", ErrPaymentTimeout
+	}
+
+	r.seq++
+	reference := r.name + "-" + strconv.Itoa(r.seq)
+	r.charges[reference] = amount
+	return reference, nil
+}
+
+func (r *SimulatedReader) Refund(reference string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.charges[reference]; !ok {
+		return fmt.Errorf("Unknown payment %s", reference)
+	}
+	delete(r.charges, reference)
+	return nil
+}
+
+// Charged returns the total of the payments not refunded
+func (r *SimulatedReader) Charged() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ttl := 0
+	for _, v := range r.charges {
+		ttl += v
+	}
+	return ttl
+}
@@ -0,0 +1,274 @@
+package machine
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func createPaymentTestMachine(opts ...Option) *Machine {
+	return New(map[Currency]int{C10: 10, C100: 4}, []Inventory{
+		Inventory{Slot: "A1", Item: Item{Name: "Canned coffee", Price: 120}, Stock: 2},
+		Inventory{Slot: "A2", Item: Item{Name: "Water PET bottle", Price: 100}, Stock: 0},
+	}, opts...)
+}
+
+func TestBuyWith(t *testing.T) {
+	j := &MemoryJournal{}
+	m := createPaymentTestMachine(WithJournal(j))
+	reader := NewSimulatedReader("ic_card")
+	m.Insert(C100)
+
+	if err := m.BuyWith("a1", reader); err != nil {
+		t.Errorf("Expected error nil, got %v", err)
+	}
+	if reader.Charged() != 120 {
+		t.Errorf("Expected 120 charged, got %d", reader.Charged())
+	}
+	if !reflect.DeepEqual([]Item{Item{Name: "Canned coffee", Price: 120}}, m.outlet) || m.inventories[0].Stock != 1 {
+		t.Errorf("Expected item dispensed, got %v %+v", m.outlet, m.inventories[0])
+	}
+	if !reflect.DeepEqual([]Currency{C100}, m.inputRegister) {
+		t.Errorf("Expected inserted coins kept, got %v", m.inputRegister)
+	}
+
+	entries := j.Entries()
+	last := entries[len(entries)-1]
+	if last.Type != EntryCashlessSale || last.Method != "ic_card" || last.Reference != "ic_card-1" || last.Amount != 120 {
+		t.Errorf("Expected cashless sale journaled, got %+v", last)
+	}
+	replayed, err := Replay(entries)
+	if err != nil {
+		t.Errorf("Expected error nil, got %v", err)
+		return
+	}
+	if !reflect.DeepEqual(m.State(), replayed.State()) {
+		t.Errorf("Expected %+v, got %+v", m.State(), replayed.State())
+	}
+
+	// coins tender is a regular buy
+	if err := m.BuyWith("A1", Coins); err == nil || err.Error() != "Inserted money not enough to buy this item" {
+		t.Errorf("Expected coins not enough, got %v", err)
+	}
+}
+
+func TestBuyWithFailure(t *testing.T) {
+	testCases := []struct {
+		name          string
+		slot          string
+		outcome       CardOutcome
+		expectedError string
+	}{
+		{"Declined", "A1", CardDecline, "Payment declined"},
+		{"Timeout", "A1", CardTimeout, "Payment timed out"},
+		{"Sold out", "A2", CardApprove, "This item is sold out"},
+		{"Invalid slot", "B9", CardApprove, "Invalid slot B9"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			j := &MemoryJournal{}
+			m := createPaymentTestMachine(WithJournal(j))
+			m.Save()
+			before := m.State()
+			reader := NewSimulatedReader("qr", tc.outcome)
+
+			err := m.BuyWith(tc.slot, reader)
+			if err == nil || err.Error() != tc.expectedError {
+				t.Errorf("Expected error '%s', got '%v'", tc.expectedError, err)
+			}
+			if reader.Charged() != 0 {
+				t.Errorf("Expected nothing charged, got %d", reader.Charged())
+			}
+			if !reflect.DeepEqual(before, m.State()) || len(j.Entries()) != 1 {
+				t.Errorf("Expected nothing changed, got %+v %+v", m.State(), j.Entries())
+			}
+		})
+	}
+}
+
+func TestBuyWithRefundOnSaveFailure(t *testing.T) {
+	s := &failingStore{}
+	m := createPaymentTestMachine(WithStore(s))
+	s.fail = true
+	reader := NewSimulatedReader("ic_card")
+
+	if err := m.BuyWith("A1", reader); err == nil || err.Error() != "disk full" {
+		t.Errorf("Expected error 'disk full', got '%v'", err)
+	}
+	if reader.Charged() != 0 {
+		t.Errorf("Expected payment refunded, got %d charged", reader.Charged())
+	}
+	if len(m.outlet) != 0 || m.inventories[0].Stock != 2 {
+		t.Errorf("Expected sale rolled back, got %v %+v", m.outlet, m.inventories[0])
+	}
+}
+
+func TestSimulatedReaderOutcomes(t *testing.T) {
+	reader := NewSimulatedReader("ic_card", CardDecline, CardApprove)
+
+	if _, err := reader.Charge(100); err != ErrPaymentDeclined {
+		t.Errorf("Expected ErrPaymentDeclined, got %v", err)
+	}
+	for n := 0; n < 2; n++ {
+		if _, err := reader.Charge(100); err != nil {
+			t.Errorf("Expected last outcome repeated, got %v", err)
+		}
+	}
+	if err := reader.Refund("ic_card-1"); err != nil {
+		t.Errorf("Expected error nil, got %v", err)
+	}
+	if err := reader.Refund("ic_card-1"); err == nil || err.Error() != "Unknown payment ic_card-1" {
+		t.Errorf("Expected error 'Unknown payment ic_card-1', got '%v'", err)
+	}
+	if reader.Charged() != 100 {
+		t.Errorf("Expected 100 charged, got %d", reader.Charged())
+	}
+}
+
+func TestBuyMixed(t *testing.T) {
+	j := &MemoryJournal{}
+	m := createPaymentTestMachine(WithJournal(j), WithTubes(map[Currency]int{C100: 4}))
+	reader := NewSimulatedReader("ic_card")
+	m.Insert(C100)
+	m.Insert(C10)
+
+	// 110 in coins, the card pays 10, the 100 tube is full
+	if err := m.BuyMixed("A1", reader); err != nil {
+		t.Errorf("Expected error nil, got %v", err)
+	}
+	if reader.Charged() != 10 {
+		t.Errorf("Expected 10 charged, got %d", reader.Charged())
+	}
+	if len(m.inputRegister) != 0 || m.mainRegister[C10] != 11 || m.cashBox[C100] != 1 {
+		t.Errorf("Expected every coin taken, got %v %v %v", m.inputRegister, m.mainRegister, m.cashBox)
+	}
+	if len(m.outlet) != 1 || m.inventories[0].Stock != 1 {
+		t.Errorf("Expected item dispensed, got %v %+v", m.outlet, m.inventories[0])
+	}
+
+	entries := j.Entries()
+	last := entries[len(entries)-1]
+	if last.Type != EntryCashlessSale || last.Charged != 10 || last.Amount != 120 || !reflect.DeepEqual([]Currency{C100, C10}, last.Coins) {
+		t.Errorf("Expected mixed sale journaled, got %+v", last)
+	}
+	replayed, err := Replay(entries, WithTubes(map[Currency]int{C100: 4}))
+	if err != nil {
+		t.Errorf("Expected error nil, got %v", err)
+		return
+	}
+	if !reflect.DeepEqual(m.State(), replayed.State()) {
+		t.Errorf("Expected %+v, got %+v", m.State(), replayed.State())
+	}
+
+	// enough coins, the card is not charged and change is given
+	m.Insert(C100)
+	m.Insert(C100)
+	if err := m.BuyMixed("A1", reader); err != nil {
+		t.Errorf("Expected error nil, got %v", err)
+	}
+	if reader.Charged() != 10 || !reflect.DeepEqual([]Currency{C10, C10, C10, C10, C10, C10, C10, C10}, m.inputRegister) {
+		t.Errorf("Expected paid with coins only, got %d charged, input %v", reader.Charged(), m.inputRegister)
+	}
+}
+
+func TestBuyMixedFailure(t *testing.T) {
+	testCases := []struct {
+		name          string
+		outcome       CardOutcome
+		failSave      bool
+		expectedError string
+	}{
+		{"Declined", CardDecline, false, "Payment declined"},
+		{"Timeout", CardTimeout, false, "Payment timed out"},
+		{"Not saved", CardApprove, true, "disk full"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := &failingStore{}
+			m := createPaymentTestMachine(WithStore(s))
+			m.Insert(C100)
+			before := m.State()
+			s.fail = tc.failSave
+			reader := NewSimulatedReader("ic_card", tc.outcome)
+
+			err := m.BuyMixed("A1", reader)
+			if err == nil || err.Error() != tc.expectedError {
+				t.Errorf("Expected error '%s', got '%v'", tc.expectedError, err)
+			}
+			if reader.Charged() != 0 {
+				t.Errorf("Expected nothing charged, got %d", reader.Charged())
+			}
+			// the coins are still credited to the customer
+			if !reflect.DeepEqual(before, m.State()) {
+				t.Errorf("Expected %+v, got %+v", before, m.State())
+			}
+		})
+	}
+}
+
+// hookReader runs during on another goroutine while charging, it
+// fails the charge when the machine stays locked meanwhile
+type hookReader struct {
+	*SimulatedReader
+	during func()
+}
+
+func (r hookReader) Charge(amount int) (string, error) {
+	done := make(chan struct{})
+	go func() {
+		r.during()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		return "", ErrPaymentTimeout
+	}
+
+	return r.SimulatedReader.Charge(amount)
+}
+
+func TestBuyChargesUnlocked(t *testing.T) {
+	testCases := []struct {
+		name          string
+		mixed         bool
+		during        func(m *Machine)
+		expectedError error
+		expectedInput []Currency
+	}{
+		{"Nothing changed", false, func(m *Machine) { m.Snapshot() }, nil, []Currency{C100}},
+		{"Coins inserted", false, func(m *Machine) { m.Insert(C10) }, nil, []Currency{C100, C10}},
+		{"Sold out", false, func(m *Machine) {
+			m.BuyWith("A1", NewSimulatedReader("other"))
+			m.BuyWith("A1", NewSimulatedReader("other"))
+		}, ErrSoldOut, []Currency{C100}},
+		{"Mixed coins inserted", true, func(m *Machine) { m.Insert(C10) }, ErrSaleChanged, []Currency{C100, C10}},
+		{"Mixed coins returned", true, func(m *Machine) { m.ReturnInput() }, ErrSaleChanged, []Currency{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := createPaymentTestMachine()
+			m.Insert(C100)
+			reader := hookReader{NewSimulatedReader("ic_card"), func() { tc.during(m) }}
+
+			var err error
+			if tc.mixed {
+				err = m.BuyMixed("A1", reader)
+			} else {
+				err = m.BuyWith("A1", reader)
+			}
+			if err != tc.expectedError {
+				t.Errorf("Expected error %v, got %v", tc.expectedError, err)
+			}
+			if charged := reader.Charged(); (err == nil) != (charged > 0) {
+				t.Errorf("Expected a charge only for a sale, got %d charged", charged)
+			}
+			if input := m.State().InputRegister; !reflect.DeepEqual(tc.expectedInput, input) {
+				t.Errorf("Expected input %v, got %v", tc.expectedInput, input)
+			}
+		})
+	}
+}
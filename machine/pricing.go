@@ -0,0 +1,163 @@
+package machine
+
+import (
+	"strings"
+	"time"
+)
+
+// PriceRule changes the price of items during a period, a rule
+// without slots, hours, weekdays or dates applies all the time
+type PriceRule struct {
+	Name string
+	// slot codes the rule applies to, every slot when empty
+	Slots []string
+	// time of day the rule starts and ends, every hour when both
+	// are zero. A rule ending before it starts spans midnight
+	From time.Duration
+	To   time.Duration
+	// days the rule applies, every day when empty
+	Weekdays []time.Weekday
+	// period of a promotion, End excluded, unbounded when zero
+	Start time.Time
+	End   time.Time
+
+	// Price replaces the price when positive,
+	// then Percent is taken off
+	Price   int
+	Percent int
+}
+
+// Bundle gives Free more items of slot for every Buy items
+// bought together in one checkout, ex: buy 2 get 1
+type Bundle struct {
+	Slot string
+	Buy  int
+	Free int
+}
+
+// Pricing is consulted on every buy and display.
+// Matching rules apply in order, so a slot override followed by a
+// happy hour discounts the overridden price
+type Pricing struct {
+	Rules   []PriceRule
+	Bundles []Bundle
+}
+
+// WithPricing set the rules deciding the price actually paid,
+// the item price is the list price when no rule applies
+func WithPricing(p Pricing) Option {
+	return func(m *Machine) {
+		m.pricing = p
+	}
+}
+
+// Pricing returns the rules given by WithPricing
+func (m *Machine) Pricing() Pricing {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.pricing
+}
+
+// Price returns the price of one item of slot at the machine clock
+func (m *Machine) Price(slot string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.slotIndex(slot)
+	if i < 0 {
+		return 0, m.slotError(slot)
+	}
+
+	return m.price(i), nil
+}
+
+// price returns the price of inventories[i] after the matching rules,
+// a discount is rounded up to the smallest coin of the currency
+func (m *Machine) price(i int) int {
+	v := m.inventories[i]
+	price := v.Price
+	if len(m.pricing.Rules) == 0 {
+		return price
+	}
+
+	now := m.clock()
+	for _, r := range m.pricing.Rules {
+		if !r.matches(v.Slot, now) {
+			continue
+		}
+		if r.Price > 0 {
+			price = r.Price
+		}
+		if r.Percent > 0 {
+			price = roundUp(price*(100-r.Percent)/100, int(m.Currency().Coins[0]))
+		}
+	}
+
+	return price
+}
+
+// linePrice returns the price of qty items of inventories[i],
+// items given by a bundle are free
+func (m *Machine) linePrice(i, qty int) int {
+	free := 0
+	if b, ok := m.bundle(m.inventories[i].Slot); ok {
+		free = qty / (b.Buy + b.Free) * b.Free
+	}
+
+	return m.price(i) * (qty - free)
+}
+
+// bundle returns the bundle offered on slot
+func (m *Machine) bundle(slot string) (Bundle, bool) {
+	for _, b := range m.pricing.Bundles {
+		if b.Buy > 0 && b.Free > 0 && strings.EqualFold(b.Slot, slot) {
+			return b, true
+		}
+	}
+
+	return Bundle{}, false
+}
+
+func (r PriceRule) matches(slot string, t time.Time) bool {
+	if len(r.Slots) > 0 {
+		found := false
+		for _, v := range r.Slots {
+			found = found || strings.EqualFold(v, slot)
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(r.Weekdays) > 0 {
+		found := false
+		for _, v := range r.Weekdays {
+			found = found || v == t.Weekday()
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if !r.Start.IsZero() && t.Before(r.Start) {
+		return false
+	}
+	if !r.End.IsZero() && !t.Before(r.End) {
+		return false
+	}
+
+	if r.From == 0 && r.To == 0 {
+		return true
+	}
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	d := t.Sub(midnight)
+	if r.From <= r.To {
+		return d >= r.From && d < r.To
+	}
+	return d >= r.From || d < r.To
+}
+
+func roundUp(amount, unit int) int {
+	return (amount + unit - 1) / unit * unit
+}
@@ -0,0 +1,160 @@
+package machine
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testPricing = Pricing{
+	Rules: []PriceRule{
+		PriceRule{Name: "Water", Slots: []string{"A2"}, Price: 90},
+		PriceRule{Name: "Night coffee", Slots: []string{"a1"}, From: 22 * time.Hour, To: 6 * time.Hour, Price: 100},
+		PriceRule{
+			Name:  "Launch",
+			Slots: []string{"A3"},
+			Start: time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC),
+			End:   time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC),
+			Price: 130,
+		},
+		PriceRule{Name: "Happy hour", From: 15 * time.Hour, To: 17 * time.Hour, Percent: 20},
+		PriceRule{Name: "Weekend", Slots: []string{"A3"}, Weekdays: []time.Weekday{time.Saturday, time.Sunday}, Percent: 10},
+	},
+	Bundles: []Bundle{
+		Bundle{Slot: "A1", Buy: 2, Free: 1},
+	},
+}
+
+func createPricingTestMachine(now time.Time, opts ...Option) *Machine {
+	opts = append([]Option{
+		WithPricing(testPricing),
+		WithClock(func() time.Time { return now }),
+	}, opts...)
+
+	return New(map[Currency]int{C10: 20, C50: 2, C100: 5}, []Inventory{
+		Inventory{Slot: "A1", Item: Item{Name: "Canned coffee", Price: 120}, Stock: 10},
+		Inventory{Slot: "A2", Item: Item{Name: "Water PET bottle", Price: 100}, Stock: 10},
+		Inventory{Slot: "A3", Item: Item{Name: "Sport drinks XT", Price: 150}, Stock: 10},
+	}, opts...)
+}
+
+func TestPrice(t *testing.T) {
+	testCases := []struct {
+		name           string
+		now            time.Time
+		expectedPrices []int
+	}{
+		{"Wednesday morning", time.Date(2026, 10, 14, 10, 0, 0, 0, time.UTC), []int{120, 90, 130}},
+		{"Happy hour rounded up to 10", time.Date(2026, 10, 14, 15, 30, 0, 0, time.UTC), []int{100, 80, 110}},
+		{"Happy hour is over", time.Date(2026, 10, 14, 17, 0, 0, 0, time.UTC), []int{120, 90, 130}},
+		{"Night before midnight", time.Date(2026, 10, 14, 23, 0, 0, 0, time.UTC), []int{100, 90, 130}},
+		{"Night after midnight", time.Date(2026, 10, 14, 5, 59, 0, 0, time.UTC), []int{100, 90, 130}},
+		{"Weekend", time.Date(2026, 10, 17, 12, 0, 0, 0, time.UTC), []int{120, 90, 120}},
+		{"After the launch", time.Date(2026, 11, 2, 12, 0, 0, 0, time.UTC), []int{120, 90, 150}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := createPricingTestMachine(tc.now)
+			prices := []int{}
+			for _, slot := range []string{"A1", "A2", "A3"} {
+				price, err := m.Price(slot)
+				if err != nil {
+					t.Errorf("Expected error nil, got %v", err)
+				}
+				prices = append(prices, price)
+			}
+			if !reflect.DeepEqual(tc.expectedPrices, prices) {
+				t.Errorf("Expected %v, got %v", tc.expectedPrices, prices)
+			}
+		})
+	}
+
+	m := createPricingTestMachine(time.Now())
+	if _, err := m.Price("B1"); err == nil || err.Error() != "Invalid slot B1" {
+		t.Errorf("Expected error 'Invalid slot B1', got '%v'", err)
+	}
+}
+
+func TestBuyAtEffectivePrice(t *testing.T) {
+	j := &MemoryJournal{}
+	m := createPricingTestMachine(time.Date(2026, 10, 14, 15, 30, 0, 0, time.UTC), WithJournal(j))
+	m.Insert(C100)
+
+	if err := m.BuySlot("A1"); err != nil {
+		t.Errorf("Expected coffee bought for 100 during happy hour, got %v", err)
+	}
+	if m.TotalInputRegister() != 0 {
+		t.Errorf("Expected no change, got %d", m.TotalInputRegister())
+	}
+
+	entries := j.Entries()
+	if sale := entries[len(entries)-1]; sale.Type != EntrySale || sale.Amount != 100 || sale.Item.Price != 120 {
+		t.Errorf("Expected sale at 100 of the 120 item, got %+v", sale)
+	}
+	replayed, err := Replay(entries)
+	if err != nil {
+		t.Errorf("Expected error nil, got %v", err)
+		return
+	}
+	if !reflect.DeepEqual(m.State(), replayed.State()) {
+		t.Errorf("Expected %+v, got %+v", m.State(), replayed.State())
+	}
+}
+
+func TestCartBundle(t *testing.T) {
+	m := createPricingTestMachine(time.Date(2026, 10, 14, 10, 0, 0, 0, time.UTC))
+
+	testCases := []struct {
+		qty            int
+		expectedAmount int
+	}{
+		{2, 240},
+		{1, 240},
+		{1, 360},
+		{2, 480},
+	}
+	for _, tc := range testCases {
+		m.AddToCart("A1", tc.qty)
+		if lines := m.Cart(); lines[0].Amount != tc.expectedAmount {
+			t.Errorf("Expected %d coffee for %d, got %d", lines[0].Quantity, tc.expectedAmount, lines[0].Amount)
+		}
+	}
+
+	m.RemoveFromCart("A1")
+	m.AddToCart("A1", 3)
+	m.Insert(C100)
+	m.Insert(C100)
+	m.Insert(C50)
+	if err := m.Checkout(); err != nil {
+		t.Errorf("Expected error nil, got %v", err)
+	}
+	if len(m.outlet) != 3 || m.TotalInputRegister() != 10 {
+		t.Errorf("Expected 3 coffee for 240, got %v and %d change", m.outlet, m.TotalInputRegister())
+	}
+}
+
+func TestDisplayPricing(t *testing.T) {
+	m := createPricingTestMachine(time.Date(2026, 10, 14, 15, 30, 0, 0, time.UTC))
+	m.Insert(C100)
+
+	expected := `
+[Input amount]			100 JPY
+[Change]				500 JPY			Change
+						100 JPY			Change
+						50 JPY			Change
+						10 JPY			Change
+[Return gate]			Empty
+[Items for sale]
+A1. Canned coffee		120 JPY, now 100 JPY, buy 2 get 1			Available for purchase
+A2. Water PET bottle		100 JPY, now 80 JPY			Available for purchase
+A3. Sport drinks XT		150 JPY, now 110 JPY
+[Outlet]				Empty
+`
+	expected = strings.TrimSpace(expected)
+
+	if expected != m.Display() {
+		t.Errorf("Expected \n%s\ngot \n%s", expected, m.Display())
+	}
+}
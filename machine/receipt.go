@@ -0,0 +1,202 @@
+package machine
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TaxCategory selects the consumption tax rate of an item,
+// an item without category is taxed at TaxStandard
+type TaxCategory string
+
+const (
+	TaxStandard TaxCategory = "standard"
+	// TaxReduced is the rate of food and drinks in Japan
+	TaxReduced TaxCategory = "reduced"
+)
+
+// WithTaxRates set the tax rate in percent of each category, prices
+// include the tax. A category missing in rates is not taxed
+func WithTaxRates(rates map[TaxCategory]int) Option {
+	return func(m *Machine) {
+		m.taxRates = make(map[TaxCategory]int, len(rates))
+		for k, v := range rates {
+			m.taxRates[k] = v
+		}
+	}
+}
+
+// TaxRates returns a copy of the rates given by WithTaxRates
+func (m *Machine) TaxRates() map[TaxCategory]int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	rates := make(map[TaxCategory]int, len(m.taxRates))
+	for k, v := range m.taxRates {
+		rates[k] = v
+	}
+	return rates
+}
+
+// ReceiptLine is a quantity of the item in one slot, Price is the
+// price of one item and Amount of the line after bundles, tax included
+type ReceiptLine struct {
+	Slot     string      `json:"slot"`
+	Name     string      `json:"name"`
+	Quantity int         `json:"quantity"`
+	Price    int         `json:"price"`
+	Amount   int         `json:"amount"`
+	Tax      TaxCategory `json:"tax"`
+
+	names map[Locale]string
+}
+
+// TaxLine sums the lines of one tax category, Amount includes
+// the tax and Net excludes it. Tax is rounded down
+type TaxLine struct {
+	Category TaxCategory `json:"category"`
+	Rate     int         `json:"rate"`
+	Amount   int         `json:"amount"`
+	Net      int         `json:"net"`
+	Tax      int         `json:"tax"`
+}
+
+// Tender is the money one payment method paid
+type Tender struct {
+	Method    string `json:"method"`
+	Amount    int    `json:"amount"`
+	Reference string `json:"reference,omitempty"`
+}
+
+// Receipt of a sale, Total includes the tax and Net excludes it
+type Receipt struct {
+	ID     string        `json:"id"`
+	Time   time.Time     `json:"time"`
+	Lines  []ReceiptLine `json:"lines"`
+	Taxes  []TaxLine     `json:"taxes"`
+	Total  int           `json:"total"`
+	Net    int           `json:"net"`
+	Tax    int           `json:"tax"`
+	Tender []Tender      `json:"tender"`
+	// coins given back to input register
+	Change []Currency `json:"change"`
+
+	currency *CurrencyDef
+	locale   Locale
+}
+
+// LastReceipt returns the receipt of the last sale,
+// nil when nothing was sold since the machine started
+func (m *Machine) LastReceipt() *Receipt {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.receipt
+}
+
+// sold returns the receipt of a sale ending with err, nil when it failed
+func (m *Machine) sold(err error) (*Receipt, error) {
+	if err != nil {
+		return nil, err
+	}
+	return m.receipt, nil
+}
+
+// issueReceipt numbers the sale and keeps its receipt
+// as the last one, it is rolled back with the transaction
+func (m *Machine) issueReceipt(lines []ReceiptLine, tender []Tender, change []Currency) {
+	m.transactions++
+
+	r := &Receipt{
+		ID:       fmt.Sprintf("%06d", m.transactions),
+		Time:     m.clock(),
+		Lines:    lines,
+		Taxes:    []TaxLine{},
+		Tender:   tender,
+		Change:   append([]Currency{}, change...),
+		currency: m.Currency(),
+		locale:   m.locale,
+	}
+
+	categories := []TaxCategory{}
+	amounts := make(map[TaxCategory]int)
+	for _, v := range lines {
+		if _, ok := amounts[v.Tax]; !ok {
+			categories = append(categories, v.Tax)
+		}
+		amounts[v.Tax] += v.Amount
+	}
+	for _, c := range categories {
+		rate := m.taxRates[c]
+		tax := amounts[c] * rate / (100 + rate)
+		r.Taxes = append(r.Taxes, TaxLine{Category: c, Rate: rate, Amount: amounts[c], Net: amounts[c] - tax, Tax: tax})
+		r.Total += amounts[c]
+		r.Tax += tax
+	}
+	r.Net = r.Total - r.Tax
+
+	m.receipt = r
+}
+
+// receiptLine returns qty items of inventories[i] for a receipt
+func (m *Machine) receiptLine(i, qty int) ReceiptLine {
+	v := m.inventories[i]
+	tax := v.Tax
+	if tax == "" {
+		tax = TaxStandard
+	}
+
+	return ReceiptLine{Slot: v.Slot, Name: v.Name, Quantity: qty, Price: m.price(i), Amount: m.linePrice(i, qty), Tax: tax, names: v.Names}
+}
+
+// title returns the category name starting with a capital letter, in l
+func (c TaxCategory) title(l Locale) string {
+	if c == "" {
+		return ""
+	}
+	return l.Text(strings.ToUpper(string(c[:1])) + string(c[1:]))
+}
+
+// ChangeAmount returns the value of the change coins
+func (r *Receipt) ChangeAmount() int {
+	ttl := 0
+	for _, c := range r.Change {
+		ttl += int(c)
+	}
+	return ttl
+}
+
+func (r *Receipt) String() string {
+	currency := r.currency
+	if currency == nil {
+		currency = DefaultCurrency
+	}
+
+	l := r.locale
+	lines := []string{l.Sprintf("[Receipt %s]\t\t%s", r.ID, r.Time.Format("2006-01-02 15:04:05"))}
+	for _, v := range r.Lines {
+		lines = append(lines, fmt.Sprintf("%d x %s\t\t%s", v.Quantity, Item{Name: v.Name, Names: v.names}.LocalName(l), currency.Format(v.Amount)))
+	}
+	lines = append(lines, l.Sprintf("Total\t\t\t%s", currency.Format(r.Total)))
+	for _, v := range r.Taxes {
+		lines = append(lines, l.Sprintf("%s %d%%\t\t%s, tax %s", v.Category.title(l), v.Rate, currency.Format(v.Amount), currency.Format(v.Tax)))
+	}
+	lines = append(lines, l.Sprintf("Tax excluded\t\t%s", currency.Format(r.Net)))
+	for _, v := range r.Tender {
+		line := l.Sprintf("Paid by %s\t\t%s", l.Text(v.Method), currency.Format(v.Amount))
+		if v.Reference != "" {
+			line += l.Sprintf(", ref %s", v.Reference)
+		}
+		lines = append(lines, line)
+	}
+	if len(r.Change) > 0 {
+		coins := []string{}
+		for _, c := range r.Change {
+			coins = append(coins, currency.Format(int(c)))
+		}
+		lines = append(lines, l.Sprintf("Change\t\t\t%s: %s", currency.Format(r.ChangeAmount()), strings.Join(coins, ", ")))
+	}
+
+	return strings.Join(lines, "\n")
+}
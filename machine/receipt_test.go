@@ -0,0 +1,178 @@
+package machine
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func createReceiptTestMachine(opts ...Option) *Machine {
+	now := time.Date(2026, 10, 14, 15, 30, 0, 0, time.UTC)
+	opts = append([]Option{
+		WithTaxRates(map[TaxCategory]int{TaxStandard: 10, TaxReduced: 8}),
+		WithClock(func() time.Time { return now }),
+	}, opts...)
+
+	return New(map[Currency]int{C10: 20, C50: 2, C100: 5}, []Inventory{
+		Inventory{Slot: "A1", Item: Item{Name: "Canned coffee", Price: 120, Tax: TaxReduced}, Stock: 10},
+		Inventory{Slot: "B1", Item: Item{Name: "Hand towel", Price: 300}, Stock: 10},
+	}, opts...)
+}
+
+func TestBuyReceipt(t *testing.T) {
+	m := createReceiptTestMachine()
+	if m.LastReceipt() != nil {
+		t.Errorf("Expected no receipt before a sale, got %+v", m.LastReceipt())
+	}
+	m.Insert(C500)
+	m.BuySlot("A1")
+
+	receipt := m.LastReceipt()
+	expected := &Receipt{
+		ID:   "000001",
+		Time: time.Date(2026, 10, 14, 15, 30, 0, 0, time.UTC),
+		Lines: []ReceiptLine{
+			ReceiptLine{Slot: "A1", Name: "Canned coffee", Quantity: 1, Price: 120, Amount: 120, Tax: TaxReduced},
+		},
+		Taxes: []TaxLine{
+			TaxLine{Category: TaxReduced, Rate: 8, Amount: 120, Net: 112, Tax: 8},
+		},
+		Total:    120,
+		Net:      112,
+		Tax:      8,
+		Tender:   []Tender{Tender{Method: "coins", Amount: 500}},
+		Change:   []Currency{C10, C10, C10, C50, C100, C100, C100},
+		currency: JPY,
+	}
+	if !reflect.DeepEqual(expected, receipt) {
+		t.Errorf("Expected %+v, got %+v", expected, receipt)
+	}
+
+	printed := strings.Join([]string{
+		"[Receipt 000001]\t\t2026-10-14 15:30:00",
+		"1 x Canned coffee\t\t120 JPY",
+		"Total\t\t\t120 JPY",
+		"Reduced 8%\t\t120 JPY, tax 8 JPY",
+		"Tax excluded\t\t112 JPY",
+		"Paid by coins\t\t500 JPY",
+		"Change\t\t\t380 JPY: 10 JPY, 10 JPY, 10 JPY, 50 JPY, 100 JPY, 100 JPY, 100 JPY",
+	}, "\n")
+	if printed != receipt.String() {
+		t.Errorf("Expected \n%s\ngot \n%s", printed, receipt.String())
+	}
+}
+
+func TestCheckoutReceipt(t *testing.T) {
+	j := &MemoryJournal{}
+	m := createReceiptTestMachine(WithJournal(j))
+	m.Insert(C100)
+	m.Insert(C50)
+	m.BuySlot("A1")
+
+	m.AddToCart("A1", 2)
+	m.AddToCart("B1", 1)
+	m.Insert(C500)
+	m.Insert(C50)
+	if err := m.Checkout(); err != nil {
+		t.Errorf("Expected error nil, got %v", err)
+	}
+
+	// 30 change of the first sale is still inserted
+	receipt := m.LastReceipt()
+	expectedTaxes := []TaxLine{
+		TaxLine{Category: TaxReduced, Rate: 8, Amount: 240, Net: 223, Tax: 17},
+		TaxLine{Category: TaxStandard, Rate: 10, Amount: 300, Net: 273, Tax: 27},
+	}
+	if receipt.ID != "000002" || !reflect.DeepEqual(expectedTaxes, receipt.Taxes) {
+		t.Errorf("Expected receipt 000002 with taxes %+v, got %s %+v", expectedTaxes, receipt.ID, receipt.Taxes)
+	}
+	if receipt.Total != 540 || receipt.Net != 496 || receipt.Tax != 44 || receipt.ChangeAmount() != 40 {
+		t.Errorf("Expected 540 total, 496 net, 44 tax and 40 change, got %+v", receipt)
+	}
+
+	replayed, err := Replay(j.Entries())
+	if err != nil {
+		t.Errorf("Expected error nil, got %v", err)
+		return
+	}
+	if replayed.State().Transactions != 2 || !reflect.DeepEqual(m.State(), replayed.State()) {
+		t.Errorf("Expected %+v, got %+v", m.State(), replayed.State())
+	}
+}
+
+func TestMixedTenderReceipt(t *testing.T) {
+	m := createReceiptTestMachine()
+	m.Insert(C100)
+	if err := m.BuyMixed("A1", NewSimulatedReader("ic_card")); err != nil {
+		t.Errorf("Expected error nil, got %v", err)
+	}
+
+	expected := []Tender{
+		Tender{Method: "coins", Amount: 100},
+		Tender{Method: "ic_card", Amount: 20, Reference: "ic_card-1"},
+	}
+	if receipt := m.LastReceipt(); !reflect.DeepEqual(expected, receipt.Tender) || len(receipt.Change) != 0 {
+		t.Errorf("Expected %+v, got %+v", expected, receipt)
+	}
+}
+
+func TestReceiptRollback(t *testing.T) {
+	s := &failingStore{}
+	m := createReceiptTestMachine(WithStore(s))
+	m.Insert(C500)
+	m.BuySlot("A1")
+	last := m.LastReceipt()
+
+	s.fail = true
+	if err := m.BuySlot("A1"); err == nil {
+		t.Errorf("Expected save failure")
+	}
+	if m.LastReceipt() != last || m.State().Transactions != 1 {
+		t.Errorf("Expected receipt %s kept, got %+v", last.ID, m.LastReceipt())
+	}
+}
+
+func TestBuyReceiptConcurrent(t *testing.T) {
+	m := New(map[Currency]int{}, []Inventory{
+		Inventory{Slot: "A1", Item: Item{Name: "Canned coffee", Price: 100}, Stock: 10},
+		Inventory{Slot: "B1", Item: Item{Name: "Green tea", Price: 100}, Stock: 10},
+	})
+	for i := 0; i < 20; i++ {
+		m.Insert(C100)
+	}
+
+	slots := []string{"A1", "B1"}
+	receipts := make([]*Receipt, 20)
+	errs := make([]error, 20)
+	wg := sync.WaitGroup{}
+	for i := range receipts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			receipts[i], errs[i] = m.BuySlotReceipt(slots[i%2])
+		}(i)
+	}
+	wg.Wait()
+
+	ids := map[string]bool{}
+	for i, v := range receipts {
+		if errs[i] != nil {
+			t.Errorf("Expected error nil, got %v", errs[i])
+			continue
+		}
+		if ids[v.ID] {
+			t.Errorf("Expected receipt %s handed to one buyer only", v.ID)
+		}
+		ids[v.ID] = true
+		if v.Lines[0].Slot != slots[i%2] {
+			t.Errorf("Expected receipt of %s, got %s", slots[i%2], v.Lines[0].Slot)
+		}
+	}
+
+	// a failed sale has no receipt
+	if receipt, err := m.BuySlotReceipt("A1"); receipt != nil || err == nil {
+		t.Errorf("Expected no receipt and an error, got %+v and %v", receipt, err)
+	}
+}
@@ -0,0 +1,179 @@
+package machine
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Renderer turns a snapshot into what a front end shows
+type Renderer interface {
+	Render(s *Snapshot) string
+}
+
+// renderers by the name front ends select them with
+var renderers = map[string]Renderer{
+	"text":    TextRenderer{},
+	"tabs":    TabRenderer{},
+	"json":    JSONRenderer{},
+	"compact": CompactRenderer{},
+}
+
+// LookupRenderer returns the renderer named text, tabs, json or compact
+func LookupRenderer(name string) (Renderer, error) {
+	r, ok := renderers[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("%s is not a display format, use text, tabs, json or compact", name)
+	}
+
+	return r, nil
+}
+
+// TextRenderer lays the display out as a table padded with spaces,
+// it lines up on any terminal. Japanese characters count as two columns
+type TextRenderer struct{}
+
+func (TextRenderer) Render(s *Snapshot) string {
+	l := s.Locale
+	rows := [][]string{{l.Text("[Input amount]"), s.format(s.Input)}}
+	for i, v := range s.Change {
+		row := []string{"", s.format(int(v.Currency)), s.changeStatus(v)}
+		if i == 0 {
+			row[0] = l.Text("[Change]")
+		}
+		if v.Capacity > 0 {
+			row = append(row, l.Sprintf("Tube %d/%d", v.Count, v.Capacity))
+		}
+		rows = append(rows, row)
+	}
+	rows = append(rows, []string{l.Text("[Return gate]"), s.returnGate()})
+
+	rows = append(rows, []string{l.Text("[Items for sale]")})
+	for _, v := range s.Items {
+		rows = append(rows, []string{fmt.Sprintf("%s. %s", v.Slot, v.Name), s.price(v), s.itemStatus(v)})
+	}
+
+	for i, v := range s.Cart {
+		row := []string{"", fmt.Sprintf("%d x %s", v.Quantity, v.Name), s.format(v.Amount)}
+		if i == 0 {
+			row[0] = l.Text("[Cart]")
+		}
+		rows = append(rows, row)
+	}
+	if len(s.Cart) > 0 {
+		rows = append(rows, []string{l.Text("[Cart total]"), s.format(s.CartTotal)})
+	}
+	rows = append(rows, []string{l.Text("[Outlet]"), s.outlet()})
+
+	return table(rows)
+}
+
+// JSONRenderer writes the snapshot as indented JSON
+type JSONRenderer struct{}
+
+func (JSONRenderer) Render(s *Snapshot) string {
+	// a snapshot only holds strings, numbers and slices of them
+	b, _ := json.MarshalIndent(s, "", "  ")
+	return string(b)
+}
+
+// CompactRenderer writes a one line status for logs and small
+// screens, items the inserted money buys are marked with *
+type CompactRenderer struct{}
+
+func (CompactRenderer) Render(s *Snapshot) string {
+	l := s.Locale
+	parts := []string{l.Sprintf("Input %s", s.format(s.Input))}
+
+	items := []string{}
+	for _, v := range s.Items {
+		item := fmt.Sprintf("%s %s", v.Slot, s.format(v.Price))
+		switch {
+		case v.Stock == 0:
+			item = fmt.Sprintf("%s %s", v.Slot, l.Text("Sold out"))
+		case v.Available:
+			item += "*"
+		}
+		items = append(items, item)
+	}
+	if len(items) > 0 {
+		parts = append(parts, strings.Join(items, ", "))
+	}
+
+	exact := []string{}
+	for _, v := range s.Change {
+		if v.ExactChangeOnly {
+			exact = append(exact, s.format(int(v.Currency)))
+		}
+	}
+	if len(exact) > 0 {
+		parts = append(parts, l.Sprintf("Exact change only: %s", strings.Join(exact, ", ")))
+	}
+	if len(s.Cart) > 0 {
+		quantity := 0
+		for _, v := range s.Cart {
+			quantity += v.Quantity
+		}
+		parts = append(parts, l.Sprintf("Cart %d: %s", quantity, s.format(s.CartTotal)))
+	}
+	if len(s.ReturnGate) > 0 {
+		parts = append(parts, l.Sprintf("Return %s", s.returnGate()))
+	}
+	if len(s.Outlet) > 0 {
+		parts = append(parts, l.Sprintf("Outlet %s", s.outlet()))
+	}
+
+	return strings.Join(parts, " | ")
+}
+
+// table pads every column to its widest cell,
+// columns are separated by two spaces
+func table(rows [][]string) string {
+	widths := []int{}
+	for _, row := range rows {
+		for i, cell := range row {
+			if i == len(widths) {
+				widths = append(widths, 0)
+			}
+			if w := TextWidth(cell); w > widths[i] {
+				widths[i] = w
+			}
+		}
+	}
+
+	lines := make([]string, len(rows))
+	for n, row := range rows {
+		line := ""
+		for i, cell := range row {
+			if i != 0 {
+				line += "  "
+			}
+			line += cell + strings.Repeat(" ", widths[i]-TextWidth(cell))
+		}
+		lines[n] = strings.TrimRight(line, " ")
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// TextWidth returns the columns s takes on a terminal,
+// wide east asian characters take two
+func TextWidth(s string) int {
+	w := 0
+	for _, r := range s {
+		switch {
+		case r >= 0x1100 && r <= 0x115f,
+			r >= 0x2e80 && r <= 0xa4cf,
+			r >= 0xac00 && r <= 0xd7a3,
+			r >= 0xf900 && r <= 0xfaff,
+			r >= 0xfe30 && r <= 0xfe4f,
+			r >= 0xff00 && r <= 0xff60,
+			r >= 0xffe0 && r <= 0xffe6:
+			w += 2
+		default:
+			w++
+		}
+	}
+
+	return w
+}
@@ -0,0 +1,122 @@
+package machine
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func createRenderTestMachine() *Machine {
+	m := New(map[Currency]int{C10: 9}, []Inventory{
+		Inventory{Item: Item{Name: "Canned coffee", Price: 120}, Stock: 99},
+		Inventory{Item: Item{Name: "Water PET bottle", Price: 100}, Stock: 0},
+		Inventory{Item: Item{Name: "Sport drinks XT", Price: 150}, Stock: 2},
+	}, WithTubes(map[Currency]int{C10: 50}))
+	m.Insert(C100)
+	m.Insert(C10)
+	m.Insert(C10)
+	m.AddToCart("1", 1)
+
+	return m
+}
+
+func TestTextRenderer(t *testing.T) {
+	m := createRenderTestMachine()
+
+	expected := strings.Join([]string{
+		"[Input amount]       120 JPY",
+		"[Change]             500 JPY            Exact change only",
+		"                     100 JPY            Change",
+		"                     50 JPY             Change",
+		"                     10 JPY             Change                  Tube 9/50",
+		"[Return gate]        Empty",
+		"[Items for sale]",
+		"1. Canned coffee     120 JPY            Available for purchase",
+		"2. Water PET bottle  100 JPY            Sold out",
+		"3. Sport drinks XT   150 JPY",
+		"[Cart]               1 x Canned coffee  120 JPY",
+		"[Cart total]         120 JPY",
+		"[Outlet]             Empty",
+	}, "\n")
+	if actual := (TextRenderer{}).Render(m.Snapshot()); expected != actual {
+		t.Errorf("Expected \n%s\ngot \n%s", expected, actual)
+	}
+}
+
+func TestCompactRenderer(t *testing.T) {
+	m := createRenderTestMachine()
+
+	expected := "Input 120 JPY | 1 120 JPY*, 2 Sold out, 3 150 JPY | Exact change only: 500 JPY | Cart 1: 120 JPY"
+	if actual := (CompactRenderer{}).Render(m.Snapshot()); expected != actual {
+		t.Errorf("Expected %s, got %s", expected, actual)
+	}
+
+	m.Insert(Currency(30))
+	m.Buy(0)
+	expected = "Input 0 JPY | 1 120 JPY, 2 Sold out, 3 150 JPY | Exact change only: 500 JPY | Cart 1: 120 JPY | Return 30 JPY | Outlet Canned coffee"
+	if actual := (CompactRenderer{}).Render(m.Snapshot()); expected != actual {
+		t.Errorf("Expected %s, got %s", expected, actual)
+	}
+}
+
+func TestJSONRenderer(t *testing.T) {
+	m := createRenderTestMachine()
+	s := m.Snapshot()
+
+	decoded := &Snapshot{}
+	if err := json.Unmarshal([]byte((JSONRenderer{}).Render(s)), decoded); err != nil {
+		t.Errorf("Expected error nil, got %v", err)
+	}
+	decoded.currency = s.currency
+	if !reflect.DeepEqual(s, decoded) {
+		t.Errorf("Expected %+v, got %+v", s, decoded)
+	}
+}
+
+func TestDisplayUsesTabRenderer(t *testing.T) {
+	m := createRenderTestMachine()
+	if m.Display() != (TabRenderer{}).Render(m.Snapshot()) {
+		t.Errorf("Expected display rendered with tabs, got \n%s", m.Display())
+	}
+}
+
+func TestSnapshotIsACopy(t *testing.T) {
+	m := createRenderTestMachine()
+	s := m.Snapshot()
+	s.Items[0].Stock = 0
+	s.ReturnGate = append(s.ReturnGate, C500)
+
+	if m.Snapshot().Items[0].Stock != 99 || len(m.Snapshot().ReturnGate) != 0 {
+		t.Errorf("Expected machine unchanged, got %+v", m.Snapshot())
+	}
+}
+
+func TestLookupRenderer(t *testing.T) {
+	for _, name := range []string{"text", "tabs", "json", "Compact"} {
+		if _, err := LookupRenderer(name); err != nil {
+			t.Errorf("Expected renderer %s, got %v", name, err)
+		}
+	}
+	if _, err := LookupRenderer("yaml"); err == nil || err.Error() != "yaml is not a display format, use text, tabs, json or compact" {
+		t.Errorf("Expected unknown format error, got %v", err)
+	}
+}
+
+func TestTextWidth(t *testing.T) {
+	testCases := []struct {
+		text     string
+		expected int
+	}{
+		{"Canned coffee", 13},
+		{"缶コーヒー", 10},
+		{"[投入金額]", 10},
+		{"スポーツドリンクXT", 18},
+	}
+
+	for _, tc := range testCases {
+		if actual := TextWidth(tc.text); actual != tc.expected {
+			t.Errorf("%s: expected %d, got %d", tc.text, tc.expected, actual)
+		}
+	}
+}
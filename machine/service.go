@@ -0,0 +1,114 @@
+package machine
+
+import "strings"
+
+// Restock add qty items to slot, up to the slot capacity
+func (m *Machine) Restock(slot string, qty int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.slotIndex(slot)
+	if i < 0 {
+		return m.slotError(slot)
+	}
+	if qty <= 0 {
+		return Errorf("Restock quantity must be positive")
+	}
+	v := m.inventories[i]
+	if v.Capacity > 0 && v.Stock+qty > v.Capacity {
+		return Errorf("Slot %s holds at most %d items, %d more fit", v.Slot, v.Capacity, v.Capacity-v.Stock)
+	}
+
+	return m.transact(func() error {
+		m.inventories[i].Stock += qty
+		m.record(JournalEntry{Type: EntryRestocked, Slot: v.Slot, Amount: qty})
+		return nil
+	})
+}
+
+// AddItem put a new slot at the end of the inventories and returns
+// its code, inv.Slot is numbered like New when empty
+func (m *Machine) AddItem(inv Inventory) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if inv.Slot != "" && m.slotIndex(inv.Slot) >= 0 {
+		return "", Errorf("Slot %s is already used", inv.Slot)
+	}
+	if strings.TrimSpace(inv.Name) == "" {
+		return "", Errorf("Item name is required")
+	}
+	if inv.Price <= 0 {
+		return "", Errorf("Price must be positive")
+	}
+	if inv.Stock < 0 || inv.Capacity < 0 {
+		return "", Errorf("Stock and capacity must not be negative")
+	}
+	if inv.Capacity > 0 && inv.Stock > inv.Capacity {
+		return "", Errorf("Slot holds at most %d items", inv.Capacity)
+	}
+
+	inventories := assignSlots(append(m.inventories[:len(m.inventories):len(m.inventories)], inv))
+	added := inventories[len(inventories)-1]
+	err := m.transact(func() error {
+		m.inventories = inventories
+		m.record(JournalEntry{Type: EntryItemAdded, Slot: added.Slot, Inventory: &added})
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return added.Slot, nil
+}
+
+// SetPrice change the price of the item in slot
+func (m *Machine) SetPrice(slot string, price int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.slotIndex(slot)
+	if i < 0 {
+		return m.slotError(slot)
+	}
+	if price <= 0 {
+		return Errorf("Price must be positive")
+	}
+
+	return m.transact(func() error {
+		m.inventories[i].Price = price
+		m.record(JournalEntry{Type: EntryPriceChanged, Slot: m.inventories[i].Slot, Amount: price})
+		return nil
+	})
+}
+
+// LoadCoins add coins to main register, key is the coin
+// and value the number of coins loaded
+func (m *Machine) LoadCoins(coins map[Currency]int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for c, n := range coins {
+		if !m.Currency().IsCoin(c) {
+			return Errorf("%s is not a coin", m.Currency().Format(int(c)))
+		}
+		if n <= 0 {
+			return Errorf("Number of %s coins must be positive", m.Currency().Format(int(c)))
+		}
+		if capacity := m.tubeCapacity[c]; capacity > 0 && m.mainRegister[c]+n > capacity {
+			return Errorf("%s tube holds at most %d coins, %d more fit", m.Currency().Format(int(c)), capacity, capacity-m.mainRegister[c])
+		}
+	}
+
+	return m.transact(func() error {
+		m.loadCoins(coins)
+		return nil
+	})
+}
+
+func (m *Machine) loadCoins(coins map[Currency]int) {
+	for c, n := range coins {
+		m.mainRegister[c] += n
+	}
+	m.record(JournalEntry{Type: EntryCoinsLoaded, Coins: expandRegister(coins)})
+}
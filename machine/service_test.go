@@ -0,0 +1,203 @@
+package machine
+
+import (
+	"reflect"
+	"testing"
+)
+
+func createServiceTestMachine(opts ...Option) *Machine {
+	return New(map[Currency]int{C10: 20, C100: 5, C500: 2}, []Inventory{
+		Inventory{Slot: "A1", Item: Item{Name: "Canned coffee", Price: 120}, Stock: 2, Capacity: 10},
+		Inventory{Slot: "A2", Item: Item{Name: "Water PET bottle", Price: 100}, Stock: 0},
+	}, opts...)
+}
+
+func TestRestock(t *testing.T) {
+	testCases := []struct {
+		name          string
+		slot          string
+		qty           int
+		expectedError string
+		expectedStock int
+	}{
+		{"Successful", "a1", 8, "", 10},
+		{"Over capacity", "A1", 9, "Slot A1 holds at most 10 items, 8 more fit", 2},
+		{"Unlimited capacity", "A2", 50, "", 50},
+		{"Not positive", "A1", 0, "Restock quantity must be positive", 2},
+		{"Invalid slot", "B1", 1, "Invalid slot B1", 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			m := createServiceTestMachine()
+			err := m.Restock(tc.slot, tc.qty)
+			if tc.expectedError != "" {
+				if err == nil || err.Error() != tc.expectedError {
+					t.Errorf("Expected error '%s', got '%v'", tc.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("Expected error nil, got %v", err)
+			}
+			if stock := m.inventories[m.slotIndex(tc.slot)].Stock; stock != tc.expectedStock {
+				t.Errorf("Expected stock %d, got %d", tc.expectedStock, stock)
+			}
+		})
+	}
+}
+
+func TestAddItem(t *testing.T) {
+	m := createServiceTestMachine()
+
+	slot, err := m.AddItem(Inventory{Item: Item{Name: "Green tea", Price: 130}, Stock: 5})
+	if err != nil || slot != "1" {
+		t.Errorf("Expected slot 1 added, got %s %v", slot, err)
+	}
+	slot, err = m.AddItem(Inventory{Slot: "B1", Item: Item{Name: "Sport drinks XT", Price: 150}, Stock: 3, Capacity: 10})
+	if err != nil || slot != "B1" {
+		t.Errorf("Expected slot B1 added, got %s %v", slot, err)
+	}
+
+	testCases := []struct {
+		name          string
+		inv           Inventory
+		expectedError string
+	}{
+		{"Slot used", Inventory{Slot: "a1", Item: Item{Name: "Tea", Price: 100}}, "Slot a1 is already used"},
+		{"No name", Inventory{Item: Item{Name: " ", Price: 100}}, "Item name is required"},
+		{"No price", Inventory{Item: Item{Name: "Tea"}}, "Price must be positive"},
+		{"Over capacity", Inventory{Item: Item{Name: "Tea", Price: 100}, Stock: 3, Capacity: 2}, "Slot holds at most 2 items"},
+	}
+	for _, tc := range testCases {
+		if _, err := m.AddItem(tc.inv); err == nil || err.Error() != tc.expectedError {
+			t.Errorf("%s: expected error '%s', got '%v'", tc.name, tc.expectedError, err)
+		}
+	}
+
+	m.Insert(C100)
+	m.Insert(C50)
+	if err := m.BuySlot("b1"); err != nil {
+		t.Errorf("Expected added item bought, got %v", err)
+	}
+	if len(m.inventories) != 4 || m.inventories[3].Stock != 2 {
+		t.Errorf("Expected B1 stock 2, got %+v", m.inventories)
+	}
+}
+
+func TestSetPrice(t *testing.T) {
+	m := createServiceTestMachine()
+	if err := m.SetPrice("A1", 0); err == nil || err.Error() != "Price must be positive" {
+		t.Errorf("Expected error 'Price must be positive', got '%v'", err)
+	}
+	if err := m.SetPrice("A1", 100); err != nil {
+		t.Errorf("Expected error nil, got %v", err)
+	}
+
+	m.Insert(C100)
+	if err := m.BuySlot("A1"); err != nil {
+		t.Errorf("Expected A1 bought at new price, got %v", err)
+	}
+}
+
+func TestLoadCoins(t *testing.T) {
+	m := createServiceTestMachine(WithNotes(10, N1000))
+	if err := m.LoadCoins(map[Currency]int{N1000: 1}); err == nil || err.Error() != "1000 JPY is not a coin" {
+		t.Errorf("Expected error '1000 JPY is not a coin', got '%v'", err)
+	}
+	if err := m.LoadCoins(map[Currency]int{C50: 0}); err == nil || err.Error() != "Number of 50 JPY coins must be positive" {
+		t.Errorf("Expected error 'Number of 50 JPY coins must be positive', got '%v'", err)
+	}
+
+	if err := m.LoadCoins(map[Currency]int{C50: 4, C100: 5}); err != nil {
+		t.Errorf("Expected error nil, got %v", err)
+	}
+	expected := map[Currency]int{C10: 20, C50: 4, C100: 10, C500: 2}
+	if !reflect.DeepEqual(expected, m.mainRegister) {
+		t.Errorf("Expected %v, got %v", expected, m.mainRegister)
+	}
+}
+
+func TestWithdrawToFloat(t *testing.T) {
+	m := createServiceTestMachine(WithNotes(10, N1000))
+	m.stacker[N1000] = 2
+	m.Insert(C100)
+
+	if _, err := m.WithdrawToFloat(nil); err == nil {
+		t.Errorf("Expected withdraw refused with customer credit")
+	}
+	m.ReturnInput()
+
+	coins, err := m.WithdrawToFloat(map[Currency]int{C10: 15, C100: 5, C500: 0})
+	if err != nil {
+		t.Errorf("Expected error nil, got %v", err)
+	}
+	expected := []Currency{N1000, N1000, C500, C500, C10, C10, C10, C10, C10}
+	if !reflect.DeepEqual(expected, coins) {
+		t.Errorf("Expected %v, got %v", expected, coins)
+	}
+	if !reflect.DeepEqual(map[Currency]int{C10: 15, C100: 5, C500: 0}, m.mainRegister) {
+		t.Errorf("Expected drawer down to float, got %v", m.mainRegister)
+	}
+	if stacked, _ := m.StackerLevel(); stacked != 0 {
+		t.Errorf("Expected stacker emptied, got %d notes", stacked)
+	}
+
+	// denominations not given keep their coins
+	m.mainRegister[C50] = 4
+	if _, err := m.WithdrawToFloat(map[Currency]int{C10: 10}); err != nil {
+		t.Errorf("Expected error nil, got %v", err)
+	}
+	if !reflect.DeepEqual(map[Currency]int{C10: 10, C50: 4, C100: 5, C500: 0}, m.mainRegister) {
+		t.Errorf("Expected only 10 withdrawn, got %v", m.mainRegister)
+	}
+
+	// change still comes from the float
+	m.Insert(C100)
+	m.Insert(C50)
+	if err := m.BuySlot("A1"); err != nil {
+		t.Errorf("Expected A1 bought after withdraw, got %v", err)
+	}
+}
+
+func TestReplayService(t *testing.T) {
+	j := &MemoryJournal{}
+	m := createServiceTestMachine(WithJournal(j), WithNotes(10, N1000))
+	m.Restock("A2", 4)
+	m.AddItem(Inventory{Slot: "B1", Item: Item{Name: "Green tea", Price: 130}, Stock: 5})
+	m.SetPrice("A1", 110)
+	m.LoadCoins(map[Currency]int{C50: 2})
+	m.Insert(N1000)
+	m.BuySlot("B1")
+	m.ReturnInput()
+	m.WithdrawToFloat(map[Currency]int{C10: 10, C100: 2})
+
+	types := []EntryType{}
+	for _, e := range j.Entries() {
+		types = append(types, e.Type)
+	}
+	expected := []EntryType{
+		EntryProvisioned,
+		EntryRestocked,
+		EntryItemAdded,
+		EntryPriceChanged,
+		EntryCoinsLoaded,
+		EntryCoinInserted,
+		EntrySale,
+		EntryChangeIssued,
+		EntryRefund,
+		EntryCashWithdrawn,
+	}
+	if !reflect.DeepEqual(expected, types) {
+		t.Errorf("Expected %v, got %v", expected, types)
+	}
+
+	replayed, err := Replay(j.Entries(), WithNotes(10, N1000))
+	if err != nil {
+		t.Errorf("Expected error nil, got %v", err)
+		return
+	}
+	if !reflect.DeepEqual(m.State(), replayed.State()) {
+		t.Errorf("Expected %+v, got %+v", m.State(), replayed.State())
+	}
+}
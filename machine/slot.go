@@ -0,0 +1,138 @@
+package machine
+
+import (
+	"strconv"
+	"strings"
+)
+
+// assignSlots copy inventories, slots without code are numbered
+// from 1 skipping codes already taken
+func assignSlots(inventories []Inventory) []Inventory {
+	assigned := make([]Inventory, len(inventories))
+	copy(assigned, inventories)
+
+	taken := make(map[string]bool)
+	for _, v := range assigned {
+		taken[strings.ToUpper(v.Slot)] = true
+	}
+
+	next := 1
+	for i := range assigned {
+		if assigned[i].Slot != "" {
+			continue
+		}
+		for taken[strconv.Itoa(next)] {
+			next++
+		}
+		assigned[i].Slot = strconv.Itoa(next)
+		taken[assigned[i].Slot] = true
+	}
+
+	return assigned
+}
+
+// FindSlot returns the slot code matching query, either a slot code
+// or an item name, both case insensitive. When several slots hold the
+// item the first one in stock is returned
+func (m *Machine) FindSlot(query string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	query = strings.TrimSpace(query)
+	if i := m.slotIndex(query); i >= 0 {
+		return m.inventories[i].Slot, nil
+	}
+
+	found := -1
+	for i, v := range m.inventories {
+		if !strings.EqualFold(v.Name, query) {
+			continue
+		}
+		if found < 0 || (m.inventories[found].Stock <= 0 && v.Stock > 0) {
+			found = i
+		}
+	}
+	if found < 0 {
+		return "", &SlotError{Slot: query, Slots: m.slotCodes(), byName: true}
+	}
+
+	return m.inventories[found].Slot, nil
+}
+
+// SlotAt returns the slot code of the item at position on the display,
+// from 1 like Buy
+func (m *Machine) SlotAt(position int) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if position < 1 || position > len(m.inventories) {
+		return "", &SlotError{Slot: strconv.Itoa(position), Slots: m.slotCodes(), byPosition: true}
+	}
+
+	return m.inventories[position-1].Slot, nil
+}
+
+// BuySlot buy the item in slot, see Buy
+func (m *Machine) BuySlot(slot string) error {
+	_, err := m.BuySlotReceipt(slot)
+	return err
+}
+
+// BuySlotReceipt is BuySlot returning the receipt of the sale, see BuyReceipt
+func (m *Machine) BuySlotReceipt(slot string) (*Receipt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.slotIndex(slot)
+	if i < 0 {
+		return nil, m.slotError(slot)
+	}
+
+	return m.sold(m.transact(func() error {
+		return m.buy(i)
+	}))
+}
+
+// RemoveSlot take slot and its stock out of the machine,
+// codes of the other slots are kept
+func (m *Machine) RemoveSlot(slot string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i := m.slotIndex(slot)
+	if i < 0 {
+		return m.slotError(slot)
+	}
+
+	return m.transact(func() error {
+		m.record(JournalEntry{Type: EntrySlotRemoved, Slot: m.inventories[i].Slot})
+		m.inventories = append(m.inventories[:i:i], m.inventories[i+1:]...)
+		return nil
+	})
+}
+
+// slotIndex returns the position of slot code, -1 when not found
+func (m *Machine) slotIndex(slot string) int {
+	for i, v := range m.inventories {
+		if strings.EqualFold(v.Slot, slot) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// slotCodes returns the code of every slot in display order
+func (m *Machine) slotCodes() []string {
+	codes := make([]string, 0, len(m.inventories))
+	for _, v := range m.inventories {
+		codes = append(codes, v.Slot)
+	}
+
+	return codes
+}
+
+// slotError returns the error for a slot code matching no slot
+func (m *Machine) slotError(slot string) error {
+	return &SlotError{Slot: slot, Slots: m.slotCodes()}
+}
@@ -0,0 +1,130 @@
+package machine
+
+import (
+	"reflect"
+	"testing"
+)
+
+func createSlotTestMachine(opts ...Option) *Machine {
+	return New(map[Currency]int{C10: 20, C100: 4}, []Inventory{
+		Inventory{Slot: "A1", Item: Item{Name: "Canned coffee", Price: 120}, Stock: 0},
+		Inventory{Item: Item{Name: "Water PET bottle", Price: 100}, Stock: 3},
+		Inventory{Slot: "B1", Item: Item{Name: "Canned coffee", Price: 120}, Stock: 2},
+		Inventory{Slot: "1", Item: Item{Name: "Sport drinks XT", Price: 150}, Stock: 1},
+	}, opts...)
+}
+
+func TestAssignSlots(t *testing.T) {
+	inventories := []Inventory{
+		Inventory{Item: Item{Name: "Item 1"}},
+		Inventory{Slot: "2", Item: Item{Name: "Item 2"}},
+		Inventory{Item: Item{Name: "Item 3"}},
+	}
+
+	slots := []string{}
+	for _, v := range assignSlots(inventories) {
+		slots = append(slots, v.Slot)
+	}
+	if !reflect.DeepEqual([]string{"1", "2", "3"}, slots) {
+		t.Errorf("Expected slots [1 2 3], got %v", slots)
+	}
+	if inventories[0].Slot != "" {
+		t.Errorf("Expected inventories not modified, got slot %s", inventories[0].Slot)
+	}
+}
+
+func TestFindSlot(t *testing.T) {
+	m := createSlotTestMachine()
+
+	testCases := []struct {
+		name          string
+		query         string
+		expectedSlot  string
+		expectedError string
+	}{
+		{"Slot code", "B1", "B1", ""},
+		{"Slot code case insensitive", "a1", "A1", ""},
+		{"Numbered slot", "2", "2", ""},
+		{"Slot code before name", "1", "1", ""},
+		{"Item name", "water pet bottle", "2", ""},
+		{"Item name in stock first", "CANNED COFFEE", "B1", ""},
+		{"Unknown", "Tea", "", "No slot or item named Tea"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			slot, err := m.FindSlot(tc.query)
+			if tc.expectedError != "" {
+				if err == nil || err.Error() != tc.expectedError {
+					t.Errorf("Expected error '%s', got '%v'", tc.expectedError, err)
+				}
+				return
+			}
+			if err != nil || slot != tc.expectedSlot {
+				t.Errorf("Expected slot %s, got %s %v", tc.expectedSlot, slot, err)
+			}
+		})
+	}
+}
+
+func TestSlotAt(t *testing.T) {
+	m := createSlotTestMachine()
+
+	for position, expected := range map[int]string{1: "A1", 2: "2", 4: "1"} {
+		if slot, err := m.SlotAt(position); err != nil || slot != expected {
+			t.Errorf("Expected slot %s at %d, got %s %v", expected, position, slot, err)
+		}
+	}
+	for _, position := range []int{0, 5} {
+		if _, err := m.SlotAt(position); err == nil || err.Error() != "Invalid inventory, please enter number from (1 to 4)" {
+			t.Errorf("Expected invalid position %d, got %v", position, err)
+		}
+	}
+}
+
+func TestBuySlotAfterRemove(t *testing.T) {
+	m := createSlotTestMachine()
+	if err := m.RemoveSlot("2"); err != nil {
+		t.Errorf("Expected error nil, got %v", err)
+	}
+	if err := m.RemoveSlot("2"); err == nil || err.Error() != "Invalid slot 2" {
+		t.Errorf("Expected error 'Invalid slot 2', got '%v'", err)
+	}
+
+	m.Insert(C100)
+	m.Insert(C100)
+	if err := m.BuySlot("b1"); err != nil {
+		t.Errorf("Expected error nil, got %v", err)
+	}
+	if err := m.BuySlot("2"); err == nil || err.Error() != "Invalid slot 2" {
+		t.Errorf("Expected error 'Invalid slot 2', got '%v'", err)
+	}
+
+	items := m.GetItems()
+	if !reflect.DeepEqual([]Item{Item{Name: "Canned coffee", Price: 120}}, items) {
+		t.Errorf("Expected canned coffee from B1, got %v", items)
+	}
+	if stock := m.inventories[1].Stock; m.inventories[1].Slot != "B1" || stock != 1 {
+		t.Errorf("Expected B1 stock 1, got %s %d", m.inventories[1].Slot, stock)
+	}
+}
+
+func TestReplaySlotRemoved(t *testing.T) {
+	j := &MemoryJournal{}
+	m := createSlotTestMachine(WithJournal(j))
+	m.RemoveSlot("A1")
+	m.Insert(C500)
+	m.BuySlot("1")
+
+	replayed, err := Replay(j.Entries())
+	if err != nil {
+		t.Errorf("Expected error nil, got %v", err)
+		return
+	}
+	if !reflect.DeepEqual(m.State(), replayed.State()) {
+		t.Errorf("Expected %+v, got %+v", m.State(), replayed.State())
+	}
+	if len(replayed.inventories) != 3 || replayed.inventories[2].Stock != 0 {
+		t.Errorf("Expected slot 1 sold out after replay, got %+v", replayed.inventories)
+	}
+}
@@ -0,0 +1,117 @@
+package machine
+
+// Snapshot is what the machine display shows, taken at once so the
+// fields agree with each other. Amounts are in minor units and names
+// are translated to Locale. Changing a snapshot does not change the machine
+type Snapshot struct {
+	Currency   string           `json:"currency"`
+	Locale     Locale           `json:"locale"`
+	Input      int              `json:"input"`
+	Change     []SnapshotChange `json:"change"`
+	ReturnGate []Currency       `json:"return_gate"`
+	Items      []SnapshotItem   `json:"items"`
+	Cart       []SnapshotLine   `json:"cart"`
+	CartTotal  int              `json:"cart_total"`
+	Outlet     []string         `json:"outlet"`
+
+	currency *CurrencyDef
+}
+
+// SnapshotChange is the change status of one denomination, largest first
+type SnapshotChange struct {
+	Currency        Currency `json:"currency"`
+	ExactChangeOnly bool     `json:"exact_change_only"`
+	// coins in the tube, Capacity is zero for an unlimited tube
+	Count    int `json:"count"`
+	Capacity int `json:"capacity,omitempty"`
+}
+
+// SnapshotItem is a slot, Price is paid now after pricing rules
+// and ListPrice is the price without them
+type SnapshotItem struct {
+	Slot      string `json:"slot"`
+	Name      string `json:"name"`
+	ListPrice int    `json:"list_price"`
+	Price     int    `json:"price"`
+	Stock     int    `json:"stock"`
+	// Available is true when the inserted money buys the item
+	Available bool `json:"available"`
+	// free items for every BundleBuy items in one checkout, zero without bundle
+	BundleBuy  int `json:"bundle_buy,omitempty"`
+	BundleFree int `json:"bundle_free,omitempty"`
+}
+
+// SnapshotLine is a cart line, Amount is after pricing rules and bundles
+type SnapshotLine struct {
+	Slot     string `json:"slot"`
+	Name     string `json:"name"`
+	Quantity int    `json:"quantity"`
+	Amount   int    `json:"amount"`
+}
+
+// Snapshot returns the state of the display
+func (m *Machine) Snapshot() *Snapshot {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.snapshot()
+}
+
+func (m *Machine) snapshot() *Snapshot {
+	l := m.lang()
+	s := &Snapshot{
+		Currency:   m.Currency().Code,
+		Locale:     l,
+		Input:      m.totalInput(),
+		Change:     []SnapshotChange{},
+		ReturnGate: append([]Currency{}, m.returnRegister...),
+		Items:      []SnapshotItem{},
+		Cart:       []SnapshotLine{},
+		Outlet:     []string{},
+		currency:   m.Currency(),
+	}
+
+	for _, v := range m.changeStatus() {
+		s.Change = append(s.Change, SnapshotChange{
+			Currency:        v.Currency,
+			ExactChangeOnly: v.ExactChangeOnly,
+			Count:           m.mainRegister[v.Currency],
+			Capacity:        m.tubeCapacity[v.Currency],
+		})
+	}
+	for i, v := range m.inventories {
+		item := SnapshotItem{
+			Slot:      v.Slot,
+			Name:      v.LocalName(l),
+			ListPrice: v.Price,
+			Price:     m.price(i),
+			Stock:     v.Stock,
+		}
+		item.Available = item.Stock > 0 && s.Input >= item.Price
+		if b, ok := m.bundle(v.Slot); ok {
+			item.BundleBuy, item.BundleFree = b.Buy, b.Free
+		}
+		s.Items = append(s.Items, item)
+	}
+	lines := m.cartLines()
+	for _, v := range lines {
+		s.Cart = append(s.Cart, SnapshotLine{Slot: v.Slot, Name: v.Item.LocalName(l), Quantity: v.Quantity, Amount: v.Amount})
+	}
+	s.CartTotal = m.cartTotal(lines)
+	for _, v := range m.outlet {
+		s.Outlet = append(s.Outlet, v.LocalName(l))
+	}
+
+	return s
+}
+
+// format print amount in the snapshot currency
+func (s *Snapshot) format(amount int) string {
+	if s.currency == nil {
+		if currency, err := LookupCurrency(s.Currency); err == nil {
+			return currency.Format(amount)
+		}
+		return DefaultCurrency.Format(amount)
+	}
+	return s.currency.Format(amount)
+}
@@ -0,0 +1,226 @@
+package machine
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ErrNoState is returned by Store.Load when nothing was saved yet
+var ErrNoState = errors.New("No saved machine state")
+
+// State is a copy of every register of the machine
+type State struct {
+	Currency       string           `json:"currency"`
+	MainRegister   map[Currency]int `json:"main_register"`
+	CashBox        map[Currency]int `json:"cash_box,omitempty"`
+	Stacker        map[Currency]int `json:"stacker"`
+	InputRegister  []Currency       `json:"input_register"`
+	ReturnRegister []Currency       `json:"return_register"`
+	Inventories    []Inventory      `json:"inventories"`
+	Outlet         []Item           `json:"outlet"`
+	// coins and notes taken out by the operator so far
+	Collected map[Currency]int `json:"collected,omitempty"`
+	// number of sales, the id of the last receipt
+	Transactions uint64 `json:"transactions,omitempty"`
+	// sequence number of the last journal entry covered by this state
+	JournalSeq uint64 `json:"journal_seq"`
+}
+
+// Store persists machine state, Save must replace the previous state
+// atomically so a crash never leaves a partially written state
+type Store interface {
+	Load() (*State, error)
+	Save(s *State) error
+}
+
+// WithStore saves the machine state to s after every operation
+func WithStore(s Store) Option {
+	return func(m *Machine) {
+		m.store = s
+	}
+}
+
+// Restore build a machine from the state saved in s, opts configure
+// the hardware the same way as New and must include the saved currency
+func Restore(s Store, opts ...Option) (*Machine, error) {
+	state, err := s.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	m := New(map[Currency]int{}, []Inventory{}, append(opts, WithStore(s))...)
+	if state.Currency != m.Currency().Code {
+		return nil, fmt.Errorf("Saved state currency %s does not match machine currency %s", state.Currency, m.Currency().Code)
+	}
+	m.restore(state)
+
+	return m, nil
+}
+
+// Save persists current state to the store given by WithStore,
+// a fresh machine also writes its provisioning to the journal
+func (m *Machine) Save() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.transact(func() error {
+		return nil
+	})
+}
+
+// transact runs fn on the live registers, appends the entries fn
+// recorded to the journal then saves the result.
+// When journaling or saving fails the registers are rolled back,
+// so memory never runs ahead of the store. fn error is returned as is.
+// With a journal, appending is the commit point: a failed save after it
+// keeps the transaction since Recover can replay it, and saving is
+// retried on the next transaction
+func (m *Machine) transact(fn func() error) error {
+	before := m.levels()
+	err := m.commit(fn)
+	m.publish(before)
+
+	return err
+}
+
+// commit runs fn as described in transact, the events
+// fn emitted are dropped on rollback
+func (m *Machine) commit(fn func() error) error {
+	m.events = nil
+	if m.store == nil && m.journal == nil {
+		return fn()
+	}
+
+	before, receipt := m.state(), m.receipt
+	m.pending = nil
+	if m.journal != nil && m.journalSeq == 0 {
+		m.record(JournalEntry{Type: EntryProvisioned, State: before})
+	}
+
+	err := fn()
+	if m.journal != nil && len(m.pending) > 0 {
+		if journalErr := m.journal.Append(m.pending...); journalErr != nil {
+			m.restore(before)
+			m.receipt = receipt
+			m.events = nil
+			return journalErr
+		}
+	}
+	m.pending = nil
+
+	if m.store != nil {
+		if saveErr := m.store.Save(m.state()); saveErr != nil && m.journal == nil {
+			m.restore(before)
+			m.receipt = receipt
+			m.events = nil
+			return saveErr
+		}
+	}
+
+	return err
+}
+
+// state returns a deep copy of the registers
+func (m *Machine) state() *State {
+	inventories := make([]Inventory, len(m.inventories))
+	copy(inventories, m.inventories)
+
+	return &State{
+		Currency:       m.Currency().Code,
+		MainRegister:   copyRegister(m.mainRegister),
+		CashBox:        copyRegister(m.cashBox),
+		Stacker:        copyRegister(m.stacker),
+		InputRegister:  append([]Currency{}, m.inputRegister...),
+		ReturnRegister: append([]Currency{}, m.returnRegister...),
+		Inventories:    inventories,
+		Outlet:         append([]Item{}, m.outlet...),
+		Collected:      copyRegister(m.collected),
+		Transactions:   m.transactions,
+		JournalSeq:     m.journalSeq,
+	}
+}
+
+func (m *Machine) restore(s *State) {
+	inventories := make([]Inventory, len(s.Inventories))
+	copy(inventories, s.Inventories)
+
+	m.mainRegister = copyRegister(s.MainRegister)
+	m.cashBox = copyRegister(s.CashBox)
+	m.stacker = copyRegister(s.Stacker)
+	m.inputRegister = append([]Currency{}, s.InputRegister...)
+	m.returnRegister = append([]Currency{}, s.ReturnRegister...)
+	m.inventories = inventories
+	m.outlet = append([]Item{}, s.Outlet...)
+	m.collected = copyRegister(s.Collected)
+	m.transactions = s.Transactions
+	m.journalSeq = s.JournalSeq
+	m.pending = nil
+}
+
+// FileStore keeps the state as JSON in a local file
+type FileStore struct {
+	path string
+}
+
+func NewFileStore(path string) *FileStore {
+	return &FileStore{path: path}
+}
+
+func (s *FileStore) Load() (*State, error) {
+	b, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, ErrNoState
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	state := &State{}
+	if err := json.Unmarshal(b, state); err != nil {
+		return nil, fmt.Errorf("Corrupted machine state %s: %v", s.path, err)
+	}
+
+	return state, nil
+}
+
+// Save write the state to a temporary file next to the target,
+// then rename it over the previous state
+func (s *FileStore) Save(state *State) error {
+	b, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Dir(s.path)
+	f, err := os.CreateTemp(dir, filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+
+	_, err = f.Write(b)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, s.path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+
+	// make the rename itself durable
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+
+	return nil
+}
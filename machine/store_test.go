@@ -0,0 +1,122 @@
+package machine
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type failingStore struct {
+	saved *State
+	fail  bool
+}
+
+func (s *failingStore) Load() (*State, error) {
+	if s.saved == nil {
+		return nil, ErrNoState
+	}
+	return s.saved, nil
+}
+
+func (s *failingStore) Save(state *State) error {
+	if s.fail {
+		return errors.New("disk full")
+	}
+	s.saved = state
+	return nil
+}
+
+func createStoreTestMachine(s Store) *Machine {
+	return New(map[Currency]int{C10: 10, C100: 4}, []Inventory{
+		Inventory{Item: Item{Name: "Item 1", Price: 120}, Stock: 5},
+	}, WithNotes(10, N1000), WithStore(s))
+}
+
+func TestFileStoreLoadWithoutState(t *testing.T) {
+	s := NewFileStore(filepath.Join(t.TempDir(), "state.json"))
+	_, err := s.Load()
+	if err != ErrNoState {
+		t.Errorf("Expected ErrNoState, got %v", err)
+	}
+}
+
+func TestFileStoreRestore(t *testing.T) {
+	dir := t.TempDir()
+	s := NewFileStore(filepath.Join(dir, "state.json"))
+	m := createStoreTestMachine(s)
+	m.Insert(N1000)
+	m.Insert(C500)
+	m.Buy(0)
+	m.Insert(C50)
+
+	restored, err := Restore(s, WithNotes(10, N1000))
+	if err != nil {
+		t.Errorf("Expected error nil, got %v", err)
+		return
+	}
+	if !reflect.DeepEqual(m.state(), restored.state()) {
+		t.Errorf("Expected restored state %+v, got %+v", m.state(), restored.state())
+	}
+	if restored.TotalInputRegister() != 430 {
+		t.Errorf("Expected customer credit 430 restored, got %d", restored.TotalInputRegister())
+	}
+
+	// restored machine keeps saving
+	restored.ReturnInput()
+	again, _ := Restore(s, WithNotes(10, N1000))
+	if len(again.GetReturn()) == 0 {
+		t.Errorf("Expected returned coins saved by restored machine")
+	}
+
+	files, _ := os.ReadDir(dir)
+	if len(files) != 1 {
+		t.Errorf("Expected only the state file left, got %d files", len(files))
+	}
+}
+
+func TestRestoreCurrencyMismatch(t *testing.T) {
+	s := &failingStore{}
+	createStoreTestMachine(s).Insert(C10)
+
+	_, err := Restore(s, WithCurrency(EUR))
+	if err == nil || err.Error() != "Saved state currency JPY does not match machine currency EUR" {
+		t.Errorf("Expected currency mismatch error, got %v", err)
+	}
+}
+
+func TestMachineRollbackWhenSaveFails(t *testing.T) {
+	s := &failingStore{}
+	m := createStoreTestMachine(s)
+	m.Insert(C100)
+	m.Insert(C50)
+	saved := m.state()
+
+	s.fail = true
+	if err := m.Buy(0); err == nil || err.Error() != "disk full" {
+		t.Errorf("Expected error 'disk full', got %v", err)
+	}
+	if err := m.Insert(C10); err == nil {
+		t.Errorf("Expected error not nil, got nil")
+	}
+	m.ReturnInput()
+	if len(m.GetReturn()) != 0 || len(m.GetItems()) != 0 {
+		t.Errorf("Expected nothing handed out when state is not saved")
+	}
+
+	if !reflect.DeepEqual(saved, m.state()) {
+		t.Errorf("Expected state rolled back to %+v, got %+v", saved, m.state())
+	}
+	if !reflect.DeepEqual(saved, s.saved) {
+		t.Errorf("Expected store untouched %+v, got %+v", saved, s.saved)
+	}
+
+	s.fail = false
+	if err := m.Buy(0); err != nil {
+		t.Errorf("Expected error nil, got %v", err)
+	}
+	if s.saved.Inventories[0].Stock != 4 || len(s.saved.Outlet) != 1 {
+		t.Errorf("Expected buy saved, got %+v", s.saved)
+	}
+}
@@ -2,84 +2,201 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
 	"strings"
 
+	"github.com/chapterzero/sai_vending/config"
 	"github.com/chapterzero/sai_vending/handlers"
 	"github.com/chapterzero/sai_vending/machine"
+	"github.com/chapterzero/sai_vending/server"
+	"github.com/chapterzero/sai_vending/tui"
 )
 
 var m *machine.Machine
-var hMap map[string]handlers.Handler
+var registry *handlers.Registry
+
+var configPath = flag.String("config", "vending.json", "machine config providing drawer, items and accepted money")
+var exportConfig = flag.Bool("export-config", false, "print the loaded machine in config format and exit")
+var httpAddr = flag.String("http", "", "serve the HTTP/JSON API on this address instead of reading commands, ex: :8080")
+var statePath = flag.String("state", "", "file to persist machine state, restored on start")
+var journalPath = flag.String("journal", "", "file to append every money and stock movement to")
+var cardReader = flag.String("card-reader", "", "enable the card command with a simulated IC card reader answering approve, decline or timeout")
+var displayFormat = flag.String("display", "text", "layout of the machine display: text, tabs, json or compact")
+var locale = flag.String("locale", "en", "language of the display and messages, en or ja")
+var interactive = flag.Bool("tui", false, "run the full screen terminal UI instead of reading commands")
+var servicePIN = flag.String("service-pin", os.Getenv("VENDING_SERVICE_PIN"), "operator pin enabling the service command, defaults to $VENDING_SERVICE_PIN")
+var auditPath = flag.String("audit", "service-audit.log", "file to append every service command to, logins and refused ones included")
 
 func init() {
-	log.Println("Initializing...")
-	m = provisionMachine()
-	hMap = map[string]handlers.Handler{
-		"1": &handlers.InsertHandler{},
-		"2": &handlers.BuyHandler{},
-		"3": &handlers.GetItemHandler{},
-		"4": &handlers.ReturnInputHandler{},
-		"5": &handlers.GetReturnHandler{},
-	}
+	registry = handlers.DefaultRegistry()
 }
 
 func main() {
-	log.Println("SAI VENDING PROGRAM v0.1 press CTRL-C to exit")
+	flag.Parse()
+	log.Println("Initializing...")
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatalln("ERR:", *configPath, err.Error())
+	}
+	lang, err := machine.ParseLocale(*locale)
+	if err != nil {
+		log.Fatalln("ERR: -locale", err.Error())
+	}
+	m = loadMachine(cfg, machine.WithLocale(lang))
+	renderer, err := machine.LookupRenderer(*displayFormat)
+	if err != nil {
+		log.Fatalln("ERR: -display", err.Error())
+	}
+	if c, ok := registry.Lookup("status"); ok {
+		c.Handler = &handlers.StatusHandler{Renderer: renderer}
+	}
+	if *servicePIN != "" {
+		audit, err := os.OpenFile(*auditPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+		if err != nil {
+			log.Fatalln("ERR: -audit", err.Error())
+		}
+		registry.Register(handlers.ServiceCommand(*servicePIN, audit))
+	}
+	methods := []machine.PaymentMethod{}
+	if *cardReader != "" {
+		reader := simulatedReader(*cardReader)
+		registry.Register(handlers.PaymentCommand("card", reader))
+		methods = append(methods, reader)
+	}
+	if *exportConfig {
+		if err := config.FromMachine(m).Write(os.Stdout); err != nil {
+			log.Fatalln("ERR:", err.Error())
+		}
+		return
+	}
+	if *httpAddr != "" {
+		log.Println("SAI VENDING API listening on", *httpAddr)
+		log.Fatalln(http.ListenAndServe(*httpAddr, server.New(m, methods...)))
+	}
+
+	if *interactive {
+		runTUI()
+		return
+	}
+
+	log.Println("SAI VENDING PROGRAM v0.1 press CTRL-C to exit, type help for commands")
 	scanner := bufio.NewScanner(os.Stdin)
-	fmt.Println(m.Display())
+	fmt.Println(renderer.Render(m.Snapshot()))
 
 	for {
 		fmt.Println("--------------------------------------------------------")
 		log.Println("Enter command")
-		scanner.Scan()
-
-		cmd := strings.Split(scanner.Text(), " ")
-		if h, ok := hMap[cmd[0]]; ok {
-			err := h.Handle(m, cmd)
-			if err != nil {
-				printError(err)
-				continue
-			}
-			fmt.Println(m.Display())
+		if !scanner.Scan() {
+			return
+		}
+		if strings.TrimSpace(scanner.Text()) == "" {
 			continue
 		}
 
-		printError(fmt.Errorf("Invalid commands"))
+		c, err := registry.Execute(m, scanner.Text())
+		if err != nil {
+			printError(err)
+			continue
+		}
+		if c.Display {
+			fmt.Println(renderer.Render(m.Snapshot()))
+		}
+	}
+}
+
+// runTUI runs the terminal UI on stdin in raw mode
+func runTUI() {
+	restore, err := tui.Raw()
+	if err != nil {
+		log.Fatalln("ERR: -tui", err.Error())
+	}
+	err = tui.New(m).Run(os.Stdin, os.Stdout)
+	restore()
+	if err != nil {
+		log.Fatalln("ERR:", err.Error())
 	}
 }
 
 func printError(err error) {
-	log.Println("ERR:", err.Error())
+	log.Println("ERR:", m.Locale().Message(err))
 }
 
-func provisionMachine() *machine.Machine {
-	return machine.New(map[machine.Currency]int{
-		machine.C10:  200,
-		machine.C100: 10,
-	}, []machine.Inventory{
-		machine.Inventory{
-			machine.Item{
-				Name:  "Canned Coffee",
-				Price: 120,
-			},
-			10,
-		},
-		machine.Inventory{
-			machine.Item{
-				Name:  "Water PET bottle",
-				Price: 100,
-			},
-			0,
-		},
-		machine.Inventory{
-			machine.Item{
-				Name:  "Sport drinks XT",
-				Price: 150,
-			},
-			5,
-		},
-	})
+// loadMachine restore the machine from -state file and -journal,
+// a new machine is provisioned from cfg when nothing was saved yet.
+// opts are applied after the config options
+func loadMachine(cfg *config.Config, opts ...machine.Option) *machine.Machine {
+	opts = append(cfg.Options(), opts...)
+	entries := []machine.JournalEntry{}
+	if *journalPath != "" {
+		entries = readJournal(*journalPath)
+		j, err := machine.OpenFileJournal(*journalPath)
+		if err != nil {
+			log.Fatalln("ERR:", err.Error())
+		}
+		opts = append(opts, machine.WithJournal(j))
+	}
+
+	if *statePath == "" {
+		if len(entries) == 0 {
+			return cfg.Build(opts...)
+		}
+		replayed, err := machine.Replay(entries, opts...)
+		if err != nil {
+			log.Fatalln("ERR:", err.Error())
+		}
+		log.Println("Replayed machine state from", *journalPath)
+		return replayed
+	}
+
+	store := machine.NewFileStore(*statePath)
+	restored, err := machine.Recover(store, entries, opts...)
+	if err == nil {
+		log.Println("Restored machine state from", *statePath)
+		return restored
+	}
+	if err != machine.ErrNoState {
+		log.Fatalln("ERR:", err.Error())
+	}
+
+	provisioned := cfg.Build(append(opts, machine.WithStore(store))...)
+	if err := provisioned.Save(); err != nil {
+		log.Fatalln("ERR:", err.Error())
+	}
+	return provisioned
+}
+
+// simulatedReader returns the IC card reader answering every charge with outcome
+func simulatedReader(outcome string) *machine.SimulatedReader {
+	outcomes := map[string]machine.CardOutcome{
+		"approve": machine.CardApprove,
+		"decline": machine.CardDecline,
+		"timeout": machine.CardTimeout,
+	}
+	v, ok := outcomes[outcome]
+	if !ok {
+		log.Fatalln("ERR: -card-reader must be approve, decline or timeout, got", outcome)
+	}
+
+	return machine.NewSimulatedReader("ic_card", v)
+}
+
+func readJournal(path string) []machine.JournalEntry {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return []machine.JournalEntry{}
+	}
+	if err != nil {
+		log.Fatalln("ERR:", err.Error())
+	}
+	defer f.Close()
+
+	entries, err := machine.ReadJournal(f)
+	if err != nil {
+		log.Fatalln("ERR:", err.Error())
+	}
+	return entries
 }
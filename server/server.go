@@ -0,0 +1,421 @@
+// Package server exposes a machine over HTTP with JSON bodies
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/chapterzero/sai_vending/machine"
+)
+
+// Server routes
+//
+//	POST /insert          {"coin": "100"}
+//	POST /buy             {"slot": "A1"}, slot code or item name,
+//	                      or {"item": 1} for the position in the list,
+//	                      "payment": "ic_card" pays what the inserted
+//	                      money does not cover with a payment method
+//	POST /cart            {"slot": "A1", "quantity": 2}, quantity defaults to 1
+//	POST /cart/remove     {"slot": "A1"}
+//	POST /checkout        buy every item of the cart, buy and checkout
+//	                      respond {"receipt": {...}}
+//	POST /return-input    also empties the cart
+//	POST /collect-items   responds {"items": [...]}
+//	POST /collect-change  responds {"coins": [...]}
+//	GET  /state
+//
+// Every response carries the machine state, failures add "error"
+type Server struct {
+	m   *machine.Machine
+	mux *http.ServeMux
+	// payment methods by name, buying without payment uses the coins
+	methods map[string]machine.PaymentMethod
+}
+
+func New(m *machine.Machine, methods ...machine.PaymentMethod) *Server {
+	s := &Server{m: m, mux: http.NewServeMux(), methods: make(map[string]machine.PaymentMethod)}
+	for _, v := range append([]machine.PaymentMethod{machine.Coins}, methods...) {
+		s.methods[v.Name()] = v
+	}
+	s.mux.HandleFunc("/insert", s.post(s.insert))
+	s.mux.HandleFunc("/buy", s.post(s.buy))
+	s.mux.HandleFunc("/cart", s.post(s.addToCart))
+	s.mux.HandleFunc("/cart/remove", s.post(s.removeFromCart))
+	s.mux.HandleFunc("/checkout", s.post(s.checkout))
+	s.mux.HandleFunc("/return-input", s.post(s.returnInput))
+	s.mux.HandleFunc("/collect-items", s.post(s.collectItems))
+	s.mux.HandleFunc("/collect-change", s.post(s.collectChange))
+	s.mux.HandleFunc("/state", s.state)
+
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Response is the body of every endpoint
+type Response struct {
+	Error string `json:"error,omitempty"`
+	// handed out by collect-items and collect-change
+	Items []string `json:"items,omitempty"`
+	Coins []string `json:"coins,omitempty"`
+	// receipt of a successful buy or checkout
+	Receipt *Receipt `json:"receipt,omitempty"`
+	State   State    `json:"state"`
+}
+
+// State of the machine as seen by a customer,
+// money is written in major units of the currency
+type State struct {
+	Currency   string         `json:"currency"`
+	Input      string         `json:"input"`
+	Change     []ChangeStatus `json:"change"`
+	ReturnGate []string       `json:"return_gate"`
+	Items      []ItemStatus   `json:"items"`
+	Cart       []CartLine     `json:"cart"`
+	CartTotal  string         `json:"cart_total"`
+	Outlet     []string       `json:"outlet"`
+}
+
+type ChangeStatus struct {
+	Denomination    string `json:"denomination"`
+	ExactChangeOnly bool   `json:"exact_change_only"`
+}
+
+// ItemStatus Price is paid now after pricing rules,
+// ListPrice is the price of the item without them
+type ItemStatus struct {
+	Item      int    `json:"item"`
+	Slot      string `json:"slot"`
+	Name      string `json:"name"`
+	Price     string `json:"price"`
+	ListPrice string `json:"list_price"`
+	Stock     int    `json:"stock"`
+	Available bool   `json:"available"`
+}
+
+type CartLine struct {
+	Slot     string `json:"slot"`
+	Name     string `json:"name"`
+	Quantity int    `json:"quantity"`
+	Amount   string `json:"amount"`
+}
+
+// Receipt of a purchase, see machine.Receipt
+type Receipt struct {
+	ID     string        `json:"id"`
+	Time   time.Time     `json:"time"`
+	Lines  []ReceiptLine `json:"lines"`
+	Taxes  []TaxLine     `json:"taxes"`
+	Total  string        `json:"total"`
+	Net    string        `json:"net"`
+	Tax    string        `json:"tax"`
+	Tender []Tender      `json:"tender"`
+	Change []string      `json:"change"`
+}
+
+type ReceiptLine struct {
+	Slot     string `json:"slot"`
+	Name     string `json:"name"`
+	Quantity int    `json:"quantity"`
+	Price    string `json:"price"`
+	Amount   string `json:"amount"`
+	Tax      string `json:"tax"`
+}
+
+type TaxLine struct {
+	Category string `json:"category"`
+	Rate     int    `json:"rate"`
+	Amount   string `json:"amount"`
+	Net      string `json:"net"`
+	Tax      string `json:"tax"`
+}
+
+type Tender struct {
+	Method    string `json:"method"`
+	Amount    string `json:"amount"`
+	Reference string `json:"reference,omitempty"`
+}
+
+type insertRequest struct {
+	Coin string `json:"coin"`
+}
+
+type buyRequest struct {
+	Slot    string `json:"slot"`
+	Item    int    `json:"item"`
+	Payment string `json:"payment"`
+}
+
+type cartRequest struct {
+	Slot     string `json:"slot"`
+	Quantity int    `json:"quantity"`
+}
+
+// apiError carries the HTTP status of a failed request
+type apiError struct {
+	status int
+	err    error
+}
+
+func (s *Server) insert(r *http.Request, resp *Response) *apiError {
+	req := insertRequest{}
+	if err := decode(r, &req); err != nil {
+		return err
+	}
+
+	c, err := s.m.Currency().Parse(req.Coin)
+	if err != nil {
+		return &apiError{http.StatusBadRequest, err}
+	}
+	if err := s.m.Insert(c); err != nil {
+		return &apiError{http.StatusUnprocessableEntity, err}
+	}
+	return nil
+}
+
+func (s *Server) buy(r *http.Request, resp *Response) *apiError {
+	req := buyRequest{}
+	if err := decode(r, &req); err != nil {
+		return err
+	}
+
+	method := machine.Coins
+	if req.Payment != "" {
+		ok := false
+		if method, ok = s.methods[req.Payment]; !ok {
+			return &apiError{http.StatusBadRequest, machine.Errorf("Unknown payment method %s", req.Payment)}
+		}
+	}
+
+	if req.Slot == "" && method == machine.Coins {
+		receipt, err := s.m.BuyReceipt(req.Item - 1)
+		if err != nil {
+			return &apiError{http.StatusUnprocessableEntity, err}
+		}
+		resp.Receipt = s.receipt(receipt)
+		return nil
+	}
+
+	var slot string
+	var err error
+	if req.Slot == "" {
+		slot, err = s.m.SlotAt(req.Item)
+	} else {
+		slot, err = s.m.FindSlot(req.Slot)
+	}
+	if err != nil {
+		return &apiError{http.StatusNotFound, err}
+	}
+	receipt, err := s.m.BuyMixedReceipt(slot, method)
+	if errors.Is(err, machine.ErrPaymentDeclined) || errors.Is(err, machine.ErrPaymentTimeout) {
+		return &apiError{http.StatusPaymentRequired, err}
+	}
+	if err != nil {
+		return &apiError{http.StatusUnprocessableEntity, err}
+	}
+	resp.Receipt = s.receipt(receipt)
+	return nil
+}
+
+func (s *Server) addToCart(r *http.Request, resp *Response) *apiError {
+	req := cartRequest{}
+	if err := decode(r, &req); err != nil {
+		return err
+	}
+	if req.Quantity == 0 {
+		req.Quantity = 1
+	}
+
+	slot, err := s.m.FindSlot(req.Slot)
+	if err != nil {
+		return &apiError{http.StatusNotFound, err}
+	}
+	if err := s.m.AddToCart(slot, req.Quantity); err != nil {
+		return &apiError{http.StatusUnprocessableEntity, err}
+	}
+	return nil
+}
+
+func (s *Server) removeFromCart(r *http.Request, resp *Response) *apiError {
+	req := cartRequest{}
+	if err := decode(r, &req); err != nil {
+		return err
+	}
+
+	slot, err := s.m.FindSlot(req.Slot)
+	if err != nil {
+		return &apiError{http.StatusNotFound, err}
+	}
+	if err := s.m.RemoveFromCart(slot); err != nil {
+		return &apiError{http.StatusUnprocessableEntity, err}
+	}
+	return nil
+}
+
+func (s *Server) checkout(r *http.Request, resp *Response) *apiError {
+	receipt, err := s.m.CheckoutReceipt()
+	if err != nil {
+		return &apiError{http.StatusUnprocessableEntity, err}
+	}
+	resp.Receipt = s.receipt(receipt)
+	return nil
+}
+
+func (s *Server) returnInput(r *http.Request, resp *Response) *apiError {
+	s.m.ReturnInput()
+	s.m.ClearCart()
+	return nil
+}
+
+func (s *Server) collectItems(r *http.Request, resp *Response) *apiError {
+	resp.Items = []string{}
+	for _, v := range s.m.GetItems() {
+		resp.Items = append(resp.Items, v.Name)
+	}
+	return nil
+}
+
+func (s *Server) collectChange(r *http.Request, resp *Response) *apiError {
+	resp.Coins = []string{}
+	for _, v := range s.m.GetReturn() {
+		resp.Coins = append(resp.Coins, s.m.Currency().FormatMajor(int(v)))
+	}
+	return nil
+}
+
+func (s *Server) state(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		s.write(w, http.StatusMethodNotAllowed, &Response{Error: fmt.Sprintf("%s not allowed", r.Method)})
+		return
+	}
+	s.write(w, http.StatusOK, &Response{})
+}
+
+// post runs fn for POST requests and writes the response with the
+// machine state after fn
+func (s *Server) post(fn func(r *http.Request, resp *Response) *apiError) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			s.write(w, http.StatusMethodNotAllowed, &Response{Error: fmt.Sprintf("%s not allowed", r.Method)})
+			return
+		}
+
+		resp := &Response{}
+		if err := fn(r, resp); err != nil {
+			resp.Error = s.m.Locale().Message(err.err)
+			s.write(w, err.status, resp)
+			return
+		}
+		s.write(w, http.StatusOK, resp)
+	}
+}
+
+func (s *Server) write(w http.ResponseWriter, status int, resp *Response) {
+	resp.State = s.snapshot()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// snapshot returns the machine state in major units, read at once
+// so a concurrent request never shows half of a sale
+func (s *Server) snapshot() State {
+	currency := s.m.Currency()
+	snap := s.m.Snapshot()
+
+	st := State{
+		Currency:   snap.Currency,
+		Input:      currency.FormatMajor(snap.Input),
+		Change:     []ChangeStatus{},
+		ReturnGate: []string{},
+		Items:      []ItemStatus{},
+		Cart:       []CartLine{},
+		CartTotal:  currency.FormatMajor(snap.CartTotal),
+		Outlet:     append([]string{}, snap.Outlet...),
+	}
+	for _, v := range snap.Change {
+		st.Change = append(st.Change, ChangeStatus{currency.FormatMajor(int(v.Currency)), v.ExactChangeOnly})
+	}
+	for _, v := range snap.ReturnGate {
+		st.ReturnGate = append(st.ReturnGate, currency.FormatMajor(int(v)))
+	}
+	for i, v := range snap.Items {
+		st.Items = append(st.Items, ItemStatus{
+			Item:      i + 1,
+			Slot:      v.Slot,
+			Name:      v.Name,
+			Price:     currency.FormatMajor(v.Price),
+			ListPrice: currency.FormatMajor(v.ListPrice),
+			Stock:     v.Stock,
+			Available: v.Available,
+		})
+	}
+	for _, v := range snap.Cart {
+		st.Cart = append(st.Cart, CartLine{
+			Slot:     v.Slot,
+			Name:     v.Name,
+			Quantity: v.Quantity,
+			Amount:   currency.FormatMajor(v.Amount),
+		})
+	}
+
+	return st
+}
+
+// receipt returns r in major units
+func (s *Server) receipt(r *machine.Receipt) *Receipt {
+	currency := s.m.Currency()
+
+	receipt := &Receipt{
+		ID:     r.ID,
+		Time:   r.Time,
+		Lines:  []ReceiptLine{},
+		Taxes:  []TaxLine{},
+		Total:  currency.FormatMajor(r.Total),
+		Net:    currency.FormatMajor(r.Net),
+		Tax:    currency.FormatMajor(r.Tax),
+		Tender: []Tender{},
+		Change: []string{},
+	}
+	for _, v := range r.Lines {
+		receipt.Lines = append(receipt.Lines, ReceiptLine{
+			Slot:     v.Slot,
+			Name:     v.Name,
+			Quantity: v.Quantity,
+			Price:    currency.FormatMajor(v.Price),
+			Amount:   currency.FormatMajor(v.Amount),
+			Tax:      string(v.Tax),
+		})
+	}
+	for _, v := range r.Taxes {
+		receipt.Taxes = append(receipt.Taxes, TaxLine{
+			Category: string(v.Category),
+			Rate:     v.Rate,
+			Amount:   currency.FormatMajor(v.Amount),
+			Net:      currency.FormatMajor(v.Net),
+			Tax:      currency.FormatMajor(v.Tax),
+		})
+	}
+	for _, v := range r.Tender {
+		receipt.Tender = append(receipt.Tender, Tender{v.Method, currency.FormatMajor(v.Amount), v.Reference})
+	}
+	for _, c := range r.Change {
+		receipt.Change = append(receipt.Change, currency.FormatMajor(int(c)))
+	}
+
+	return receipt
+}
+
+func decode(r *http.Request, v interface{}) *apiError {
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+	if err := d.Decode(v); err != nil {
+		return &apiError{http.StatusBadRequest, fmt.Errorf("Invalid request body: %v", err)}
+	}
+	return nil
+}
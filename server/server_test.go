@@ -0,0 +1,332 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/chapterzero/sai_vending/machine"
+)
+
+func createTestServer() *httptest.Server {
+	m := machine.New(map[machine.Currency]int{machine.C10: 10, machine.C100: 4}, []machine.Inventory{
+		machine.Inventory{Item: machine.Item{Name: "Item 1", Price: 120}, Stock: 5},
+		machine.Inventory{Item: machine.Item{Name: "Item 2", Price: 100}, Stock: 0},
+	})
+	return httptest.NewServer(New(m))
+}
+
+func call(t *testing.T, ts *httptest.Server, method, path, body string) (int, *Response) {
+	req, _ := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Expected error nil, got %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.Header.Get("Content-Type") != "application/json" {
+		t.Errorf("Expected JSON response, got %s", res.Header.Get("Content-Type"))
+	}
+	resp := &Response{}
+	if err := json.NewDecoder(res.Body).Decode(resp); err != nil {
+		t.Fatalf("Expected JSON body, got %v", err)
+	}
+	return res.StatusCode, resp
+}
+
+func TestState(t *testing.T) {
+	ts := createTestServer()
+	defer ts.Close()
+
+	status, resp := call(t, ts, http.MethodGet, "/state", "")
+	if status != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", status)
+	}
+
+	expected := State{
+		Currency: "JPY",
+		Input:    "0",
+		Change: []ChangeStatus{
+			ChangeStatus{"500", false},
+			ChangeStatus{"100", false},
+			ChangeStatus{"50", false},
+			ChangeStatus{"10", false},
+		},
+		ReturnGate: []string{},
+		Items: []ItemStatus{
+			ItemStatus{Item: 1, Slot: "1", Name: "Item 1", Price: "120", ListPrice: "120", Stock: 5},
+			ItemStatus{Item: 2, Slot: "2", Name: "Item 2", Price: "100", ListPrice: "100", Stock: 0},
+		},
+		Cart:      []CartLine{},
+		CartTotal: "0",
+		Outlet:    []string{},
+	}
+	if !reflect.DeepEqual(expected, resp.State) {
+		t.Errorf("Expected %+v, got %+v", expected, resp.State)
+	}
+}
+
+func TestPurchaseFlow(t *testing.T) {
+	ts := createTestServer()
+	defer ts.Close()
+
+	status, resp := call(t, ts, http.MethodPost, "/insert", `{"coin": "500"}`)
+	if status != http.StatusOK || resp.State.Input != "500" {
+		t.Errorf("Expected 500 inserted, got %d %+v", status, resp)
+	}
+	if !resp.State.Items[0].Available || resp.State.Items[1].Available {
+		t.Errorf("Expected only item 1 available, got %+v", resp.State.Items)
+	}
+
+	status, resp = call(t, ts, http.MethodPost, "/buy", `{"item": 1}`)
+	if status != http.StatusOK || resp.State.Input != "380" || resp.State.Outlet[0] != "Item 1" {
+		t.Errorf("Expected item 1 bought, got %d %+v", status, resp)
+	}
+
+	status, resp = call(t, ts, http.MethodPost, "/buy", `{"slot": "item 1"}`)
+	if status != http.StatusOK || resp.State.Input != "260" || len(resp.State.Outlet) != 2 {
+		t.Errorf("Expected item 1 bought by name, got %d %+v", status, resp)
+	}
+
+	status, resp = call(t, ts, http.MethodPost, "/return-input", "")
+	if status != http.StatusOK || len(resp.State.ReturnGate) != 8 {
+		t.Errorf("Expected 8 coins in return gate, got %d %+v", status, resp)
+	}
+
+	status, resp = call(t, ts, http.MethodPost, "/collect-items", "")
+	if status != http.StatusOK || !reflect.DeepEqual(resp.Items, []string{"Item 1", "Item 1"}) || len(resp.State.Outlet) != 0 {
+		t.Errorf("Expected item 1 collected, got %d %+v", status, resp)
+	}
+
+	status, resp = call(t, ts, http.MethodPost, "/collect-change", "")
+	if status != http.StatusOK || len(resp.Coins) != 8 || resp.Coins[0] != "10" || len(resp.State.ReturnGate) != 0 {
+		t.Errorf("Expected change collected, got %d %+v", status, resp)
+	}
+}
+
+func TestBuyWithPayment(t *testing.T) {
+	m := machine.New(map[machine.Currency]int{machine.C10: 10}, []machine.Inventory{
+		machine.Inventory{Slot: "A1", Item: machine.Item{Name: "Item 1", Price: 120}, Stock: 5},
+	})
+	reader := machine.NewSimulatedReader("ic_card", machine.CardApprove, machine.CardDecline, machine.CardApprove)
+	ts := httptest.NewServer(New(m, reader))
+	defer ts.Close()
+
+	status, resp := call(t, ts, http.MethodPost, "/buy", `{"slot": "A1", "payment": "ic_card"}`)
+	if status != http.StatusOK || resp.State.Input != "0" || len(resp.State.Outlet) != 1 {
+		t.Errorf("Expected item 1 paid by card, got %d %+v", status, resp)
+	}
+
+	status, resp = call(t, ts, http.MethodPost, "/buy", `{"slot": "A1", "payment": "ic_card"}`)
+	if status != http.StatusPaymentRequired || resp.Error != "Payment declined" || len(resp.State.Outlet) != 1 {
+		t.Errorf("Expected payment declined, got %d %+v", status, resp)
+	}
+
+	call(t, ts, http.MethodPost, "/insert", `{"coin": "100"}`)
+	status, resp = call(t, ts, http.MethodPost, "/buy", `{"slot": "A1", "payment": "ic_card"}`)
+	if status != http.StatusOK || resp.State.Input != "0" || len(resp.State.Outlet) != 2 {
+		t.Errorf("Expected item 1 paid with coins and card, got %d %+v", status, resp)
+	}
+
+	// item position on the display
+	status, resp = call(t, ts, http.MethodPost, "/buy", `{"item": 1, "payment": "ic_card"}`)
+	if status != http.StatusOK || len(resp.State.Outlet) != 3 || resp.Receipt == nil {
+		t.Errorf("Expected item 1 paid by card, got %d %+v", status, resp)
+	}
+	status, resp = call(t, ts, http.MethodPost, "/buy", `{"item": 2, "payment": "ic_card"}`)
+	if status != http.StatusNotFound || resp.Error != "Invalid inventory, please enter number from (1 to 1)" {
+		t.Errorf("Expected invalid item, got %d %+v", status, resp)
+	}
+
+	status, resp = call(t, ts, http.MethodPost, "/buy", `{"slot": "A1", "payment": "qr"}`)
+	if status != http.StatusBadRequest || resp.Error != "Unknown payment method qr" {
+		t.Errorf("Expected unknown payment method, got %d %+v", status, resp)
+	}
+
+	status, resp = call(t, ts, http.MethodPost, "/buy", `{"slot": "A1", "payment": "coins"}`)
+	if status != http.StatusUnprocessableEntity || resp.Error != "Inserted money not enough to buy this item" {
+		t.Errorf("Expected coins not enough, got %d %+v", status, resp)
+	}
+	if reader.Charged() != 260 {
+		t.Errorf("Expected 260 charged, got %d", reader.Charged())
+	}
+}
+
+func TestReceipt(t *testing.T) {
+	m := machine.New(map[machine.Currency]int{machine.C10: 10, machine.C100: 4}, []machine.Inventory{
+		machine.Inventory{Slot: "A1", Item: machine.Item{Name: "Item 1", Price: 120, Tax: machine.TaxReduced}, Stock: 5},
+	}, machine.WithTaxRates(map[machine.TaxCategory]int{machine.TaxReduced: 8}))
+	ts := httptest.NewServer(New(m))
+	defer ts.Close()
+
+	call(t, ts, http.MethodPost, "/insert", `{"coin": "500"}`)
+	status, resp := call(t, ts, http.MethodPost, "/buy", `{"slot": "A1"}`)
+	if status != http.StatusOK || resp.Receipt == nil {
+		t.Errorf("Expected receipt, got %d %+v", status, resp)
+		return
+	}
+
+	expectedLines := []ReceiptLine{ReceiptLine{Slot: "A1", Name: "Item 1", Quantity: 1, Price: "120", Amount: "120", Tax: "reduced"}}
+	expectedTaxes := []TaxLine{TaxLine{Category: "reduced", Rate: 8, Amount: "120", Net: "112", Tax: "8"}}
+	r := resp.Receipt
+	if r.ID != "000001" || !reflect.DeepEqual(expectedLines, r.Lines) || !reflect.DeepEqual(expectedTaxes, r.Taxes) {
+		t.Errorf("Unexpected receipt %+v", r)
+	}
+	if r.Total != "120" || r.Net != "112" || r.Tax != "8" || !reflect.DeepEqual([]Tender{Tender{"coins", "500", ""}}, r.Tender) || len(r.Change) != 11 {
+		t.Errorf("Unexpected receipt totals %+v", r)
+	}
+
+	status, resp = call(t, ts, http.MethodPost, "/buy", `{"slot": "A9"}`)
+	if status != http.StatusNotFound || resp.Receipt != nil {
+		t.Errorf("Expected no receipt for a failed buy, got %d %+v", status, resp)
+	}
+}
+
+func TestCartFlow(t *testing.T) {
+	ts := createTestServer()
+	defer ts.Close()
+
+	status, resp := call(t, ts, http.MethodPost, "/cart", `{"slot": "1", "quantity": 2}`)
+	expected := []CartLine{CartLine{Slot: "1", Name: "Item 1", Quantity: 2, Amount: "240"}}
+	if status != http.StatusOK || !reflect.DeepEqual(expected, resp.State.Cart) || resp.State.CartTotal != "240" {
+		t.Errorf("Expected 2 x item 1 in cart, got %d %+v", status, resp)
+	}
+
+	status, resp = call(t, ts, http.MethodPost, "/checkout", "")
+	if status != http.StatusUnprocessableEntity || resp.Error != "Inserted money not enough, cart total is 240 JPY" {
+		t.Errorf("Expected checkout refused, got %d %+v", status, resp)
+	}
+
+	call(t, ts, http.MethodPost, "/insert", `{"coin": "500"}`)
+	status, resp = call(t, ts, http.MethodPost, "/checkout", "")
+	if status != http.StatusOK || resp.State.Input != "260" || len(resp.State.Outlet) != 2 || len(resp.State.Cart) != 0 {
+		t.Errorf("Expected cart bought, got %d %+v", status, resp)
+	}
+
+	call(t, ts, http.MethodPost, "/cart", `{"slot": "item 1"}`)
+	status, resp = call(t, ts, http.MethodPost, "/cart/remove", `{"slot": "1"}`)
+	if status != http.StatusOK || len(resp.State.Cart) != 0 || resp.State.CartTotal != "0" {
+		t.Errorf("Expected cart emptied, got %d %+v", status, resp)
+	}
+
+	status, resp = call(t, ts, http.MethodPost, "/cart", `{"slot": "2"}`)
+	if status != http.StatusUnprocessableEntity || resp.Error != "Only 0 Item 2 left" {
+		t.Errorf("Expected sold out item refused, got %d %+v", status, resp)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	testCases := []struct {
+		name           string
+		method         string
+		path           string
+		body           string
+		expectedStatus int
+		expectedError  string
+	}{
+		{
+			name:           "Invalid coin",
+			method:         http.MethodPost,
+			path:           "/insert",
+			body:           `{"coin": "30"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "30 is not a valid coin",
+		},
+		{
+			name:           "Invalid body",
+			method:         http.MethodPost,
+			path:           "/buy",
+			body:           `{"item": 1`,
+			expectedStatus: http.StatusBadRequest,
+			expectedError:  "Invalid request body: unexpected EOF",
+		},
+		{
+			name:           "Not enough money",
+			method:         http.MethodPost,
+			path:           "/buy",
+			body:           `{"item": 1}`,
+			expectedStatus: http.StatusUnprocessableEntity,
+			expectedError:  "Inserted money not enough to buy this item",
+		},
+		{
+			name:           "Unknown slot",
+			method:         http.MethodPost,
+			path:           "/buy",
+			body:           `{"slot": "Z9"}`,
+			expectedStatus: http.StatusNotFound,
+			expectedError:  "No slot or item named Z9",
+		},
+		{
+			name:           "Wrong method",
+			method:         http.MethodGet,
+			path:           "/buy",
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedError:  "GET not allowed",
+		},
+		{
+			name:           "Wrong method on state",
+			method:         http.MethodPost,
+			path:           "/state",
+			expectedStatus: http.StatusMethodNotAllowed,
+			expectedError:  "POST not allowed",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ts := createTestServer()
+			defer ts.Close()
+
+			status, resp := call(t, ts, tc.method, tc.path, tc.body)
+			if status != tc.expectedStatus {
+				t.Errorf("Expected status %d, got %d", tc.expectedStatus, status)
+			}
+			if resp.Error != tc.expectedError {
+				t.Errorf("Expected error '%s', got '%s'", tc.expectedError, resp.Error)
+			}
+		})
+	}
+}
+
+func TestRejectedCoinInReturnGate(t *testing.T) {
+	ts := createTestServer()
+	defer ts.Close()
+
+	status, resp := call(t, ts, http.MethodPost, "/insert", `{"coin": "1000"}`)
+	if status != http.StatusUnprocessableEntity || resp.Error != "1000 JPY note is not accepted" {
+		t.Errorf("Expected note rejected, got %d %+v", status, resp)
+	}
+	if !reflect.DeepEqual(resp.State.ReturnGate, []string{"1000"}) {
+		t.Errorf("Expected note in return gate, got %v", resp.State.ReturnGate)
+	}
+}
+
+func TestJapanese(t *testing.T) {
+	m := machine.New(map[machine.Currency]int{machine.C10: 10}, []machine.Inventory{
+		machine.Inventory{Slot: "A1", Item: machine.Item{Name: "Item 1", Price: 120, Names: map[machine.Locale]string{machine.Japanese: "商品1"}}, Stock: 0},
+	}, machine.WithLocale(machine.Japanese))
+	ts := httptest.NewServer(New(m))
+	defer ts.Close()
+
+	testCases := []struct {
+		body     string
+		expected string
+	}{
+		{`{"slot": "A1", "payment": "qr"}`, "qrという決済方法はありません"},
+		{`{"slot": "A1"}`, "この商品は売り切れです"},
+	}
+
+	for _, tc := range testCases {
+		if _, resp := call(t, ts, http.MethodPost, "/buy", tc.body); resp.Error != tc.expected {
+			t.Errorf("%s: expected error %s, got %s", tc.body, tc.expected, resp.Error)
+		}
+	}
+
+	// the state is the display snapshot
+	if _, resp := call(t, ts, http.MethodGet, "/state", ""); len(resp.State.Items) != 1 || resp.State.Items[0].Name != "商品1" {
+		t.Errorf("Expected the japanese item name, got %+v", resp.State.Items)
+	}
+}
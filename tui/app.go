@@ -0,0 +1,338 @@
+// Package tui is a full screen terminal front end of a machine,
+// it uses the machine API the CLI and the HTTP server use
+package tui
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/chapterzero/sai_vending/machine"
+)
+
+// coinKeys insert the accepted coins and notes, smallest first
+var coinKeys = []Key{"z", "x", "c", "v", "b", "n", "m"}
+
+// animationFrames is how many ticks the outlet and the
+// return gate blink after something falls in
+const animationFrames = 10
+
+// ErrNothingToTake is returned by the take key when the outlet
+// and the return gate are both empty
+var ErrNothingToTake = errors.New("Nothing to take")
+
+// ANSI attributes of the panel
+const (
+	styleReset   = "\x1b[0m"
+	styleBold    = "\x1b[1m"
+	styleDim     = "\x1b[2m"
+	styleReverse = "\x1b[7m"
+	styleGreen   = "\x1b[1;32m"
+	styleRed     = "\x1b[31m"
+	styleYellow  = "\x1b[33m"
+	clearScreen  = "\x1b[H\x1b[2J"
+	hideCursor   = "\x1b[?25l"
+	showCursor   = "\x1b[?25h"
+)
+
+// Binding is what a key does, Help is shown in the key legend
+type Binding struct {
+	Keys   []Key
+	Help   string
+	action func(a *App) error
+}
+
+// App keeps what the panel shows besides the machine, the
+// machine itself is read again with Snapshot on every frame
+type App struct {
+	m        *machine.Machine
+	bindings []Binding
+
+	// position of the selected item on the panel
+	selected int
+	// result of the last key, err is shown in red
+	message string
+	err     bool
+	quit    bool
+
+	// frames left of the animations, and the number of items
+	// and coins seen so far to notice new ones
+	outletFrames int
+	returnFrames int
+	outletCount  int
+	returnCount  int
+}
+
+// New returns the front end of m, a coin key is bound
+// to every accepted coin and note
+func New(m *machine.Machine) *App {
+	a := &App{m: m}
+	l := m.Locale()
+	for i, c := range m.Accepted() {
+		if i == len(coinKeys) {
+			break
+		}
+		coin := c
+		a.bindings = append(a.bindings, Binding{
+			Keys: []Key{coinKeys[i]},
+			Help: m.Currency().Format(int(c)),
+			action: func(a *App) error {
+				return a.m.Insert(coin)
+			},
+		})
+	}
+	a.bindings = append(a.bindings,
+		Binding{Keys: []Key{KeyUp, "k"}, Help: l.Text("up"), action: func(a *App) error { a.move(-1); return nil }},
+		Binding{Keys: []Key{KeyDown, "j"}, Help: l.Text("down"), action: func(a *App) error { a.move(1); return nil }},
+		Binding{Keys: []Key{KeyEnter}, Help: l.Text("buy"), action: (*App).buy},
+		Binding{Keys: []Key{"a"}, Help: l.Text("add to cart"), action: (*App).addToCart},
+		Binding{Keys: []Key{"p"}, Help: l.Text("checkout"), action: func(a *App) error { return a.m.Checkout() }},
+		Binding{Keys: []Key{"r"}, Help: l.Text("cancel"), action: (*App).cancel},
+		Binding{Keys: []Key{"t"}, Help: l.Text("take"), action: (*App).take},
+		Binding{Keys: []Key{"q", KeyEsc, KeyCtrlC}, Help: l.Text("quit"), action: func(a *App) error { a.quit = true; return nil }},
+	)
+
+	s := m.Snapshot()
+	a.outletCount, a.returnCount = len(s.Outlet), len(s.ReturnGate)
+	return a
+}
+
+// Bindings returns the keys of the app in legend order
+func (a *App) Bindings() []Binding {
+	return a.bindings
+}
+
+// HandleKey runs the binding of k, unbound keys are ignored.
+// It returns false once the user asked to quit
+func (a *App) HandleKey(k Key) bool {
+	for _, b := range a.bindings {
+		for _, v := range b.Keys {
+			if v != k {
+				continue
+			}
+			a.message, a.err = "", false
+			if err := b.action(a); err != nil {
+				a.message, a.err = a.m.Locale().Message(err), true
+			}
+			a.watch()
+			return !a.quit
+		}
+	}
+
+	return !a.quit
+}
+
+// Tick advances the animations by one frame,
+// it returns true while one of them is running
+func (a *App) Tick() bool {
+	if a.outletFrames > 0 {
+		a.outletFrames--
+	}
+	if a.returnFrames > 0 {
+		a.returnFrames--
+	}
+
+	return a.outletFrames > 0 || a.returnFrames > 0
+}
+
+// watch starts the animation of the outlet or the return gate
+// when something fell in since the last key
+func (a *App) watch() {
+	s := a.m.Snapshot()
+	if len(s.Outlet) > a.outletCount {
+		a.outletFrames = animationFrames
+	}
+	if len(s.ReturnGate) > a.returnCount {
+		a.returnFrames = animationFrames
+	}
+	a.outletCount, a.returnCount = len(s.Outlet), len(s.ReturnGate)
+}
+
+func (a *App) move(step int) {
+	n := len(a.m.Snapshot().Items)
+	if n == 0 {
+		return
+	}
+	a.selected = (a.selected + step + n) % n
+}
+
+// item returns the slot of the selected item
+func (a *App) item() (string, error) {
+	items := a.m.Snapshot().Items
+	if a.selected >= len(items) {
+		a.selected = 0
+	}
+	if len(items) == 0 {
+		return "", machine.ErrInvalidSlot
+	}
+
+	return items[a.selected].Slot, nil
+}
+
+func (a *App) buy() error {
+	slot, err := a.item()
+	if err != nil {
+		return err
+	}
+	return a.m.BuySlot(slot)
+}
+
+func (a *App) addToCart() error {
+	slot, err := a.item()
+	if err != nil {
+		return err
+	}
+	return a.m.AddToCart(slot, 1)
+}
+
+func (a *App) cancel() error {
+	a.m.ReturnInput()
+	a.m.ClearCart()
+	return nil
+}
+
+// take collects the outlet and the return gate
+func (a *App) take() error {
+	l := a.m.Locale()
+	got := []string{}
+	names := []string{}
+	for _, v := range a.m.GetItems() {
+		names = append(names, v.LocalName(l))
+	}
+	if len(names) > 0 {
+		got = append(got, l.Sprintf("GOT Items: %s", strings.Join(names, ", ")))
+	}
+	coins := []string{}
+	for _, c := range a.m.GetReturn() {
+		coins = append(coins, a.m.Currency().Format(int(c)))
+	}
+	if len(coins) > 0 {
+		got = append(got, l.Sprintf("GOT Changes: %s", strings.Join(coins, ", ")))
+	}
+	if len(got) == 0 {
+		return ErrNothingToTake
+	}
+	a.message = strings.Join(got, " / ")
+
+	return nil
+}
+
+// View draws the panel with ANSI attributes, lines end with "\n"
+func (a *App) View() string {
+	s := a.m.Snapshot()
+	l := s.Locale
+	currency := a.m.Currency()
+	lines := []string{styleBold + "SAI VENDING" + styleReset, ""}
+
+	lines = append(lines, fmt.Sprintf("%s  %s", l.Text("[Input amount]"), currency.Format(s.Input)))
+	exact := []string{}
+	for _, v := range s.Change {
+		if v.ExactChangeOnly {
+			exact = append(exact, currency.Format(int(v.Currency)))
+		}
+	}
+	if len(exact) > 0 {
+		lines = append(lines, styleYellow+l.Sprintf("Exact change only: %s", strings.Join(exact, ", "))+styleReset)
+	}
+
+	lines = append(lines, "", l.Text("[Items for sale]"))
+	width := 0
+	for _, v := range s.Items {
+		if w := machine.TextWidth(v.Slot + ". " + v.Name); w > width {
+			width = w
+		}
+	}
+	for i, v := range s.Items {
+		name := v.Slot + ". " + v.Name
+		line := name + strings.Repeat(" ", width-machine.TextWidth(name)) + "  " + currency.Format(v.ListPrice)
+		if v.Price != v.ListPrice {
+			line += l.Sprintf(", now %s", currency.Format(v.Price))
+		}
+		if v.BundleBuy > 0 {
+			line += l.Sprintf(", buy %d get %d", v.BundleBuy, v.BundleFree)
+		}
+
+		style := ""
+		switch {
+		case v.Stock == 0:
+			line += "  " + l.Text("Sold out")
+			style = styleDim
+		case v.Available:
+			style = styleGreen
+		}
+		cursor := "  "
+		if i == a.selected {
+			cursor = "> "
+			style += styleReverse
+		}
+		lines = append(lines, cursor+style+line+styleReset)
+	}
+
+	if len(s.Cart) > 0 {
+		cart := []string{}
+		for _, v := range s.Cart {
+			cart = append(cart, fmt.Sprintf("%d x %s", v.Quantity, v.Name))
+		}
+		lines = append(lines, "", fmt.Sprintf("%s  %s", l.Text("[Cart]"), strings.Join(cart, ", ")), fmt.Sprintf("%s  %s", l.Text("[Cart total]"), currency.Format(s.CartTotal)))
+	}
+
+	returnGate := []string{}
+	for _, c := range s.ReturnGate {
+		returnGate = append(returnGate, currency.Format(int(c)))
+	}
+	labels := []string{l.Text("[Return gate]"), l.Text("[Outlet]")}
+	pad := machine.TextWidth(labels[0]) - machine.TextWidth(labels[1])
+	if pad > 0 {
+		labels[1] += strings.Repeat(" ", pad)
+	} else {
+		labels[0] += strings.Repeat(" ", -pad)
+	}
+	lines = append(lines, "", a.tray(labels[0], returnGate, a.returnFrames), a.tray(labels[1], s.Outlet, a.outletFrames))
+
+	lines = append(lines, "")
+	if a.message != "" {
+		if a.err {
+			lines = append(lines, styleRed+a.message+styleReset)
+		} else {
+			lines = append(lines, a.message)
+		}
+	} else {
+		lines = append(lines, "")
+	}
+
+	legend := []string{}
+	for _, b := range a.bindings {
+		legend = append(legend, styleBold+keyName(b.Keys[0])+styleReset+" "+b.Help)
+	}
+	lines = append(lines, "", strings.Join(legend, "  "))
+
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// tray draws the outlet or the return gate, an arrow
+// blinks next to it while frames are left
+func (a *App) tray(label string, content []string, frames int) string {
+	arrow := "  "
+	if frames > 0 && frames%2 == 0 {
+		arrow = "▼ "
+	}
+	if len(content) == 0 {
+		return label + "  " + arrow + a.m.Locale().Text("Empty")
+	}
+	return label + "  " + arrow + styleBold + strings.Join(content, ", ") + styleReset
+}
+
+// keyName returns the label of k in the legend
+func keyName(k Key) string {
+	switch k {
+	case KeyUp:
+		return "↑"
+	case KeyDown:
+		return "↓"
+	case KeyLeft:
+		return "←"
+	case KeyRight:
+		return "→"
+	}
+	return string(k)
+}
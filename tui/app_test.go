@@ -0,0 +1,261 @@
+package tui
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/chapterzero/sai_vending/machine"
+)
+
+func createTestHarness(opts ...machine.Option) *Harness {
+	m := machine.New(map[machine.Currency]int{machine.C10: 10, machine.C50: 10, machine.C100: 10}, []machine.Inventory{
+		machine.Inventory{Item: machine.Item{Name: "Canned coffee", Price: 120, Names: map[machine.Locale]string{machine.Japanese: "缶コーヒー"}}, Stock: 2},
+		machine.Inventory{Item: machine.Item{Name: "Water PET bottle", Price: 100}, Stock: 0},
+		machine.Inventory{Item: machine.Item{Name: "Sport drinks", Price: 150}, Stock: 5},
+	}, opts...)
+
+	return NewHarness(m)
+}
+
+// line returns the screen line containing s
+func line(screen, s string) string {
+	for _, v := range strings.Split(screen, "\n") {
+		if strings.Contains(v, s) {
+			return v
+		}
+	}
+	return ""
+}
+
+func TestCoinKeys(t *testing.T) {
+	h := createTestHarness()
+
+	expected := []Key{"z", "x", "c", "v"}
+	for i, c := range h.m.Accepted() {
+		if i == len(expected) {
+			break
+		}
+		b := h.Bindings()[i]
+		if b.Keys[0] != expected[i] || b.Help != h.m.Currency().Format(int(c)) {
+			t.Errorf("Expected %s to insert %d, got %s %s", expected[i], c, b.Keys[0], b.Help)
+		}
+	}
+
+	// 10 + 50 + 100
+	h.Type("z", "x", "c")
+	if actual := h.m.Snapshot().Input; actual != 160 {
+		t.Errorf("Expected input 160, got %d", actual)
+	}
+	if actual := line(h.Screen(), "[Input amount]"); !strings.Contains(actual, "160 JPY") {
+		t.Errorf("Expected input amount 160 JPY on screen, got %s", actual)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	h := createTestHarness()
+	h.Type("c", "z", "z")
+
+	view := h.View()
+	for _, v := range []struct {
+		name     string
+		expected string
+	}{
+		{"Canned coffee", styleGreen},
+		{"Water PET bottle", styleDim},
+		{"Sport drinks", ""},
+	} {
+		actual := line(view, v.name)
+		if v.expected != "" && !strings.Contains(actual, v.expected) {
+			t.Errorf("Expected %s to be drawn with %q, got %q", v.name, v.expected, actual)
+		}
+		if v.expected == "" && (strings.Contains(actual, styleGreen) || strings.Contains(actual, styleDim)) {
+			t.Errorf("Expected %s to be drawn plain, got %q", v.name, actual)
+		}
+	}
+}
+
+func TestSelectAndBuy(t *testing.T) {
+	h := createTestHarness()
+
+	testCases := []struct {
+		keys     []Key
+		selected string
+	}{
+		{[]Key{}, "1. Canned coffee"},
+		{[]Key{KeyDown}, "2. Water PET bottle"},
+		{[]Key{"j", "j"}, "1. Canned coffee"},
+		{[]Key{KeyUp}, "3. Sport drinks"},
+		{[]Key{"k"}, "2. Water PET bottle"},
+	}
+	for _, v := range testCases {
+		h.Type(v.keys...)
+		if actual := line(h.Screen(), "> "); !strings.Contains(actual, v.selected) {
+			t.Errorf("Expected %s selected after %v, got %s", v.selected, v.keys, actual)
+		}
+	}
+
+	// sold out item
+	h.Type("c", KeyEnter)
+	if !strings.Contains(h.Screen(), machine.ErrSoldOut.Error()) {
+		t.Errorf("Expected %s on screen, got\n%s", machine.ErrSoldOut, h.Screen())
+	}
+
+	h.Type("k", KeyEnter)
+	if !strings.Contains(h.Screen(), machine.ErrInsufficientFunds.Error()) {
+		t.Errorf("Expected %s on screen, got\n%s", machine.ErrInsufficientFunds, h.Screen())
+	}
+
+	// the change stays inserted for the next buy until returned
+	h.Type("x", KeyEnter, "r")
+	s := h.m.Snapshot()
+	if len(s.Outlet) != 1 || s.Outlet[0] != "Canned coffee" {
+		t.Errorf("Expected Canned coffee in the outlet, got %v", s.Outlet)
+	}
+	if !reflect.DeepEqual(s.ReturnGate, []machine.Currency{machine.C10, machine.C10, machine.C10}) {
+		t.Errorf("Expected 3 x 10 in the return gate, got %v", s.ReturnGate)
+	}
+
+	h.Type("t")
+	if actual := line(h.Screen(), "GOT"); actual != "GOT Items: Canned coffee / GOT Changes: 10 JPY, 10 JPY, 10 JPY" {
+		t.Errorf("Expected the taken items and change, got %s", actual)
+	}
+	h.Type("t")
+	if actual := line(h.Screen(), "Nothing"); actual != "Nothing to take" {
+		t.Errorf("Expected Nothing to take, got %s", actual)
+	}
+}
+
+func TestCart(t *testing.T) {
+	h := createTestHarness()
+
+	h.Type("a", "j", "j", "a")
+	if actual := line(h.Screen(), "[Cart total]"); !strings.Contains(actual, "270 JPY") {
+		t.Errorf("Expected cart total 270 JPY, got %s", actual)
+	}
+
+	h.Type("c", "c", "c", "p")
+	if actual := h.m.Snapshot().Outlet; len(actual) != 2 {
+		t.Errorf("Expected 2 items in the outlet, got %v", actual)
+	}
+
+	h.Type("a", "c", "r")
+	s := h.m.Snapshot()
+	if len(s.Cart) != 0 || s.Input != 0 {
+		t.Errorf("Expected cancel to clear the cart and return input, got %v and %d", s.Cart, s.Input)
+	}
+	if len(s.ReturnGate) == 0 {
+		t.Errorf("Expected the input in the return gate, got %v", s.ReturnGate)
+	}
+}
+
+func TestAnimation(t *testing.T) {
+	h := createTestHarness()
+
+	if strings.Contains(h.Screen(), "▼") {
+		t.Errorf("Expected no animation before buying, got\n%s", h.Screen())
+	}
+
+	h.Type("c", "x", KeyEnter)
+	if h.outletFrames != animationFrames || h.returnFrames != 0 {
+		t.Errorf("Expected the outlet to animate, got %d and %d frames", h.outletFrames, h.returnFrames)
+	}
+	h.Type("r")
+	if h.returnFrames != animationFrames {
+		t.Errorf("Expected the return gate to animate, got %d frames", h.returnFrames)
+	}
+
+	shown := 0
+	for i := 0; i < animationFrames; i++ {
+		if strings.Contains(line(h.Screen(), "[Outlet]"), "▼") {
+			shown++
+		}
+		h.Tick(1)
+	}
+	if shown != animationFrames/2 {
+		t.Errorf("Expected the outlet arrow to blink %d times, got %d", animationFrames/2, shown)
+	}
+	if h.App.Tick() {
+		t.Errorf("Expected the animation to be over")
+	}
+
+	// taking items does not animate
+	h.Type("t")
+	if h.outletFrames != 0 || h.returnFrames != 0 {
+		t.Errorf("Expected no animation after taking, got %d and %d frames", h.outletFrames, h.returnFrames)
+	}
+}
+
+func TestQuit(t *testing.T) {
+	for _, k := range []Key{"q", KeyEsc, KeyCtrlC} {
+		h := createTestHarness()
+		h.Type(k, "c")
+		if h.Running {
+			t.Errorf("Expected %s to quit", k)
+		}
+		if actual := h.m.Snapshot().Input; actual != 0 {
+			t.Errorf("Expected keys after %s to be ignored, got input %d", k, actual)
+		}
+	}
+
+	h := createTestHarness()
+	h.Type("?", KeyLeft)
+	if !h.Running {
+		t.Errorf("Expected unbound keys to be ignored")
+	}
+}
+
+func TestJapanese(t *testing.T) {
+	h := createTestHarness(machine.WithLocale(machine.Japanese))
+	h.Type(KeyDown, "c", KeyEnter)
+
+	screen := h.Screen()
+	for _, expected := range []string{"[投入金額]", "缶コーヒー", "この商品は売り切れです", "購入", "終了"} {
+		if !strings.Contains(screen, expected) {
+			t.Errorf("Expected %s on screen, got\n%s", expected, screen)
+		}
+	}
+
+	h.Type("r", "t", "t")
+	if !strings.Contains(h.Screen(), "取り出すものはありません") {
+		t.Errorf("Expected nothing to take on screen, got\n%s", h.Screen())
+	}
+}
+
+func TestRun(t *testing.T) {
+	h := createTestHarness()
+	out := &strings.Builder{}
+
+	if err := h.Run(strings.NewReader("cx\r\x1b[Bq"), out); err != nil {
+		t.Errorf("Expected no error, got %s", err)
+	}
+	if actual := h.m.Snapshot().Outlet; len(actual) != 1 {
+		t.Errorf("Expected an item in the outlet, got %v", actual)
+	}
+	if strings.Contains(strings.ReplaceAll(out.String(), "\r\n", ""), "\n") {
+		t.Errorf("Expected lines to end with \\r\\n, got %q", out.String())
+	}
+	if !strings.HasSuffix(out.String(), showCursor) {
+		t.Errorf("Expected the cursor to be shown again on quit")
+	}
+
+	// closed input quits
+	h = createTestHarness()
+	if err := h.Run(strings.NewReader("c"), &strings.Builder{}); err != nil {
+		t.Errorf("Expected no error at end of input, got %s", err)
+	}
+
+	expected := errors.New("read error")
+	if err := h.Run(errReader{expected}, &strings.Builder{}); err != expected {
+		t.Errorf("Expected %s, got %v", expected, err)
+	}
+}
+
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read(b []byte) (int, error) {
+	return 0, r.err
+}
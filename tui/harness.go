@@ -0,0 +1,45 @@
+package tui
+
+import (
+	"regexp"
+
+	"github.com/chapterzero/sai_vending/machine"
+)
+
+// ansi matches the escape sequences of View
+var ansi = regexp.MustCompile("\x1b\\[[0-9;?]*[a-zA-Z]")
+
+// Harness drives an app without a terminal, keys are typed and the
+// screen is read as plain text, for tests and scripted demos
+type Harness struct {
+	*App
+	// Running is false once a key quit the app
+	Running bool
+}
+
+// NewHarness returns a harness of the front end of m
+func NewHarness(m *machine.Machine) *Harness {
+	return &Harness{App: New(m), Running: true}
+}
+
+// Type presses keys in order, keys after quit are ignored
+func (h *Harness) Type(keys ...Key) {
+	for _, k := range keys {
+		if !h.Running {
+			return
+		}
+		h.Running = h.HandleKey(k)
+	}
+}
+
+// Tick advances the animations by n frames
+func (h *Harness) Tick(n int) {
+	for i := 0; i < n; i++ {
+		h.App.Tick()
+	}
+}
+
+// Screen returns View without ANSI attributes
+func (h *Harness) Screen() string {
+	return ansi.ReplaceAllString(h.View(), "")
+}
@@ -0,0 +1,54 @@
+package tui
+
+import (
+	"unicode/utf8"
+)
+
+// Key is a key press, printable keys are the character
+// itself, ex: "z", other keys are named, ex: KeyUp
+type Key string
+
+const (
+	KeyUp    Key = "up"
+	KeyDown  Key = "down"
+	KeyLeft  Key = "left"
+	KeyRight Key = "right"
+	KeyEnter Key = "enter"
+	KeyEsc   Key = "esc"
+	KeyCtrlC Key = "ctrl+c"
+)
+
+// escape sequences of the arrow keys
+var arrows = map[byte]Key{'A': KeyUp, 'B': KeyDown, 'C': KeyRight, 'D': KeyLeft}
+
+// Decode split what the terminal sent in raw mode into keys,
+// unknown escape sequences are dropped
+func Decode(b []byte) []Key {
+	keys := []Key{}
+	for len(b) > 0 {
+		switch {
+		case b[0] == 0x1b && len(b) >= 3 && (b[1] == '[' || b[1] == 'O'):
+			if k, ok := arrows[b[2]]; ok {
+				keys = append(keys, k)
+			}
+			b = b[3:]
+		case b[0] == 0x1b:
+			keys = append(keys, KeyEsc)
+			b = b[1:]
+		case b[0] == '\r' || b[0] == '\n':
+			keys = append(keys, KeyEnter)
+			b = b[1:]
+		case b[0] == 0x03:
+			keys = append(keys, KeyCtrlC)
+			b = b[1:]
+		default:
+			r, n := utf8.DecodeRune(b)
+			if r != utf8.RuneError && r >= ' ' {
+				keys = append(keys, Key(string(r)))
+			}
+			b = b[n:]
+		}
+	}
+
+	return keys
+}
@@ -0,0 +1,31 @@
+package tui
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	testCases := []struct {
+		input    string
+		expected []Key
+	}{
+		{"", []Key{}},
+		{"z", []Key{"z"}},
+		{"zx", []Key{"z", "x"}},
+		{"\x1b[A\x1b[B\x1b[C\x1b[D", []Key{KeyUp, KeyDown, KeyRight, KeyLeft}},
+		{"\x1bOA", []Key{KeyUp}},
+		{"\x1b[Z", []Key{}},
+		{"\x1b", []Key{KeyEsc}},
+		{"\r\n", []Key{KeyEnter, KeyEnter}},
+		{"\x03", []Key{KeyCtrlC}},
+		{"\x01", []Key{}},
+		{"あ", []Key{"あ"}},
+	}
+
+	for _, v := range testCases {
+		if actual := Decode([]byte(v.input)); !reflect.DeepEqual(v.expected, actual) {
+			t.Errorf("Expected %q to decode to %v, got %v", v.input, v.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package tui
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// tickInterval is the duration of an animation frame
+const tickInterval = 100 * time.Millisecond
+
+// Run draws the app on out and reads keys from in until the user
+// quits or in is closed. in should be a terminal in raw mode, see Raw
+func (a *App) Run(in io.Reader, out io.Writer) error {
+	keys := make(chan Key)
+	done := make(chan error, 1)
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			n, err := in.Read(buf)
+			for _, k := range Decode(buf[:n]) {
+				select {
+				case keys <- k:
+				case <-stop:
+					return
+				}
+			}
+			if err != nil {
+				done <- err
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+	fmt.Fprint(out, hideCursor)
+	defer fmt.Fprint(out, showCursor)
+
+	redraw := true
+	animating := false
+	for {
+		if redraw {
+			// raw mode does not turn "\n" into "\r\n"
+			fmt.Fprint(out, clearScreen+strings.ReplaceAll(a.View(), "\n", "\r\n"))
+		}
+		select {
+		case k := <-keys:
+			if !a.HandleKey(k) {
+				return nil
+			}
+			redraw, animating = true, true
+		case <-ticker.C:
+			// the last frame is drawn once the animation stops
+			redraw = animating
+			animating = a.Tick()
+		case err := <-done:
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// Raw puts the terminal of stdin in raw mode so keys are read one
+// by one without echo, restore gives the terminal back as it was
+func Raw() (restore func() error, err error) {
+	state, err := stty("-g")
+	if err != nil {
+		return nil, fmt.Errorf("Unable to read terminal state: %w", err)
+	}
+	if _, err := stty("raw", "-echo"); err != nil {
+		return nil, fmt.Errorf("Unable to set terminal raw mode: %w", err)
+	}
+
+	return func() error {
+		_, err := stty(strings.TrimSpace(state))
+		return err
+	}, nil
+}
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return string(out), err
+}